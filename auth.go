@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Roles of users and API tokens. An operator uploads files and downloads results,
+// an admin also reads and changes the configuration.
+const (
+	roleOperator = "operator"
+	roleAdmin    = "admin"
+)
+
+var errUnauthenticated = errors.New("authentication required")
+
+// userContextKey stores the signed-in user in the request context
+type userContextKey struct{}
+
+// signedIn is the user or token a request is signed with
+type signedIn struct {
+	name string
+	role string
+}
+
+// requestUser returns the name and role of the user the request is signed with,
+// both empty when authentication is disabled
+func requestUser(r *http.Request) (string, string) {
+	user, _ := r.Context().Value(userContextKey{}).(signedIn)
+	return user.name, user.role
+}
+
+// corsMethods are the methods allowed to cross-origin requests, answered to preflight requests
+const corsMethods = "GET, POST, PUT, DELETE, OPTIONS"
+
+// dummyHash is compared with the password of unknown users, so that they take as long to reject as known ones
+var dummyHash = []byte("$2a$10$.LZK9w8B1tf9kH4g39UT7.0blneRgi5uzbhnYChDUaaMDLX/LhpVu")
+
+// User is a local user signing in with HTTP Basic authentication
+type User struct {
+	Name string `yaml:"name"`
+	// PasswordHash is a bcrypt hash, see ex2ex hash-password
+	PasswordHash string `yaml:"password_hash"`
+	Role         string `yaml:"role"`
+}
+
+// APIToken is a static token sent as Authorization: Bearer <token>
+type APIToken struct {
+	Name string `yaml:"name"`
+	// SHA256 is the hex SHA-256 hash of the token, the token itself is not stored
+	SHA256 string `yaml:"sha256"`
+	Role   string `yaml:"role"`
+}
+
+// UsersFile is the file of users and API tokens allowed to use the web server
+type UsersFile struct {
+	Users  []User     `yaml:"users"`
+	Tokens []APIToken `yaml:"tokens"`
+}
+
+// Authenticator checks the credentials of requests against the users file.
+// The file is read again when it changes, so users can be added without a restart.
+type Authenticator struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	users   map[string]User
+	tokens  []APIToken
+}
+
+// NewAuthenticator reads the users file. A nil authenticator allows every request,
+// so the server fails to start rather than run without a users file.
+func NewAuthenticator(path string) (*Authenticator, error) {
+	if path == "" {
+		return nil, errors.New("USERS_FILE is not set: give a users file with -users, or start with -insecure-no-auth to serve without sign-in")
+	}
+	a := &Authenticator{path: path}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// reload reads the users file if it changed since it was last read
+func (a *Authenticator) reload() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime() == a.modTime && a.users != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+	var file UsersFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %w", a.path, err)
+	}
+	if err := file.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", a.path, err)
+	}
+
+	a.users = make(map[string]User, len(file.Users))
+	for _, user := range file.Users {
+		a.users[user.Name] = user
+	}
+	a.tokens = file.Tokens
+	a.modTime = info.ModTime()
+	return nil
+}
+
+// Validate checks the users and tokens of the file
+func (f *UsersFile) Validate() error {
+	if len(f.Users) == 0 && len(f.Tokens) == 0 {
+		return fmt.Errorf("no users or tokens defined")
+	}
+	names := make(map[string]bool, len(f.Users))
+	for i, user := range f.Users {
+		if user.Name == "" || strings.Contains(user.Name, ":") {
+			return fmt.Errorf("user %d: invalid name %q", i, user.Name)
+		}
+		if names[user.Name] {
+			return fmt.Errorf("user %s: duplicate name", user.Name)
+		}
+		names[user.Name] = true
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			return fmt.Errorf("user %s: password_hash is not a bcrypt hash", user.Name)
+		}
+		if err := validateRole(user.Role); err != nil {
+			return fmt.Errorf("user %s: %w", user.Name, err)
+		}
+	}
+	for i, token := range f.Tokens {
+		if hash, err := hex.DecodeString(token.SHA256); err != nil || len(hash) != sha256.Size {
+			return fmt.Errorf("token %d: sha256 must be 64 hex digits", i)
+		}
+		if err := validateRole(token.Role); err != nil {
+			return fmt.Errorf("token %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateRole(role string) error {
+	if role != roleOperator && role != roleAdmin {
+		return fmt.Errorf("unknown role %q, expected %s or %s", role, roleOperator, roleAdmin)
+	}
+	return nil
+}
+
+// authenticate returns the name and role of the user or token the request is signed with
+func (a *Authenticator) authenticate(r *http.Request) (string, string, error) {
+	a.mu.Lock()
+	if err := a.reload(); err != nil {
+		// Keep the users read last, a file being edited is read again on the next request
+		log.Printf("Error reading users file: %v", err)
+	}
+	users, tokens := a.users, a.tokens
+	a.mu.Unlock()
+
+	if header := r.Header.Get("Authorization"); len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		hash := sha256.Sum256([]byte(strings.TrimSpace(header[7:])))
+		for _, token := range tokens {
+			expected, _ := hex.DecodeString(token.SHA256)
+			if subtle.ConstantTimeCompare(hash[:], expected) == 1 {
+				return token.Name, token.Role, nil
+			}
+		}
+		return "", "", errUnauthenticated
+	}
+
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return "", "", errUnauthenticated
+	}
+	user, known := users[name]
+	hash := dummyHash
+	if known {
+		hash = []byte(user.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !known {
+		return "", "", errUnauthenticated
+	}
+	return user.Name, user.Role, nil
+}
+
+// require allows the handler to users and tokens with the role; admins are allowed everything.
+// All requests are allowed when authentication is disabled. CORS preflight requests carry
+// no credentials, they are answered here and never reach the handler.
+func (a *Authenticator) require(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			setCORS(w, r, corsMethods)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if a == nil {
+			next(w, r)
+			return
+		}
+
+		name, userRole, err := a.authenticate(r)
+		if err != nil {
+			log.Printf("Authentication failed for %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Basic realm="ex2ex", charset="UTF-8"`)
+			sendError(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		if userRole != role && userRole != roleAdmin {
+			log.Printf("Access denied to %s for %s %s", name, r.Method, r.URL.Path)
+			sendError(w, "Access denied: "+role+" role required", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, signedIn{name: name, role: userRole})))
+	}
+}
+
+// profilesAccess lets operators list profiles to choose one for an upload,
+// reading and changing the profiles themselves requires the admin role
+func (a *Authenticator) profilesAccess(next http.HandlerFunc) http.HandlerFunc {
+	operator, admin := a.require(roleOperator, next), a.require(roleAdmin, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/config/profiles"), "/") == "" {
+			operator(w, r)
+			return
+		}
+		admin(w, r)
+	}
+}
+
+// setCORS allows cross-origin requests from the origins listed in CORS_ORIGINS.
+// Other origins get no CORS headers, so browsers only allow same-origin requests.
+func setCORS(w http.ResponseWriter, r *http.Request, methods string) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	for _, allowed := range corsOrigins {
+		if allowed != "*" && !strings.EqualFold(allowed, origin) {
+			continue
+		}
+		if allowed == "*" {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+		w.Header().Set("Access-Control-Allow-Methods", methods)
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		return
+	}
+}
+
+// parseOrigins splits a comma-separated list of origins, such as https://intranet.example.com
+func parseOrigins(value string) []string {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testToken = "secret-token"
+
+// testAuthenticator writes a users file with an operator, an admin and an operator token
+func testAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(testToken))
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	data := "users:\n" +
+		"  - {name: op, password_hash: '" + string(hash) + "', role: operator}\n" +
+		"  - {name: boss, password_hash: '" + string(hash) + "', role: admin}\n" +
+		"tokens:\n" +
+		"  - {name: robot, sha256: " + hex.EncodeToString(sum[:]) + ", role: operator}\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewAuthenticator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+// serveTest runs a request through the handler and reports whether the wrapped handler was reached
+func serveTest(wrap func(http.HandlerFunc) http.HandlerFunc, r *http.Request) (*httptest.ResponseRecorder, bool) {
+	called := false
+	handler := wrap(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w, called
+}
+
+func testRequest(method, path, user, token string) *http.Request {
+	r := httptest.NewRequest(method, path, nil)
+	if user != "" {
+		name, password, _ := strings.Cut(user, ":")
+		r.SetBasicAuth(name, password)
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestRequire(t *testing.T) {
+	auth := testAuthenticator(t)
+
+	tests := []struct {
+		name   string
+		role   string
+		method string
+		user   string
+		token  string
+		want   int
+	}{
+		{"no credentials", roleOperator, http.MethodGet, "", "", http.StatusUnauthorized},
+		{"wrong password", roleOperator, http.MethodGet, "op:wrong", "", http.StatusUnauthorized},
+		{"unknown user", roleOperator, http.MethodGet, "nobody:pass", "", http.StatusUnauthorized},
+		{"operator", roleOperator, http.MethodGet, "op:pass", "", http.StatusOK},
+		{"operator on admin page", roleAdmin, http.MethodGet, "op:pass", "", http.StatusForbidden},
+		{"admin on operator page", roleOperator, http.MethodPost, "boss:pass", "", http.StatusOK},
+		{"admin", roleAdmin, http.MethodPut, "boss:pass", "", http.StatusOK},
+		{"token", roleOperator, http.MethodPost, "", testToken, http.StatusOK},
+		{"token on admin page", roleAdmin, http.MethodGet, "", testToken, http.StatusForbidden},
+		{"wrong token", roleOperator, http.MethodGet, "", "other", http.StatusUnauthorized},
+		{"wrong token with valid user", roleOperator, http.MethodGet, "op:pass", "other", http.StatusUnauthorized},
+		{"preflight without credentials", roleAdmin, http.MethodOptions, "", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrap := func(next http.HandlerFunc) http.HandlerFunc { return auth.require(tt.role, next) }
+			w, called := serveTest(wrap, testRequest(tt.method, "/admin", tt.user, tt.token))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if called != (tt.want == http.StatusOK) {
+				t.Errorf("handler called = %v with status %d", called, w.Code)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("WWW-Authenticate header is missing")
+			}
+		})
+	}
+}
+
+func TestRequirePreflight(t *testing.T) {
+	saved := corsOrigins
+	defer func() { corsOrigins = saved }()
+	corsOrigins = []string{"https://intranet.example.com"}
+
+	tests := []struct {
+		name       string
+		auth       *Authenticator
+		origin     string
+		wantOrigin string
+	}{
+		{"allowed origin", testAuthenticator(t), "https://INTRANET.example.com", "https://INTRANET.example.com"},
+		{"other origin", testAuthenticator(t), "https://evil.example.com", ""},
+		{"authentication disabled", nil, "https://intranet.example.com", "https://intranet.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRequest(http.MethodOptions, "/api/config", "", "")
+			r.Header.Set("Origin", tt.origin)
+			wrap := func(next http.HandlerFunc) http.HandlerFunc { return tt.auth.require(roleAdmin, next) }
+			w, called := serveTest(wrap, r)
+			if w.Code != http.StatusNoContent || called {
+				t.Errorf("status = %d, handler called = %v, want %d without calling the handler", w.Code, called, http.StatusNoContent)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.wantOrigin != "" && w.Header().Get("Access-Control-Allow-Methods") != corsMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", w.Header().Get("Access-Control-Allow-Methods"), corsMethods)
+			}
+		})
+	}
+}
+
+func TestProfilesAccess(t *testing.T) {
+	auth := testAuthenticator(t)
+
+	tests := []struct {
+		method string
+		path   string
+		user   string
+		want   int
+	}{
+		{http.MethodGet, "/api/config/profiles", "op:pass", http.StatusOK},
+		{http.MethodGet, "/api/config/profiles/", "op:pass", http.StatusOK},
+		{http.MethodGet, "/api/config/profiles/daily", "op:pass", http.StatusForbidden},
+		{http.MethodPost, "/api/config/profiles", "op:pass", http.StatusForbidden},
+		{http.MethodDelete, "/api/config/profiles/daily", "op:pass", http.StatusForbidden},
+		{http.MethodGet, "/api/config/profiles/daily", "boss:pass", http.StatusOK},
+		{http.MethodPut, "/api/config/profiles/daily", "boss:pass", http.StatusOK},
+		{http.MethodGet, "/api/config/profiles", "", http.StatusUnauthorized},
+		{http.MethodOptions, "/api/config/profiles/daily", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path+" "+tt.user, func(t *testing.T) {
+			w, _ := serveTest(auth.profilesAccess, testRequest(tt.method, tt.path, tt.user, ""))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireWithoutAuthenticator(t *testing.T) {
+	var auth *Authenticator
+	wrap := func(next http.HandlerFunc) http.HandlerFunc { return auth.require(roleAdmin, next) }
+	if w, called := serveTest(wrap, testRequest(http.MethodPost, "/api/config", "", "")); !called || w.Code != http.StatusOK {
+		t.Errorf("status = %d, handler called = %v, want every request allowed", w.Code, called)
+	}
+	if _, err := NewAuthenticator(""); err == nil || !strings.Contains(err.Error(), "-insecure-no-auth") {
+		t.Errorf("NewAuthenticator(\"\") error = %v, want it to name -insecure-no-auth", err)
+	}
+}
+
+func TestAuthenticatorReload(t *testing.T) {
+	auth := testAuthenticator(t)
+	wrap := func(next http.HandlerFunc) http.HandlerFunc { return auth.require(roleAdmin, next) }
+	if w, _ := serveTest(wrap, testRequest(http.MethodGet, "/admin", "op:pass", "")); w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// Promote the operator, the file is read again without a restart
+	data, err := os.ReadFile(auth.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), "role: operator}", "role: admin}", 1))
+	if err := os.WriteFile(auth.path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(auth.path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := serveTest(wrap, testRequest(http.MethodGet, "/admin", "op:pass", "")); w.Code != http.StatusOK {
+		t.Errorf("status after the change = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// A broken file keeps the users read last
+	if err := os.WriteFile(auth.path, []byte("users: ["), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Minute)
+	if err := os.Chtimes(auth.path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := serveTest(wrap, testRequest(http.MethodGet, "/admin", "op:pass", "")); w.Code != http.StatusOK {
+		t.Errorf("status with a broken file = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestUsersFileValidate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := func(name, role string) User { return User{Name: name, PasswordHash: string(hash), Role: role} }
+	sum := sha256.Sum256([]byte(testToken))
+	token := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		file    UsersFile
+		wantErr string
+	}{
+		{"users and tokens", UsersFile{Users: []User{user("a", roleOperator)}, Tokens: []APIToken{{SHA256: token, Role: roleAdmin}}}, ""},
+		{"tokens only", UsersFile{Tokens: []APIToken{{SHA256: token, Role: roleOperator}}}, ""},
+		{"empty", UsersFile{}, "no users or tokens defined"},
+		{"empty name", UsersFile{Users: []User{user("", roleOperator)}}, "user 0: invalid name"},
+		{"colon in name", UsersFile{Users: []User{user("a:b", roleOperator)}}, "invalid name"},
+		{"duplicate", UsersFile{Users: []User{user("a", roleOperator), user("a", roleAdmin)}}, "user a: duplicate name"},
+		{"plain password", UsersFile{Users: []User{{Name: "a", PasswordHash: "pass", Role: roleOperator}}}, "not a bcrypt hash"},
+		{"unknown role", UsersFile{Users: []User{user("a", "root")}}, `unknown role "root"`},
+		{"short token hash", UsersFile{Tokens: []APIToken{{SHA256: token[:62], Role: roleOperator}}}, "token 0: sha256 must be 64 hex digits"},
+		{"token without role", UsersFile{Tokens: []APIToken{{SHA256: token}}}, `token 0: unknown role ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.file.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseOrigins(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"*", []string{"*"}},
+		{" https://a.example.com/ , ,http://b.example.com:8080", []string{"https://a.example.com", "http://b.example.com:8080"}},
+	}
+	for _, tt := range tests {
+		if got := parseOrigins(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseOrigins(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
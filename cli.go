@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"ex2ex/transform"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Exit codes of the command-line mode
+const (
+	exitOK            = 0
+	exitFailed        = 1
+	exitUsage         = 2
+	exitMappingErrors = 3
+)
+
+const usageText = `Usage:
+  ex2ex [serve] [-port PORT] [-c CONFIG] [-profiles DIR] [-users FILE] [-insecure-no-auth]
+  ex2ex transform [-c CONFIG] [-p PROFILE] [-profiles DIR] [-f FORMAT] [-password PASSWORD] [-o OUTPUT] INPUT...
+  ex2ex validate CONFIG...
+  ex2ex hash-password < PASSWORD
+
+Commands:
+  serve          start the web server (default)
+  transform      apply a profile to INPUT and print a JSON report to stdout
+  validate       check configuration files and print a JSON result to stdout
+  hash-password  read a password from stdin and print its bcrypt hash for the users file
+
+Inputs:
+  INPUT is a .xlsx, .xls, .ods, .csv, .tsv or .zip file. With several inputs, each file is given
+  as ALIAS=FILE or matched to the inputs of the profile by its name.
+
+Output formats:
+  -f selects xlsx, ods, csv, json or ndjson instead of the output_format of the profile.
+  Without -o, the output file is output_filename with the extension of the format.
+
+Passwords:
+  -password opens encrypted inputs instead of the input_password of the profile.
+  The EX2EX_PASSWORD environment variable is used if -password is not given.
+
+Users:
+  serve -users (USERS_FILE) requires sign-in with the users and API tokens of FILE.
+  The web server does not start without a users file, unless -insecure-no-auth
+  is given to open it to everyone, for example on a developer machine.
+
+Exit codes:
+  0  success
+  1  the transformation failed or a configuration is invalid
+  2  invalid command line
+  3  the transformation finished but some mappings reported errors
+`
+
+// TransformResult is printed by the transform command
+type TransformResult struct {
+	Input   string                      `json:"input,omitempty"`
+	Inputs  map[string]string           `json:"inputs,omitempty"`
+	Output  string                      `json:"output,omitempty"`
+	Profile string                      `json:"profile,omitempty"`
+	Report  *transform.ProcessingReport `json:"report,omitempty"`
+	Error   string                      `json:"error,omitempty"`
+}
+
+// ValidationResult is printed by the validate command, one entry per YAML document
+type ValidationResult struct {
+	File     string `json:"file"`
+	Document int    `json:"document,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Valid    bool   `json:"valid"`
+	Error    string `json:"error,omitempty"`
+}
+
+// runCommand runs the subcommand given on the command line and returns the exit code
+func runCommand(args []string) int {
+	command := "serve"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		return runServe(args)
+	case "transform":
+		return runTransform(args, os.Stdout)
+	case "validate":
+		return runValidate(args, os.Stdout)
+	case "hash-password":
+		return runHashPassword(args, os.Stdin, os.Stdout)
+	case "help":
+		fmt.Fprint(os.Stdout, usageText)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usageText)
+		return exitUsage
+	}
+}
+
+func runServe(args []string) int {
+	fs := newFlagSet("serve")
+	fs.StringVar(&port, "port", port, "port to listen on")
+	fs.StringVar(&configFile, "c", configFile, "main configuration file")
+	fs.StringVar(&profilesDir, "profiles", profilesDir, "directory with named profiles")
+	fs.StringVar(&usersFile, "users", usersFile, "file of users and API tokens")
+	fs.BoolVar(&noAuth, "insecure-no-auth", false, "serve without sign-in if no users file is given")
+	if _, err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+
+	serve()
+	return exitOK
+}
+
+func runTransform(args []string, stdout io.Writer) int {
+	fs := newFlagSet("transform")
+	configPath := fs.String("c", configFile, "main configuration file")
+	profile := fs.String("p", "", "profile name (default profile of the configuration file if empty)")
+	dir := fs.String("profiles", profilesDir, "directory with named profiles")
+	format := fs.String("f", "", "output format: xlsx, ods, csv, json or ndjson (output_format of the profile if empty)")
+	password := fs.String("password", os.Getenv("EX2EX_PASSWORD"), "password of encrypted inputs (input_password of the profile if empty)")
+	output := fs.String("o", "", "output file (output_filename of the profile if empty)")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "transform expects at least one input file\n\n%s", usageText)
+		return exitUsage
+	}
+	if err := transform.ValidateOutputFormat(*format); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n%s", err, usageText)
+		return exitUsage
+	}
+
+	result := TransformResult{Profile: *profile}
+	if len(args) == 1 {
+		result.Input = args[0]
+	}
+
+	config, err := NewProfileStore(*configPath, *dir).Get(*profile)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to load config: %v", err)
+		writeJSON(stdout, result)
+		return exitFailed
+	}
+	if *format != "" {
+		profile := *config
+		profile.OutputFormat = *format
+		if err := profile.Validate(); err != nil {
+			result.Error = fmt.Sprintf("invalid output format: %v", err)
+			writeJSON(stdout, result)
+			return exitFailed
+		}
+		config = &profile
+	}
+
+	// Zip archives are extracted into a temporary directory
+	tempDir, err := os.MkdirTemp("", "ex2ex-")
+	if err != nil {
+		result.Error = err.Error()
+		writeJSON(stdout, result)
+		return exitFailed
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputs, err := resolveInputs(inputArgs(args, config), config, tempDir)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid input files: %v", err)
+		writeJSON(stdout, result)
+		return exitFailed
+	}
+	if len(args) > 1 {
+		result.Inputs = inputs
+	}
+
+	result.Output = *output
+	if result.Output == "" {
+		result.Output = config.OutputFilename
+	}
+
+	// Ctrl+C stops the transformation between rows
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := transformFile(ctx, inputs, result.Output, config, *password, nil)
+	if err != nil {
+		result.Output = ""
+		result.Error = err.Error()
+		writeJSON(stdout, result)
+		return exitFailed
+	}
+
+	// Data formats change the extension of the default output file
+	if *output == "" && report.OutputFilename != result.Output {
+		if err := os.Rename(result.Output, report.OutputFilename); err != nil {
+			os.Remove(result.Output)
+			result.Output = ""
+			result.Error = fmt.Sprintf("failed to save output file: %v", err)
+			writeJSON(stdout, result)
+			return exitFailed
+		}
+		result.Output = report.OutputFilename
+	}
+
+	result.Report = report
+	writeJSON(stdout, result)
+	if report.ErrorCount > 0 {
+		return exitMappingErrors
+	}
+	return exitOK
+}
+
+// inputArgs returns the input files of the command line. ALIAS=FILE gives the file of an input
+// declared in the profile, other arguments are file names.
+func inputArgs(args []string, config *transform.Config) []inputFile {
+	files := make([]inputFile, len(args))
+	for i, arg := range args {
+		files[i] = inputFile{name: arg, path: arg}
+		if alias, path, ok := strings.Cut(arg, "="); ok {
+			if _, declared := config.Inputs[alias]; declared {
+				files[i] = inputFile{field: alias, name: path, path: path}
+			}
+		}
+	}
+	return files
+}
+
+func runValidate(args []string, stdout io.Writer) int {
+	fs := newFlagSet("validate")
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(files) == 0 {
+		files = []string{configFile}
+	}
+
+	code := exitOK
+	results := []ValidationResult{}
+	for _, file := range files {
+		configs, err := loadConfigDocuments(file)
+		if err == nil && len(configs) == 0 {
+			err = errors.New("no profiles found")
+		}
+		if err != nil {
+			results = append(results, ValidationResult{File: file, Error: err.Error()})
+			code = exitFailed
+			continue
+		}
+
+		for i, config := range configs {
+			result := ValidationResult{File: file, Document: i + 1, Name: config.Name, Valid: true}
+			if err := config.Validate(); err != nil {
+				result.Valid = false
+				result.Error = err.Error()
+				code = exitFailed
+			}
+			results = append(results, result)
+		}
+	}
+
+	writeJSON(stdout, results)
+	return code
+}
+
+// runHashPassword prints the bcrypt hash of the password on the first line of stdin,
+// so that the password does not show in the process list or the shell history
+func runHashPassword(args []string, stdin io.Reader, stdout io.Writer) int {
+	fs := newFlagSet("hash-password")
+	if rest, err := parseFlags(fs, args); err != nil || len(rest) > 0 {
+		return exitUsage
+	}
+
+	password, err := bufio.NewReader(stdin).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		if err == nil || err == io.EOF {
+			err = errors.New("empty password")
+		}
+		fmt.Fprintf(os.Stderr, "failed to read password: %v\n", err)
+		return exitFailed
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to hash password: %v\n", err)
+		return exitFailed
+	}
+	fmt.Fprintln(stdout, string(hash))
+	return exitOK
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usageText)
+	}
+	return fs
+}
+
+// parseFlags parses flags placed before or after the positional arguments and returns the latter
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// testCLIFiles writes a config file with the default profile and an input workbook,
+// encrypted with password if it is not empty, and returns their paths
+func testCLIFiles(t *testing.T, profile, password string) (configPath, inputPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	configPath = filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := excelize.NewFile()
+	defer input.Close()
+	if err := input.SetSheetRow("Sheet1", "A1", &[]interface{}{"name", 42}); err != nil {
+		t.Fatal(err)
+	}
+	inputPath = filepath.Join(dir, "input.xlsx")
+	if err := input.SaveAs(inputPath, excelize.Options{Password: password}); err != nil {
+		t.Fatal(err)
+	}
+	return configPath, inputPath
+}
+
+// testCLIProfile copies A1:B1 and reads the encrypted inputs with inputPassword
+func testCLIProfile(source, inputPassword string) string {
+	profile := "output_filename: out.xlsx\nmappings:\n  - {source: '" + source + "', destination: 'Sheet1!A1'}\n"
+	if inputPassword != "" {
+		profile += "input_password: " + inputPassword + "\n"
+	}
+	return profile
+}
+
+func TestRunTransform(t *testing.T) {
+	tests := []struct {
+		name      string
+		profile   string
+		encrypted bool
+		env       string
+		args      []string
+		want      int
+		wantErr   string
+	}{
+		{name: "success", profile: testCLIProfile("Sheet1!A1:B1", ""), want: exitOK},
+		{name: "mapping errors", profile: testCLIProfile("Missing!A1:B1", ""), want: exitMappingErrors},
+		{name: "unknown profile", profile: testCLIProfile("Sheet1!A1:B1", ""), args: []string{"-p", "nightly"}, want: exitFailed, wantErr: "failed to load config"},
+		{name: "missing input", profile: testCLIProfile("Sheet1!A1:B1", ""), args: []string{"missing.xlsx"}, want: exitFailed, wantErr: "failed to open source file"},
+		{name: "unknown flag", profile: testCLIProfile("Sheet1!A1:B1", ""), args: []string{"-x"}, want: exitUsage},
+		{name: "unknown format", profile: testCLIProfile("Sheet1!A1:B1", ""), args: []string{"-f", "pdf"}, want: exitUsage},
+
+		// -password wins over EX2EX_PASSWORD, which wins over input_password of the profile
+		{name: "no password", profile: testCLIProfile("Sheet1!A1:B1", ""), encrypted: true, want: exitFailed, wantErr: "a password is required"},
+		{name: "profile password", profile: testCLIProfile("Sheet1!A1:B1", "pass"), encrypted: true, want: exitOK},
+		{name: "environment password", profile: testCLIProfile("Sheet1!A1:B1", "wrong"), encrypted: true, env: "pass", want: exitOK},
+		{name: "flag password", profile: testCLIProfile("Sheet1!A1:B1", "wrong"), encrypted: true, env: "wrong", args: []string{"-password", "pass"}, want: exitOK},
+		{name: "wrong flag password", profile: testCLIProfile("Sheet1!A1:B1", "pass"), encrypted: true, env: "pass", args: []string{"-password", "wrong"}, want: exitFailed, wantErr: "password is not correct"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			password := ""
+			if tt.encrypted {
+				password = "pass"
+			}
+			configPath, inputPath := testCLIFiles(t, tt.profile, password)
+			t.Setenv("EX2EX_PASSWORD", tt.env)
+			output := filepath.Join(t.TempDir(), "result.xlsx")
+
+			args := []string{"-c", configPath, "-profiles", t.TempDir(), "-o", output}
+			args = append(args, tt.args...)
+			if len(tt.args) == 0 || strings.HasPrefix(tt.args[0], "-") {
+				args = append(args, inputPath)
+			}
+			var stdout bytes.Buffer
+			if code := runTransform(args, &stdout); code != tt.want {
+				t.Fatalf("exit code = %d, want %d, output:\n%s", code, tt.want, stdout.String())
+			}
+			if tt.want == exitUsage {
+				return
+			}
+
+			var result TransformResult
+			if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+				t.Fatalf("output is not a transform result: %v\n%s", err, stdout.String())
+			}
+			if !strings.Contains(result.Error, tt.wantErr) || (tt.wantErr == "") != (result.Error == "") {
+				t.Errorf("error = %q, want %q", result.Error, tt.wantErr)
+			}
+			_, err := os.Stat(output)
+			if tt.want == exitFailed {
+				if result.Output != "" || err == nil {
+					t.Errorf("output = %q, %v, want no output file", result.Output, err)
+				}
+				return
+			}
+			if result.Output != output || err != nil || result.Report == nil {
+				t.Errorf("output = %q, %v, report %v, want %s", result.Output, err, result.Report, output)
+			}
+			if (result.Report.ErrorCount > 0) != (tt.want == exitMappingErrors) {
+				t.Errorf("error count = %d with exit code %d", result.Report.ErrorCount, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunTransformArgs(t *testing.T) {
+	var stdout bytes.Buffer
+	if code := runTransform(nil, &stdout); code != exitUsage || stdout.Len() > 0 {
+		t.Errorf("runTransform() without inputs = %d, %q, want %d", code, stdout.String(), exitUsage)
+	}
+	if code := runCommand([]string{"convert"}); code != exitUsage {
+		t.Errorf("runCommand(convert) = %d, want %d", code, exitUsage)
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(valid, []byte(testProfile("main", "out.xlsx")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalid, []byte(testProfile("", "out.xlsx")+"---\n"+testProfile("", "out.xlsx")+"output_format: pdf\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		files []string
+		want  int
+		valid []bool
+	}{
+		{[]string{valid}, exitOK, []bool{true}},
+		{[]string{valid, invalid}, exitFailed, []bool{true, true, false}},
+		{[]string{filepath.Join(dir, "missing.yaml")}, exitFailed, []bool{false}},
+	}
+	for _, tt := range tests {
+		var stdout bytes.Buffer
+		if code := runValidate(tt.files, &stdout); code != tt.want {
+			t.Errorf("runValidate(%q) = %d, want %d", tt.files, code, tt.want)
+		}
+		var results []ValidationResult
+		if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+			t.Fatal(err)
+		}
+		valid := make([]bool, len(results))
+		for i, result := range results {
+			valid[i] = result.Valid
+		}
+		if !reflect.DeepEqual(valid, tt.valid) {
+			t.Errorf("runValidate(%q) valid = %v, want %v", tt.files, valid, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ex2ex/transform"
+)
+
+// maxArchiveEntries limits the number of workbooks read from a zip archive
+const maxArchiveEntries = 100
+
+// maxInputSize limits the size of a workbook extracted from a zip archive (100 MB)
+var maxInputSize = int64(100 << 20)
+
+// inputExtensions are the extensions of the files accepted as inputs
+var inputExtensions = []string{".xlsx", ".xls", ".ods", ".csv", ".tsv"}
+
+// isInputFile reports whether the file name has the extension of an accepted input file
+func isInputFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range inputExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// inputFile is a workbook given for a transformation. Field is the upload form field
+// or the alias given on the command line, name is the original file name.
+type inputFile struct {
+	field string
+	name  string
+	path  string
+}
+
+// resolveInputs assigns the files to the inputs of the configuration and returns their paths by alias.
+// Zip archives are extracted into dir, each workbook of an archive is matched by its name.
+func resolveInputs(files []inputFile, config *transform.Config, dir string) (map[string]string, error) {
+	var workbooks []inputFile
+	for _, file := range files {
+		if !strings.EqualFold(filepath.Ext(file.name), ".zip") {
+			workbooks = append(workbooks, file)
+			continue
+		}
+		extracted, err := extractArchive(file.path, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", file.name, err)
+		}
+		workbooks = append(workbooks, extracted...)
+	}
+
+	inputs := make(map[string]string)
+	for _, file := range workbooks {
+		alias, err := config.MatchInput(file.field, file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := inputs[alias]; ok {
+			if alias == "" {
+				return nil, fmt.Errorf("file %s does not match any input", file.name)
+			}
+			return nil, fmt.Errorf("several files given for input %s", alias)
+		}
+		inputs[alias] = file.path
+	}
+
+	aliases := make([]string, 0, len(inputs))
+	for alias := range inputs {
+		aliases = append(aliases, alias)
+	}
+	if err := config.CheckInputs(aliases); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+// extractArchive saves the .xlsx, .xls, .ods, .csv and .tsv files of a zip archive in dir. Other files are ignored.
+func extractArchive(path, dir string) ([]inputFile, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	// Entries are matched in name order, whatever their order in the archive
+	entries := make([]*zip.File, 0, len(archive.File))
+	for _, entry := range archive.File {
+		name := filepath.Base(entry.Name)
+		if entry.FileInfo().IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~$") || !isInputFile(name) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no .xlsx, .xls, .ods, .csv or .tsv files found")
+	}
+	if len(entries) > maxArchiveEntries {
+		return nil, fmt.Errorf("too many files, at most %d are allowed", maxArchiveEntries)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	files := make([]inputFile, 0, len(entries))
+	for _, entry := range entries {
+		name := filepath.Base(entry.Name)
+		src, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		path, err := saveFile(dir, name, io.LimitReader(src, maxInputSize+1))
+		src.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if info, err := os.Stat(path); err == nil && info.Size() > maxInputSize {
+			os.Remove(path)
+			return nil, fmt.Errorf("%s exceeds maximum size of 100 MB", name)
+		}
+		files = append(files, inputFile{name: name, path: path})
+	}
+	return files, nil
+}
+
+// saveFile writes r to a new file in dir named after name and returns its path
+func saveFile(dir, name string, r io.Reader) (string, error) {
+	timestamp := time.Now().Format("20060102_150405")
+	dst, err := os.CreateTemp(dir, timestamp+"_*_"+filepath.Base(name))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, r); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
+
+// inputNames returns the base names of input files in alias order, for logs and reports
+func inputNames(inputs map[string]string) string {
+	aliases := make([]string, 0, len(inputs))
+	for alias := range inputs {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	names := make([]string, len(aliases))
+	for i, alias := range aliases {
+		names[i] = filepath.Base(inputs[alias])
+		if alias != "" {
+			names[i] = alias + "=" + names[i]
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ex2ex/transform"
+)
+
+// testArchive writes a zip archive with the entries in order and returns its path.
+// Names ending with a slash are directories.
+func testArchive(t *testing.T, entries ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "inputs.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	archive := zip.NewWriter(f)
+	for _, name := range entries {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		if _, err := w.Write([]byte("data of " + name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testInputsConfig() *transform.Config {
+	return &transform.Config{
+		OutputFilename: "out.xlsx",
+		Inputs: map[string]transform.Input{
+			"jan": {},
+			"feb": {File: "*feb*.xlsx"},
+			"mar": {Optional: true},
+		},
+		Mappings: []transform.Mapping{
+			{Source: "Sheet1!A1", Destination: "Sheet1!A1"},
+			{Source: "jan:Sheet1!A1:A", Destination: "Sheet1!A2"},
+			{Source: "feb:Sheet1!A1:A", Destination: "Sheet1!B2"},
+			{Source: "mar:Sheet1!A1:A", Destination: "Sheet1!C2"},
+		},
+	}
+}
+
+func TestResolveInputs(t *testing.T) {
+	dir := t.TempDir()
+	archive := testArchive(t, "q1/Sales feb.xlsx", "q1/", "q1/jan.xlsx", "notes.txt", ".jan.xlsx", "q1/~$jan.xlsx")
+	inputs, err := resolveInputs([]inputFile{
+		{field: "file", name: "summary.xlsx", path: "/uploads/summary.xlsx"},
+		{field: "file", name: "q1.ZIP", path: archive},
+	}, testInputsConfig(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	for alias, path := range inputs {
+		if alias == "" {
+			got[alias] = path
+			continue
+		}
+		if filepath.Dir(path) != dir {
+			t.Errorf("input %s extracted to %s, want a file in %s", alias, path, dir)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[alias] = string(data)
+	}
+	want := map[string]string{"": "/uploads/summary.xlsx", "jan": "data of q1/jan.xlsx", "feb": "data of q1/Sales feb.xlsx"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("inputs = %q, want %q", got, want)
+	}
+}
+
+func TestResolveInputsErrors(t *testing.T) {
+	entries := make([]string, maxArchiveEntries+1)
+	for i := range entries {
+		entries[i] = "book" + strings.Repeat("x", i) + ".xlsx"
+	}
+
+	tests := []struct {
+		name    string
+		files   []inputFile
+		wantErr string
+	}{
+		{
+			"missing input",
+			[]inputFile{{field: "file", name: "summary.xlsx"}, {field: "file", name: "jan.xlsx"}},
+			"missing required input feb",
+		},
+		{
+			"input given twice",
+			[]inputFile{{field: "file", name: "jan.xlsx"}, {field: "jan", name: "other.xlsx"}},
+			"several files given for input jan",
+		},
+		{
+			"two default inputs",
+			[]inputFile{{field: "file", name: "a.xlsx"}, {field: "file", name: "b.xlsx"}},
+			"file b.xlsx does not match any input",
+		},
+		{
+			"archive without workbooks",
+			[]inputFile{{field: "file", name: "q1.zip", path: testArchive(t, "notes.txt", "~$jan.xlsx")}},
+			"failed to extract q1.zip: no .xlsx, .xls, .ods, .csv or .tsv files found",
+		},
+		{
+			"too many archive entries",
+			[]inputFile{{field: "file", name: "q1.zip", path: testArchive(t, entries...)}},
+			"failed to extract q1.zip: too many files, at most 100 are allowed",
+		},
+		{
+			"broken archive",
+			[]inputFile{{field: "file", name: "q1.zip", path: filepath.Join(t.TempDir(), "missing.zip")}},
+			"failed to extract q1.zip: ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveInputs(tt.files, testInputsConfig(), t.TempDir())
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("resolveInputs() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveSizeLimit(t *testing.T) {
+	saved := maxInputSize
+	defer func() { maxInputSize = saved }()
+	maxInputSize = int64(len("data of jan.xlsx"))
+
+	dir := t.TempDir()
+	if files, err := extractArchive(testArchive(t, "jan.xlsx"), dir); err != nil || len(files) != 1 {
+		t.Fatalf("extractArchive() = %v, %v, want the file at the size limit", files, err)
+	}
+	_, err := extractArchive(testArchive(t, "feb.xlsx", "janu.xlsx"), dir)
+	if err == nil || err.Error() != "janu.xlsx exceeds maximum size of 100 MB" {
+		t.Errorf("extractArchive() error = %v", err)
+	}
+
+	// The oversized file is removed, only the extracted files stay
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("files left = %d, want 2", len(entries))
+	}
+}
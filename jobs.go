@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ex2ex/transform"
+)
+
+// Job states reported by the jobs API
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+// jobRetention is how long finished jobs stay available through the jobs API
+const jobRetention = 24 * time.Hour
+
+var (
+	errJobNotFound = errors.New("job not found")
+	errJobFinished = errors.New("job has already finished")
+	errQueueFull   = errors.New("job queue is full, try again later")
+)
+
+// MappingProgress is the completion percentage of a single mapping
+type MappingProgress struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Percent     int    `json:"percent"`
+}
+
+// JobStatus is the state of a job returned by the jobs API
+type JobStatus struct {
+	ID          string                      `json:"id"`
+	State       string                      `json:"state"`
+	Profile     string                      `json:"profile,omitempty"`
+	Percent     int                         `json:"percent"`
+	Mappings    []MappingProgress           `json:"mappings"`
+	Report      *transform.ProcessingReport `json:"report,omitempty"`
+	DownloadURL string                      `json:"download_url,omitempty"`
+	Error       string                      `json:"error,omitempty"`
+	CreatedAt   time.Time                   `json:"created_at"`
+	StartedAt   *time.Time                  `json:"started_at,omitempty"`
+	FinishedAt  *time.Time                  `json:"finished_at,omitempty"`
+}
+
+// job is a transformation waiting in the queue or being processed by a worker
+type job struct {
+	mu     sync.Mutex
+	status JobStatus
+	// owner is the user who submitted the job, only they and admins can see it
+	owner  string
+	inputs map[string]string
+	config *transform.Config
+	// password opens encrypted input files, it is never reported
+	password string
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// JobQueue runs transformations in the background on a bounded pool of workers
+type JobQueue struct {
+	mu    sync.Mutex
+	jobs  map[string]*job
+	queue chan *job
+}
+
+// NewJobQueue starts workers goroutines that process up to size queued jobs
+func NewJobQueue(workers, size int) *JobQueue {
+	q := &JobQueue{
+		jobs:  make(map[string]*job),
+		queue: make(chan *job, size),
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+// Submit queues the transformation of uploaded files, given by input alias, for the owner.
+// Encrypted files are opened with password, if it is not empty.
+func (q *JobQueue) Submit(inputs map[string]string, config *transform.Config, profile, password, owner string) (JobStatus, error) {
+	id, err := newJobID()
+	if err != nil {
+		return JobStatus{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		status: JobStatus{
+			ID:        id,
+			State:     jobQueued,
+			Profile:   profile,
+			Mappings:  make([]MappingProgress, len(config.Mappings)),
+			CreatedAt: time.Now(),
+		},
+		owner:    owner,
+		inputs:   inputs,
+		config:   config,
+		password: password,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for i, m := range config.Mappings {
+		j.status.Mappings[i] = MappingProgress{Source: m.Source, Destination: m.Destination}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+
+	select {
+	case q.queue <- j:
+	default:
+		cancel()
+		return JobStatus{}, errQueueFull
+	}
+	q.jobs[id] = j
+
+	return j.snapshot(), nil
+}
+
+// find returns a job of the user. Jobs of other users are not found,
+// an empty user finds every job.
+func (q *JobQueue) find(id, user string) (*job, error) {
+	q.mu.Lock()
+	j, ok := q.jobs[id]
+	q.mu.Unlock()
+	if !ok || (user != "" && j.owner != user) {
+		return nil, errJobNotFound
+	}
+	return j, nil
+}
+
+// Get returns the current state of a job of the user, or of any job if user is empty
+func (q *JobQueue) Get(id, user string) (JobStatus, error) {
+	j, err := q.find(id, user)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	return j.snapshot(), nil
+}
+
+// Cancel stops a queued or running job of the user, or any job if user is empty
+func (q *JobQueue) Cancel(id, user string) (JobStatus, error) {
+	j, err := q.find(id, user)
+	if err != nil {
+		return JobStatus{}, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch j.status.State {
+	case jobQueued:
+		// The worker skips canceled jobs
+		j.finish(jobCanceled)
+	case jobRunning:
+		// The worker marks the job canceled when processing stops
+	default:
+		return j.status, errJobFinished
+	}
+	j.cancel()
+
+	return j.status, nil
+}
+
+// prune forgets jobs that finished more than jobRetention ago, their files are removed by the cleanup routine
+func (q *JobQueue) prune() {
+	for id, j := range q.jobs {
+		j.mu.Lock()
+		expired := j.status.FinishedAt != nil && time.Since(*j.status.FinishedAt) > jobRetention
+		j.mu.Unlock()
+		if expired {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func (q *JobQueue) worker() {
+	for j := range q.queue {
+		j.run()
+	}
+}
+
+func (j *job) run() {
+	j.mu.Lock()
+	if j.status.State != jobQueued {
+		j.mu.Unlock()
+		return
+	}
+	j.status.State = jobRunning
+	now := time.Now()
+	j.status.StartedAt = &now
+	j.mu.Unlock()
+
+	log.Printf("Job %s started: %s", j.status.ID, inputNames(j.inputs))
+	outputFilePath, report, err := processExcel(j.ctx, j.inputs, j.config, j.password, j.setProgress)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// A job canceled after processing finished keeps its result
+	switch {
+	case errors.Is(err, context.Canceled):
+		j.finish(jobCanceled)
+	case err != nil:
+		j.status.Error = err.Error()
+		j.finish(jobFailed)
+	default:
+		j.status.Report = report
+		j.status.DownloadURL = "/download/" + filepath.Base(outputFilePath)
+		j.finish(jobDone)
+	}
+	j.cancel()
+	log.Printf("Job %s %s", j.status.ID, j.status.State)
+}
+
+// setProgress is the progressFunc of the job
+func (j *job) setProgress(mapping, percent int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.status.Mappings[mapping].Percent == percent {
+		return
+	}
+	j.status.Mappings[mapping].Percent = percent
+
+	total := 0
+	for _, m := range j.status.Mappings {
+		total += m.Percent
+	}
+	j.status.Percent = total / len(j.status.Mappings)
+}
+
+// finish sets the final state of the job. The caller must hold j.mu.
+func (j *job) finish(state string) {
+	now := time.Now()
+	j.status.State = state
+	j.status.FinishedAt = &now
+	if state == jobDone {
+		j.status.Percent = 100
+	}
+}
+
+func (j *job) snapshot() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := j.status
+	status.Mappings = append([]MappingProgress(nil), j.status.Mappings...)
+	return status
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// jobsAPIHandler serves /api/jobs (submit) and /api/jobs/{id} (status, cancel).
+// Operators see their own jobs, admins see every job.
+func jobsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs"), "/")
+	user, role := requestUser(r)
+
+	if id == "" {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		inputs, config, ok := receiveUpload(w, r)
+		if !ok {
+			return
+		}
+
+		status, err := jobQueue.Submit(inputs, config, r.FormValue("profile"), r.FormValue("password"), user)
+		if err != nil {
+			sendJobError(w, err)
+			return
+		}
+		log.Printf("Job %s queued: %s", status.ID, inputNames(inputs))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/jobs/"+status.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	if role == roleAdmin {
+		user = ""
+	}
+	var status JobStatus
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		status, err = jobQueue.Get(id, user)
+	case http.MethodDelete:
+		status, err = jobQueue.Cancel(id, user)
+	default:
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		sendJobError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// sendJobError maps job queue errors to HTTP status codes
+func sendJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errJobNotFound):
+		sendError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errJobFinished):
+		sendError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errQueueFull):
+		sendError(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		sendError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
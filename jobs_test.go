@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ex2ex/transform"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// testJobConfig copies A1 of the source to the output, once per mapping
+func testJobConfig(mappings int) *transform.Config {
+	config := &transform.Config{OutputFilename: "out.xlsx"}
+	for i := 0; i < mappings; i++ {
+		config.Mappings = append(config.Mappings, transform.Mapping{Source: "Sheet1!A1", Destination: "Sheet1!A1"})
+	}
+	return config
+}
+
+// waitJob polls a job until it has finished
+func waitJob(t *testing.T, q *JobQueue, id string) JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status, err := q.Get(id, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.FinishedAt != nil {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s did not finish, state %s", id, status.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobQueueRun(t *testing.T) {
+	saved := outputDir
+	defer func() { outputDir = saved }()
+	outputDir = t.TempDir()
+
+	input := excelize.NewFile()
+	defer input.Close()
+	input.SetCellValue("Sheet1", "A1", "value")
+	path := filepath.Join(t.TempDir(), "input.xlsx")
+	if err := input.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewJobQueue(1, 2)
+	status, err := q.Submit(map[string]string{"": path}, testJobConfig(2), "daily", "", "op")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != jobQueued || status.Profile != "daily" || len(status.Mappings) != 2 {
+		t.Errorf("submitted job = %+v, want a queued job with 2 mappings", status)
+	}
+
+	status = waitJob(t, q, status.ID)
+	if status.State != jobDone || status.Percent != 100 || status.Report == nil || status.StartedAt == nil {
+		t.Fatalf("finished job = %+v, want done", status)
+	}
+	if !strings.HasPrefix(status.DownloadURL, "/download/") || !strings.HasSuffix(status.DownloadURL, "_out.xlsx") {
+		t.Errorf("download URL = %q", status.DownloadURL)
+	}
+
+	// A job that cannot be processed fails with the error
+	status, err = q.Submit(map[string]string{"": filepath.Join(t.TempDir(), "missing.xlsx")}, testJobConfig(1), "", "", "op")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status = waitJob(t, q, status.ID); status.State != jobFailed || status.Error == "" {
+		t.Errorf("job of a missing file = %+v, want failed with an error", status)
+	}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	// Without workers the jobs stay queued
+	q := NewJobQueue(0, 1)
+	if _, err := q.Submit(nil, testJobConfig(1), "", "", "op"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := q.Submit(nil, testJobConfig(1), "", "", "op")
+	if !errors.Is(err, errQueueFull) {
+		t.Fatalf("Submit() error = %v, want %v", err, errQueueFull)
+	}
+	if len(q.jobs) != 1 {
+		t.Errorf("jobs = %d, want the rejected job forgotten", len(q.jobs))
+	}
+
+	w := httptest.NewRecorder()
+	sendJobError(w, err)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestJobQueueCancel(t *testing.T) {
+	q := NewJobQueue(0, 1)
+	queued, err := q.Submit(nil, testJobConfig(1), "", "", "op")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A queued job is canceled at once
+	status, err := q.Cancel(queued.ID, "op")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != jobCanceled || status.FinishedAt == nil {
+		t.Errorf("canceled queued job = %+v", status)
+	}
+	if _, err := q.Cancel(queued.ID, "op"); !errors.Is(err, errJobFinished) {
+		t.Errorf("second Cancel() error = %v, want %v", err, errJobFinished)
+	}
+
+	// A running job is marked canceled by its worker once processing stops
+	ctx, cancel := context.WithCancel(context.Background())
+	running := &job{status: JobStatus{ID: "running", State: jobRunning}, owner: "op", ctx: ctx, cancel: cancel}
+	q.jobs[running.status.ID] = running
+	if status, err = q.Cancel("running", "op"); err != nil {
+		t.Fatal(err)
+	}
+	if status.State != jobRunning || ctx.Err() == nil {
+		t.Errorf("canceled running job state = %s, context error = %v, want running with a canceled context", status.State, ctx.Err())
+	}
+	if _, err := q.Cancel("missing", ""); !errors.Is(err, errJobNotFound) {
+		t.Errorf("Cancel() of a missing job error = %v, want %v", err, errJobNotFound)
+	}
+}
+
+func TestJobProgress(t *testing.T) {
+	j := &job{status: JobStatus{Mappings: make([]MappingProgress, 3)}}
+	steps := []struct {
+		mapping, percent int
+		want             int
+	}{
+		{0, 100, 33},
+		{1, 50, 50},
+		{1, 50, 50},
+		{2, 10, 53},
+	}
+	for _, step := range steps {
+		j.setProgress(step.mapping, step.percent)
+		if j.status.Percent != step.want {
+			t.Errorf("after mapping %d at %d%%: percent = %d, want %d", step.mapping, step.percent, j.status.Percent, step.want)
+		}
+	}
+	if snapshot := j.snapshot(); snapshot.Mappings[1].Percent != 50 {
+		t.Errorf("snapshot mappings = %+v", snapshot.Mappings)
+	}
+}
+
+func TestJobQueuePrune(t *testing.T) {
+	q := NewJobQueue(0, 1)
+	old, recent := time.Now().Add(-jobRetention-time.Minute), time.Now().Add(-time.Minute)
+	q.jobs["old"] = &job{status: JobStatus{State: jobDone, FinishedAt: &old}}
+	q.jobs["recent"] = &job{status: JobStatus{State: jobDone, FinishedAt: &recent}}
+	q.jobs["running"] = &job{status: JobStatus{State: jobRunning}}
+	q.prune()
+	if _, ok := q.jobs["old"]; ok || len(q.jobs) != 2 {
+		t.Errorf("jobs after prune = %v, want recent and running", q.jobs)
+	}
+}
+
+func TestJobsAPIOwner(t *testing.T) {
+	saved := jobQueue
+	defer func() { jobQueue = saved }()
+	jobQueue = NewJobQueue(0, 10)
+	auth := testAuthenticator(t)
+	handler := auth.require(roleOperator, jobsAPIHandler)
+
+	submit := func() string {
+		status, err := jobQueue.Submit(nil, testJobConfig(1), "", "", "op")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status.ID
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		user   string
+		token  string
+		want   int
+	}{
+		{"owner reads", http.MethodGet, "op:pass", "", http.StatusOK},
+		{"admin reads", http.MethodGet, "boss:pass", "", http.StatusOK},
+		{"other operator reads", http.MethodGet, "", testToken, http.StatusNotFound},
+		{"other operator cancels", http.MethodDelete, "", testToken, http.StatusNotFound},
+		{"owner cancels", http.MethodDelete, "op:pass", "", http.StatusOK},
+		{"admin cancels", http.MethodDelete, "boss:pass", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := submit()
+			w := httptest.NewRecorder()
+			handler(w, testRequest(tt.method, "/api/jobs/"+id, tt.user, tt.token))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var status JobStatus
+			if err := json.NewDecoder(w.Body).Decode(&status); err != nil || status.ID != id {
+				t.Errorf("response = %+v, %v, want job %s", status, err, id)
+			}
+		})
+	}
+}
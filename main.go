@@ -1,83 +1,47 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/xuri/excelize/v2"
+	"ex2ex/transform"
 	"gopkg.in/yaml.v3"
 )
 
-type Config struct {
-	OutputFilename string        `yaml:"output_filename" json:"output_filename"`
-	Mappings       []Mapping     `yaml:"mappings" json:"mappings"`
-	OutputSheets   []OutputSheet `yaml:"output_sheets" json:"output_sheets"`
-}
-
-type Mapping struct {
-	Source       string `yaml:"source" json:"source"`
-	Destination  string `yaml:"destination" json:"destination"`
-	FilterColumn string `yaml:"filter_column,omitempty" json:"filter_column,omitempty"`
-	FilterMask   string `yaml:"filter_mask,omitempty" json:"filter_mask,omitempty"`
-}
-
-type OutputSheet struct {
-	Name              string `yaml:"name" json:"name"`
-	CreateIfNotExists bool   `yaml:"create_if_not_exists" json:"create_if_not_exists"`
-}
-
 type Response struct {
-	Success     bool   `json:"success"`
-	DownloadURL string `json:"download_url,omitempty"`
-	Error       string `json:"error,omitempty"`
-}
-
-// Validate checks if the configuration is valid
-func (c *Config) Validate() error {
-	if c.OutputFilename == "" {
-		return fmt.Errorf("output_filename is required")
-	}
-
-	if len(c.Mappings) == 0 {
-		return fmt.Errorf("at least one mapping is required")
-	}
-
-	for i, m := range c.Mappings {
-		if m.Source == "" {
-			return fmt.Errorf("mapping %d: source is required", i)
-		}
-		if m.Destination == "" {
-			return fmt.Errorf("mapping %d: destination is required", i)
-		}
-	}
-
-	for i, sheet := range c.OutputSheets {
-		if sheet.CreateIfNotExists {
-			if err := validateSheetName(sheet.Name); err != nil {
-				return fmt.Errorf("output_sheet %d: %w", i, err)
-			}
-		}
-	}
-
-	return nil
+	Success     bool                        `json:"success"`
+	DownloadURL string                      `json:"download_url,omitempty"`
+	Report      *transform.ProcessingReport `json:"report,omitempty"`
+	Error       string                      `json:"error,omitempty"`
 }
 
 var (
 	uploadDir     string
 	outputDir     string
 	configFile    string
+	profilesDir   string
+	lookupDir     string
+	usersFile     string
+	noAuth        bool
+	corsOrigins   []string
 	port          string
 	configMutex   sync.RWMutex
-	cachedConfig  *Config
+	cachedConfig  *transform.Config
 	configLastMod time.Time
+	profileStore  *ProfileStore
+	jobQueue      *JobQueue
 )
 
 func init() {
@@ -85,11 +49,13 @@ func init() {
 	uploadDir = getEnv("UPLOAD_DIR", "./uploads")
 	outputDir = getEnv("OUTPUT_DIR", "./output")
 	configFile = getEnv("CONFIG_FILE", "./config.yaml")
+	profilesDir = getEnv("PROFILES_DIR", "./profiles")
+	lookupDir = getEnv("LOOKUP_DIR", "./lookups")
+	usersFile = getEnv("USERS_FILE", "")
+	corsOrigins = parseOrigins(getEnv("CORS_ORIGINS", ""))
 	port = getEnv("PORT", "8080")
 
-	// Create directories if they don't exist
-	os.MkdirAll(uploadDir, 0755)
-	os.MkdirAll(outputDir, 0755)
+	profileStore = NewProfileStore(configFile, profilesDir)
 }
 
 func getEnv(key, defaultValue string) string {
@@ -99,15 +65,48 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
 func main() {
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+// serve starts the web server
+func serve() {
+	profileStore = NewProfileStore(configFile, profilesDir)
+	jobQueue = NewJobQueue(getEnvInt("JOB_WORKERS", 2), getEnvInt("JOB_QUEUE_SIZE", 100))
+
+	// Sign-in is required unless it is turned off explicitly
+	var auth *Authenticator
+	if usersFile != "" || !noAuth {
+		var err error
+		if auth, err = NewAuthenticator(usersFile); err != nil {
+			log.Fatalf("Failed to start: %v", err)
+		}
+	}
+
+	// Create directories if they don't exist
+	os.MkdirAll(uploadDir, 0755)
+	os.MkdirAll(outputDir, 0755)
+
 	// Create logging middleware
 	loggedMux := http.NewServeMux()
 
-	loggedMux.HandleFunc("/", indexHandler)
-	loggedMux.HandleFunc("/admin", adminHandler)
-	loggedMux.HandleFunc("/upload", uploadHandler)
-	loggedMux.HandleFunc("/download/", downloadHandler)
-	loggedMux.HandleFunc("/api/config", configAPIHandler)
+	// Operators upload and download files, admins also manage the configuration
+	loggedMux.HandleFunc("/", auth.require(roleOperator, indexHandler))
+	loggedMux.HandleFunc("/admin", auth.require(roleAdmin, adminHandler))
+	loggedMux.HandleFunc("/upload", auth.require(roleOperator, uploadHandler))
+	loggedMux.HandleFunc("/download/", auth.require(roleOperator, downloadHandler))
+	loggedMux.HandleFunc("/api/jobs", auth.require(roleOperator, jobsAPIHandler))
+	loggedMux.HandleFunc("/api/jobs/", auth.require(roleOperator, jobsAPIHandler))
+	loggedMux.HandleFunc("/api/config", auth.require(roleAdmin, configAPIHandler))
+	loggedMux.HandleFunc("/api/config/profiles", auth.profilesAccess(profilesAPIHandler))
+	loggedMux.HandleFunc("/api/config/profiles/", auth.profilesAccess(profilesAPIHandler))
 
 	// Wrap with logging
 	handler := loggingMiddleware(loggedMux)
@@ -120,6 +119,12 @@ func main() {
 	log.Printf("Open http://localhost:%s in your browser", port)
 	log.Printf("Admin panel: http://localhost:%s/admin", port)
 	log.Printf("Config file: %s", configFile)
+	log.Printf("Profiles directory: %s", profilesDir)
+	if auth == nil {
+		log.Printf("Warning: authentication is disabled by -insecure-no-auth, the server is open to everyone")
+	} else {
+		log.Printf("Users file: %s", usersFile)
+	}
 
 	if err := http.ListenAndServe(":"+port, handler); err != nil {
 		log.Fatal(err)
@@ -134,24 +139,24 @@ func loggingMiddleware(next http.Handler) http.Handler {
 }
 
 func indexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 	http.ServeFile(w, r, "./templates/index.html")
 }
 
 func adminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 	http.ServeFile(w, r, "./templates/admin.html")
 }
 
 func configAPIHandler(w http.ResponseWriter, r *http.Request) {
-	// Enable CORS
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	// Handle preflight request
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+	// Enable CORS for the configured origins
+	setCORS(w, r, "GET, POST, OPTIONS")
 
 	switch r.Method {
 	case http.MethodGet:
@@ -177,7 +182,7 @@ func configAPIHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Saving configuration to: %s", configFile)
 
 		// Save configuration
-		var config Config
+		var config transform.Config
 		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
 			log.Printf("Error decoding JSON: %v", err)
 			sendError(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
@@ -223,61 +228,104 @@ func configAPIHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func uploadHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// profilesAPIHandler serves /api/config/profiles (list) and /api/config/profiles/{name} (get, save, delete)
+func profilesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	// Enable CORS for the configured origins
+	setCORS(w, r, "GET, POST, PUT, DELETE, OPTIONS")
 
-	// Set max upload size limit (100 MB)
-	maxUploadSize := int64(100 << 20)
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/config/profiles"), "/")
 
-	// Parse multipart form
-	err := r.ParseMultipartForm(maxUploadSize)
-	if err != nil {
-		if err.Error() == "http: request body too large" {
-			sendError(w, "File size exceeds maximum limit of 100 MB", http.StatusBadRequest)
-		} else {
-			sendError(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+	if name == "" {
+		if r.Method != http.MethodGet {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
-		return
-	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		sendError(w, "Failed to get file: "+err.Error(), http.StatusBadRequest)
+		profiles, err := profileStore.List()
+		if err != nil {
+			log.Printf("Error listing profiles: %v", err)
+			sendError(w, "Failed to list profiles: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profiles)
 		return
 	}
-	defer file.Close()
 
-	// Validate file extension
-	ext := filepath.Ext(header.Filename)
-	if ext != ".xlsx" && ext != ".xls" {
-		sendError(w, "Invalid file type. Only .xlsx and .xls files are allowed", http.StatusBadRequest)
-		return
+	switch r.Method {
+	case http.MethodGet:
+		config, err := profileStore.Get(name)
+		if err != nil {
+			sendProfileError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(config)
+
+	case http.MethodPost, http.MethodPut:
+		var config transform.Config
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			sendError(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := profileStore.Save(name, &config); err != nil {
+			sendProfileError(w, err)
+			return
+		}
+		log.Printf("Profile %s saved: filename=%s, mappings=%d", name, config.OutputFilename, len(config.Mappings))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{Success: true})
+
+	case http.MethodDelete:
+		if err := profileStore.Delete(name); err != nil {
+			sendProfileError(w, err)
+			return
+		}
+		log.Printf("Profile %s deleted", name)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{Success: true})
+
+	default:
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
+}
 
-	// Save uploaded file
-	timestamp := time.Now().Format("20060102_150405")
-	uploadedFilePath := filepath.Join(uploadDir, timestamp+"_"+header.Filename)
+// sendProfileError maps profile store errors to HTTP status codes
+func sendProfileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errProfileNotFound):
+		sendError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errProfileReadOnly):
+		sendError(w, err.Error(), http.StatusConflict)
+	default:
+		sendError(w, err.Error(), http.StatusBadRequest)
+	}
+}
 
-	dst, err := os.Create(uploadedFilePath)
-	if err != nil {
-		sendError(w, "Failed to save file: "+err.Error(), http.StatusInternalServerError)
+func uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		sendError(w, "Failed to save file: "+err.Error(), http.StatusInternalServerError)
+	inputs, config, ok := receiveUpload(w, r)
+	if !ok {
 		return
 	}
 
-	// Process the Excel file
-	outputFilePath, err := processExcel(uploadedFilePath)
+	// Process the Excel files, encrypted files are opened with the password of the form
+	outputFilePath, report, err := processExcel(r.Context(), inputs, config, r.FormValue("password"), nil)
 	if err != nil {
-		sendError(w, "Failed to process Excel file: "+err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, transform.ErrPasswordRequired) || errors.Is(err, transform.ErrWrongPassword) {
+			status = http.StatusBadRequest
+		}
+		sendError(w, "Failed to process Excel file: "+err.Error(), status)
 		return
 	}
 
@@ -288,409 +336,216 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	response := Response{
 		Success:     true,
 		DownloadURL: downloadURL,
+		Report:      report,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func downloadHandler(w http.ResponseWriter, r *http.Request) {
-	filename := filepath.Base(r.URL.Path)
-	filePath := filepath.Join(outputDir, filename)
-
-	// Security: prevent path traversal attacks
-	if !isPathSafe(filePath, outputDir) {
-		http.NotFound(w, r)
-		return
-	}
-
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		http.NotFound(w, r)
-		return
-	}
-
-	// Set headers for download
-	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
-	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-
-	// Serve file
-	http.ServeFile(w, r, filePath)
-}
-
-func processExcel(inputFilePath string) (string, error) {
-	// Load configuration
-	config, err := loadConfig(configFile)
-	if err != nil {
-		return "", fmt.Errorf("failed to load config: %w", err)
-	}
+// receiveUpload selects the transformation profile and saves the uploaded files by input alias.
+// On failure it sends the error response and returns false.
+func receiveUpload(w http.ResponseWriter, r *http.Request) (map[string]string, *transform.Config, bool) {
+	// Set max upload size limit (100 MB)
+	maxUploadSize := int64(100 << 20)
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
 
-	// Open source Excel file
-	sourceFile, err := excelize.OpenFile(inputFilePath)
+	// Parse multipart form
+	err := r.ParseMultipartForm(maxUploadSize)
 	if err != nil {
-		return "", fmt.Errorf("failed to open source file: %w", err)
-	}
-	defer sourceFile.Close()
-
-	// Check if template file exists in templates folder
-	templatePath := filepath.Join("./templates", config.OutputFilename)
-	var destFile *excelize.File
-
-	if _, err := os.Stat(templatePath); err == nil {
-		// Template exists - use it as base
-		log.Printf("Using template file: %s", templatePath)
-		destFile, err = excelize.OpenFile(templatePath)
-		if err != nil {
-			return "", fmt.Errorf("failed to open template file: %w", err)
-		}
-	} else {
-		// No template - create new file
-		log.Printf("No template found, creating new file")
-		destFile = excelize.NewFile()
-
-		// Create output sheets if needed
-		for _, sheet := range config.OutputSheets {
-			if sheet.CreateIfNotExists {
-				// Validate sheet name
-				if err := validateSheetName(sheet.Name); err != nil {
-					return "", fmt.Errorf("invalid sheet name: %w", err)
-				}
-
-				index, err := destFile.NewSheet(sheet.Name)
-				if err != nil {
-					return "", fmt.Errorf("failed to create sheet %s: %w", sheet.Name, err)
-				}
-				// Set as active sheet if it's the first one
-				if index == 1 {
-					destFile.SetActiveSheet(index)
-				}
-			}
-		}
-
-		// Delete default Sheet1 if we created custom sheets
-		if len(config.OutputSheets) > 0 {
-			destFile.DeleteSheet("Sheet1")
-		}
-	}
-	defer destFile.Close()
-
-	// Apply mappings
-	for _, mapping := range config.Mappings {
-		if err := applyMapping(sourceFile, destFile, mapping); err != nil {
-			log.Printf("Warning: failed to apply mapping %s -> %s: %v",
-				mapping.Source, mapping.Destination, err)
-			// Continue with other mappings even if one fails
+		if err.Error() == "http: request body too large" {
+			sendError(w, "File size exceeds maximum limit of 100 MB", http.StatusBadRequest)
+		} else {
+			sendError(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
 		}
+		return nil, nil, false
 	}
-
-	// Save output file
-	timestamp := time.Now().Format("20060102_150405")
-	outputFilePath := filepath.Join(outputDir, timestamp+"_"+config.OutputFilename)
-
-	if err := destFile.SaveAs(outputFilePath); err != nil {
-		return "", fmt.Errorf("failed to save output file: %w", err)
+	if len(r.MultipartForm.File) == 0 {
+		sendError(w, "Failed to get file: no file uploaded", http.StatusBadRequest)
+		return nil, nil, false
 	}
 
-	return outputFilePath, nil
-}
-
-func applyMapping(sourceFile, destFile *excelize.File, mapping Mapping) error {
-	// Parse source (sheet!cell or sheet!range)
-	sourceSheet, sourceRange := parseReference(mapping.Source)
-	destSheet, destCell := parseReference(mapping.Destination)
-
-	// Check if source is a range or single cell
-	if isRange(sourceRange) {
-		return copyRange(sourceFile, destFile, sourceSheet, sourceRange, destSheet, destCell, mapping.FilterColumn, mapping.FilterMask)
-	}
-	return copyCellValue(sourceFile, destFile, sourceSheet, sourceRange, destSheet, destCell)
-}
-
-// parseFloat attempts to parse a string as a float64
-func parseFloat(s string) (float64, error) {
-	return strconv.ParseFloat(s, 64)
-}
-
-func copyCellValue(sourceFile, destFile *excelize.File, sourceSheet, sourceCell, destSheet, destCell string) error {
-	// Get cell type
-	cellType, err := sourceFile.GetCellType(sourceSheet, sourceCell)
+	// Select transformation profile (default profile if not specified)
+	profileName := r.FormValue("profile")
+	config, err := profileStore.Get(profileName)
 	if err != nil {
-		return fmt.Errorf("failed to get cell type: %w", err)
-	}
-
-	// Copy value based on type
-	switch cellType {
-	case excelize.CellTypeNumber:
-		// Get as float to preserve number type
-		floatValue, err := sourceFile.GetCellValue(sourceSheet, sourceCell)
-		if err != nil {
-			return fmt.Errorf("failed to get cell value: %w", err)
-		}
-		// Try to parse as float
-		if numValue, err := parseFloat(floatValue); err == nil {
-			if err := destFile.SetCellFloat(destSheet, destCell, numValue, -1, 64); err != nil {
-				return fmt.Errorf("failed to set cell float: %w", err)
-			}
+		if errors.Is(err, errProfileNotFound) {
+			sendError(w, "Unknown profile: "+profileName, http.StatusBadRequest)
 		} else {
-			// Fallback to string if parsing fails
-			if err := destFile.SetCellValue(destSheet, destCell, floatValue); err != nil {
-				return fmt.Errorf("failed to set cell value: %w", err)
-			}
+			sendError(w, "Failed to load config: "+err.Error(), http.StatusInternalServerError)
 		}
+		return nil, nil, false
+	}
 
-	case excelize.CellTypeBool:
-		// Get as bool
-		boolValue, err := sourceFile.GetCellValue(sourceSheet, sourceCell)
-		if err != nil {
-			return fmt.Errorf("failed to get cell value: %w", err)
+	// The output format of the profile can be replaced for a single request
+	if format := r.FormValue("output_format"); format != "" {
+		if err := transform.ValidateOutputFormat(format); err != nil {
+			sendError(w, "Invalid output format: "+err.Error(), http.StatusBadRequest)
+			return nil, nil, false
 		}
-		if err := destFile.SetCellValue(destSheet, destCell, boolValue == "TRUE" || boolValue == "true" || boolValue == "1"); err != nil {
-			return fmt.Errorf("failed to set cell bool: %w", err)
+		profile := *config
+		profile.OutputFormat = format
+		if err := profile.Validate(); err != nil {
+			sendError(w, "Invalid output format: "+err.Error(), http.StatusBadRequest)
+			return nil, nil, false
 		}
+		config = &profile
+	}
 
-	case excelize.CellTypeFormula:
-		// Get formula
-		formula, err := sourceFile.GetCellFormula(sourceSheet, sourceCell)
-		if err == nil && formula != "" {
-			if err := destFile.SetCellFormula(destSheet, destCell, formula); err != nil {
-				return fmt.Errorf("failed to set cell formula: %w", err)
-			}
-		} else {
-			// Fallback to calculated value
-			value, _ := sourceFile.GetCellValue(sourceSheet, sourceCell)
-			if numValue, err := parseFloat(value); err == nil {
-				destFile.SetCellFloat(destSheet, destCell, numValue, -1, 64)
-			} else {
-				destFile.SetCellValue(destSheet, destCell, value)
+	// Save uploaded files. A file uploaded in a field named after an input is that input,
+	// other files are matched by name.
+	fields := make([]string, 0, len(r.MultipartForm.File))
+	for field := range r.MultipartForm.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var files []inputFile
+	for _, field := range fields {
+		for _, header := range r.MultipartForm.File[field] {
+			ext := strings.ToLower(filepath.Ext(header.Filename))
+			if !isInputFile(header.Filename) && ext != ".zip" {
+				sendError(w, "Invalid file type. Only .xlsx, .xls, .ods, .csv, .tsv and .zip files are allowed", http.StatusBadRequest)
+				return nil, nil, false
 			}
-		}
 
-	default:
-		// String or other types
-		value, err := sourceFile.GetCellValue(sourceSheet, sourceCell)
-		if err != nil {
-			return fmt.Errorf("failed to get cell value: %w", err)
-		}
-		// Try to detect if it's actually a number
-		if numValue, err := parseFloat(value); err == nil && value != "" {
-			if err := destFile.SetCellFloat(destSheet, destCell, numValue, -1, 64); err != nil {
-				return fmt.Errorf("failed to set cell float: %w", err)
+			file, err := header.Open()
+			if err != nil {
+				sendError(w, "Failed to get file: "+err.Error(), http.StatusBadRequest)
+				return nil, nil, false
 			}
-		} else {
-			if err := destFile.SetCellValue(destSheet, destCell, value); err != nil {
-				return fmt.Errorf("failed to set cell value: %w", err)
+			path, err := saveFile(uploadDir, header.Filename, file)
+			file.Close()
+			if err != nil {
+				sendError(w, "Failed to save file: "+err.Error(), http.StatusInternalServerError)
+				return nil, nil, false
 			}
+			files = append(files, inputFile{field: field, name: header.Filename, path: path})
 		}
 	}
 
-	// Copy cell style if possible
-	styleID, err := sourceFile.GetCellStyle(sourceSheet, sourceCell)
-	if err == nil && styleID != 0 {
-		destFile.SetCellStyle(destSheet, destCell, destCell, styleID)
+	inputs, err := resolveInputs(files, config, uploadDir)
+	if err != nil {
+		sendError(w, "Invalid input files: "+err.Error(), http.StatusBadRequest)
+		return nil, nil, false
 	}
 
-	return nil
+	return inputs, config, true
 }
 
-func copyRange(sourceFile, destFile *excelize.File, sourceSheet, sourceRange, destSheet, destCell, filterColumn, filterMask string) error {
-	// Get rows from source range
-	rows, err := sourceFile.GetRows(sourceSheet)
-	if err != nil {
-		return fmt.Errorf("failed to get rows: %w", err)
+func downloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	// Parse the range
-	startCol, startRow, endCol, endRow, err := parseRangeCoords(sourceRange)
-	if err != nil {
-		return fmt.Errorf("failed to parse range: %w", err)
-	}
+	filename := filepath.Base(r.URL.Path)
+	filePath := filepath.Join(outputDir, filename)
 
-	// Parse destination cell
-	destCol, destRow, err := excelize.CellNameToCoordinates(destCell)
-	if err != nil {
-		return fmt.Errorf("failed to parse destination cell: %w", err)
+	// Security: prevent path traversal attacks
+	if !isPathSafe(filePath, outputDir) {
+		http.NotFound(w, r)
+		return
 	}
 
-	// Parse filter column if specified (e.g., "B" -> column 2)
-	var filterColNum int
-	if filterColumn != "" {
-		filterColNum, _, err = excelize.CellNameToCoordinates(filterColumn + "1")
-		if err != nil {
-			return fmt.Errorf("failed to parse filter column: %w", err)
-		}
+	// Check if file exists
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
 	}
 
-	// Copy data with filtering
-	rowOffset := 0
-	for r := startRow; r <= endRow && r <= len(rows); r++ {
-		if r > len(rows) {
-			break
-		}
-		row := rows[r-1]
-
-		// Apply filter if specified
-		if filterColumn != "" && filterMask != "" {
-			// Get value from filter column
-			if filterColNum > len(row) {
-				continue // skip row if filter column doesn't exist
-			}
-			filterValue := ""
-			if filterColNum <= len(row) {
-				filterValue = row[filterColNum-1]
-			}
-
-			// Check if value matches mask
-			if !matchesMask(filterValue, filterMask) {
-				continue // skip this row
-			}
-		}
+	// Set headers for download
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.Header().Set("Content-Type", contentType(filename))
 
-		colOffset := 0
-		for c := startCol; c <= endCol && c <= len(row); c++ {
-			if c > len(row) {
-				break
-			}
+	// Serve file
+	http.ServeFile(w, r, filePath)
+}
 
-			sourceCellName, _ := excelize.CoordinatesToCellName(c, r)
-			destCellName, _ := excelize.CoordinatesToCellName(destCol+colOffset, destRow+rowOffset)
+// processExcel applies the configuration to the input files and saves the result in outputDir.
+// Processing stops with ctx.Err() when ctx is canceled. progress may be nil.
+func processExcel(ctx context.Context, inputs map[string]string, config *transform.Config, password string, progress transform.ProgressFunc) (string, *transform.ProcessingReport, error) {
+	timestamp := time.Now().Format("20060102_150405")
+	outputFilePath := filepath.Join(outputDir, timestamp+"_"+config.OutputFilename)
 
-			// Copy cell with type preservation
-			copyCellValue(sourceFile, destFile, sourceSheet, sourceCellName, destSheet, destCellName)
+	report, err := transformFile(ctx, inputs, outputFilePath, config, password, progress)
+	if err != nil {
+		return "", nil, err
+	}
 
-			colOffset++
+	// Data formats change the extension of the output file
+	if report.OutputFilename != "" && report.OutputFilename != config.OutputFilename {
+		path := filepath.Join(outputDir, timestamp+"_"+report.OutputFilename)
+		if err := os.Rename(outputFilePath, path); err != nil {
+			os.Remove(outputFilePath)
+			return "", nil, fmt.Errorf("failed to save output file: %w", err)
 		}
-		rowOffset++
+		outputFilePath = path
 	}
 
-	return nil
+	return outputFilePath, report, nil
 }
 
-func parseReference(ref string) (sheet, cellOrRange string) {
-	// Split by '!'
-	parts := splitReference(ref)
-	if len(parts) == 2 {
-		return parts[0], parts[1]
-	}
-	return "Sheet1", ref
+// contentTypes are the content types of output files by extension
+var contentTypes = map[string]string{
+	".xlsx":   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xlsm":   "application/vnd.ms-excel.sheet.macroEnabled.12",
+	".ods":    "application/vnd.oasis.opendocument.spreadsheet",
+	".csv":    "text/csv; charset=utf-8",
+	".json":   "application/json",
+	".ndjson": "application/x-ndjson",
+	".zip":    "application/zip",
 }
 
-func splitReference(ref string) []string {
-	for i, char := range ref {
-		if char == '!' {
-			return []string{ref[:i], ref[i+1:]}
-		}
-	}
-	return []string{ref}
-}
-
-func isRange(cellRef string) bool {
-	for _, char := range cellRef {
-		if char == ':' {
-			return true
-		}
+// contentType returns the content type of an output file, by default that of .xlsx workbooks
+func contentType(filename string) string {
+	if t, ok := contentTypes[strings.ToLower(filepath.Ext(filename))]; ok {
+		return t
 	}
-	return false
+	return contentTypes[".xlsx"]
 }
 
-func parseRangeCoords(rangeRef string) (startCol, startRow, endCol, endRow int, err error) {
-	// Split range by ':'
-	parts := []string{}
-	colonIndex := -1
-	for i, char := range rangeRef {
-		if char == ':' {
-			colonIndex = i
-			break
-		}
-	}
-
-	if colonIndex == -1 {
-		return 0, 0, 0, 0, fmt.Errorf("invalid range format")
-	}
-
-	parts = []string{rangeRef[:colonIndex], rangeRef[colonIndex+1:]}
-
-	if len(parts) != 2 {
-		return 0, 0, 0, 0, fmt.Errorf("invalid range format")
-	}
-
-	startCol, startRow, err = excelize.CellNameToCoordinates(parts[0])
+// transformFile applies the configuration to the input files and saves the result as outputFilePath.
+// Encrypted input files are opened with password, or with the passwords of the configuration if it is empty.
+// The output file is removed if the transformation fails.
+func transformFile(ctx context.Context, inputs map[string]string, outputFilePath string, config *transform.Config, password string, progress transform.ProgressFunc) (*transform.ProcessingReport, error) {
+	engine, err := transform.NewEngine(config)
 	if err != nil {
-		return 0, 0, 0, 0, err
-	}
-
-	endCol, endRow, err = excelize.CellNameToCoordinates(parts[1])
-	if err != nil {
-		return 0, 0, 0, 0, err
+		return nil, err
 	}
+	engine.TemplatesDir = "./templates"
+	engine.LookupDir = lookupDir
+	engine.Progress = progress
+	engine.Password = password
 
-	return startCol, startRow, endCol, endRow, nil
-}
-
-// matchesMask checks if a string matches a pattern with wildcards (*)
-// Example: matchesMask("abc123", "*3*") returns true
-func matchesMask(value, mask string) bool {
-	if mask == "" {
-		return true // empty mask matches everything
-	}
-
-	// Split mask by wildcards
-	parts := []string{}
-	current := ""
-	for _, char := range mask {
-		if char == '*' {
-			if current != "" {
-				parts = append(parts, current)
-				current = ""
-			}
-		} else {
-			current += string(char)
+	sources := make(map[string]io.Reader, len(inputs))
+	for alias, inputFilePath := range inputs {
+		input, err := os.Open(inputFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open source file: %w", err)
 		}
-	}
-	if current != "" {
-		parts = append(parts, current)
+		defer input.Close()
+		sources[alias] = input
 	}
 
-	// If no wildcards, do exact match
-	if len(parts) == 0 {
-		return true
-	}
-	if len(parts) == 1 && mask[0] != '*' && mask[len(mask)-1] != '*' {
-		return value == mask
+	output, err := os.Create(outputFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save output file: %w", err)
 	}
 
-	// Check if all parts exist in order
-	position := 0
-	for _, part := range parts {
-		index := -1
-		for i := position; i <= len(value)-len(part); i++ {
-			if value[i:i+len(part)] == part {
-				index = i
-				break
-			}
-		}
-		if index == -1 {
-			return false
-		}
-		position = index + len(part)
+	report, err := engine.TransformInputs(ctx, sources, output)
+	if closeErr := output.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to save output file: %w", closeErr)
 	}
-
-	// Check prefix and suffix
-	if len(mask) > 0 && mask[0] != '*' && len(parts) > 0 {
-		if len(value) < len(parts[0]) || value[:len(parts[0])] != parts[0] {
-			return false
-		}
-	}
-	if len(mask) > 0 && mask[len(mask)-1] != '*' && len(parts) > 0 {
-		lastPart := parts[len(parts)-1]
-		if len(value) < len(lastPart) || value[len(value)-len(lastPart):] != lastPart {
-			return false
-		}
+	if err != nil {
+		os.Remove(outputFilePath)
+		return nil, err
 	}
 
-	return true
+	return report, nil
 }
 
-func loadConfig(configPath string) (*Config, error) {
+func loadConfig(configPath string) (*transform.Config, error) {
 	// Check if file was modified
 	info, err := os.Stat(configPath)
 	if err != nil {
@@ -711,7 +566,7 @@ func loadConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
-	var config Config
+	var config transform.Config
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
@@ -760,29 +615,6 @@ func isPathSafe(filePath, baseDir string) bool {
 	return true
 }
 
-// validateSheetName checks if the sheet name is valid for Excel
-// Sheet names must be 1-31 characters and cannot contain: [ ] : * ? / \
-func validateSheetName(name string) error {
-	if name == "" {
-		return fmt.Errorf("sheet name cannot be empty")
-	}
-
-	if len(name) > 31 {
-		return fmt.Errorf("sheet name cannot exceed 31 characters, got %d", len(name))
-	}
-
-	invalidChars := []rune{'[', ']', ':', '*', '?', '/', '\\'}
-	for _, char := range name {
-		for _, invalid := range invalidChars {
-			if char == invalid {
-				return fmt.Errorf("sheet name contains invalid character: '%c'", char)
-			}
-		}
-	}
-
-	return nil
-}
-
 // startCleanupRoutine starts a background goroutine that deletes files older than maxAgeHours
 func startCleanupRoutine(dir string, maxAgeHours int) {
 	ticker := time.NewTicker(1 * time.Hour)
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"ex2ex/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultProfileName is the name of the profile stored first in the main config file
+const defaultProfileName = "default"
+
+var (
+	errProfileNotFound = errors.New("profile not found")
+	errProfileReadOnly = errors.New("profile is defined in the main config file and cannot be changed here")
+)
+
+// ProfileInfo is a short description of a profile returned by the profile list API
+type ProfileInfo struct {
+	Name           string `json:"name"`
+	OutputFilename string `json:"output_filename"`
+	Mappings       int    `json:"mappings"`
+	Source         string `json:"source"`
+	ReadOnly       bool   `json:"read_only"`
+}
+
+// ProfileStore keeps named transformation profiles.
+// Profiles are read from the main config file (several YAML documents separated by ---)
+// and from *.yaml files in the profiles directory, one profile per file.
+// The first document of the main config file is always the default profile.
+type ProfileStore struct {
+	configPath string
+	dir        string
+	mu         sync.Mutex
+}
+
+type storedProfile struct {
+	config  *transform.Config
+	path    string
+	fromDir bool
+}
+
+func NewProfileStore(configPath, dir string) *ProfileStore {
+	return &ProfileStore{configPath: configPath, dir: dir}
+}
+
+// List returns all known profiles sorted by name
+func (s *ProfileStore) List() ([]ProfileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles, err := s.loadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]ProfileInfo, 0, len(profiles))
+	for name, p := range profiles {
+		list = append(list, ProfileInfo{
+			Name:           name,
+			OutputFilename: p.config.OutputFilename,
+			Mappings:       len(p.config.Mappings),
+			Source:         p.path,
+			ReadOnly:       !p.fromDir,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
+
+// Get returns the profile with the given name. An empty name selects the default profile.
+func (s *ProfileStore) Get(name string) (*transform.Config, error) {
+	if name == "" {
+		name = defaultProfileName
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles, err := s.loadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errProfileNotFound, name)
+	}
+	if err := p.config.Validate(); err != nil {
+		return nil, fmt.Errorf("profile %s: config validation failed: %w", name, err)
+	}
+
+	return p.config, nil
+}
+
+// Save creates or replaces a profile in the profiles directory
+func (s *ProfileStore) Save(name string, config *transform.Config) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles, err := s.loadAll()
+	if err != nil {
+		return err
+	}
+	if p, ok := profiles[name]; ok && !p.fromDir {
+		return fmt.Errorf("%w: %s", errProfileReadOnly, name)
+	}
+
+	config.Name = name
+	yamlData, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal profile: %w", err)
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create profiles directory: %w", err)
+	}
+
+	path := filepath.Join(s.dir, name+".yaml")
+	if p, ok := profiles[name]; ok {
+		path = p.path
+	}
+
+	return os.WriteFile(path, append([]byte("# Профиль трансформации Excel файлов\n"), yamlData...), 0644)
+}
+
+// Delete removes a profile from the profiles directory
+func (s *ProfileStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles, err := s.loadAll()
+	if err != nil {
+		return err
+	}
+
+	p, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", errProfileNotFound, name)
+	}
+	if !p.fromDir {
+		return fmt.Errorf("%w: %s", errProfileReadOnly, name)
+	}
+
+	return os.Remove(p.path)
+}
+
+// loadAll reads every profile from the main config file and the profiles directory.
+// Profiles from the directory take precedence over documents of the main config file,
+// except the default profile, which is only read from the main config file.
+func (s *ProfileStore) loadAll() (map[string]storedProfile, error) {
+	profiles := make(map[string]storedProfile)
+
+	configs, err := loadConfigDocuments(s.configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", s.configPath, err)
+	}
+	for i, config := range configs {
+		name := config.Name
+		switch {
+		case i == 0:
+			name = defaultProfileName
+		case name == "":
+			name = strings.TrimSuffix(config.OutputFilename, filepath.Ext(config.OutputFilename))
+		}
+		if _, exists := profiles[name]; exists {
+			log.Printf("Warning: duplicate profile %q in %s, keeping the first one", name, s.configPath)
+			continue
+		}
+		profiles[name] = storedProfile{config: config, path: s.configPath}
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return profiles, nil
+		}
+		return nil, fmt.Errorf("failed to read profiles directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		path := filepath.Join(s.dir, entry.Name())
+		configs, err := loadConfigDocuments(path)
+		if err != nil {
+			log.Printf("Warning: skipping profile file %s: %v", path, err)
+			continue
+		}
+		if len(configs) == 0 {
+			continue
+		}
+
+		name := configs[0].Name
+		if name == "" {
+			name = strings.TrimSuffix(entry.Name(), ext)
+		}
+		if name == defaultProfileName {
+			log.Printf("Warning: skipping profile file %s: the default profile is the first document of %s", path, s.configPath)
+			continue
+		}
+		profiles[name] = storedProfile{config: configs[0], path: path, fromDir: true}
+	}
+
+	return profiles, nil
+}
+
+// loadConfigDocuments parses every YAML document of a file into a Config
+func loadConfigDocuments(path string) ([]*transform.Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var configs []*transform.Config
+	decoder := yaml.NewDecoder(f)
+	for {
+		var config transform.Config
+		if err := decoder.Decode(&config); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		// Skip empty documents (e.g. a trailing ---)
+		if config.OutputFilename == "" && len(config.Mappings) == 0 {
+			continue
+		}
+		configs = append(configs, &config)
+	}
+
+	return configs, nil
+}
+
+// validateProfileName checks that a profile name can be safely used as a file name
+func validateProfileName(name string) error {
+	if name == "" {
+		return fmt.Errorf("profile name cannot be empty")
+	}
+	if name == defaultProfileName {
+		return fmt.Errorf("%w: %s", errProfileReadOnly, name)
+	}
+	if len(name) > 64 {
+		return fmt.Errorf("profile name cannot exceed 64 characters, got %d", len(name))
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\:*?"<>|`) {
+		return fmt.Errorf("profile name contains invalid characters: %q", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ex2ex/transform"
+)
+
+// testProfileStore writes the main config file and the profile files, given by file name
+func testProfileStore(t *testing.T, config string, files map[string]string) *ProfileStore {
+	t.Helper()
+	root := t.TempDir()
+	configPath := filepath.Join(root, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "profiles")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewProfileStore(configPath, dir)
+}
+
+// testProfile is a profile document writing output
+func testProfile(name, output string) string {
+	doc := "output_filename: " + output + "\nmappings:\n  - {source: 'Sheet1!A1', destination: 'Sheet1!A1'}\n"
+	if name != "" {
+		doc = "name: " + name + "\n" + doc
+	}
+	return doc
+}
+
+func TestProfileStoreGet(t *testing.T) {
+	store := testProfileStore(t,
+		testProfile("main", "main.xlsx")+"---\n"+testProfile("", "weekly.xlsx")+"---\n"+testProfile("daily", "daily_main.xlsx")+"---\n",
+		map[string]string{
+			"daily.yaml":   testProfile("", "daily_dir.xlsx"),
+			"default.yaml": testProfile("", "dir_default.xlsx"),
+			"named.yml":    testProfile("monthly", "monthly.xlsx"),
+			"broken.yaml":  "mappings: [",
+			"notes.txt":    testProfile("", "notes.xlsx"),
+		})
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{"", "main.xlsx", nil},
+		{"default", "main.xlsx", nil},
+		{"weekly", "weekly.xlsx", nil},
+		{"daily", "daily_dir.xlsx", nil},
+		{"monthly", "monthly.xlsx", nil},
+		{"main", "", errProfileNotFound},
+		{"named", "", errProfileNotFound},
+		{"broken", "", errProfileNotFound},
+		{"notes", "", errProfileNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := store.Get(tt.name)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Get() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.OutputFilename != tt.want {
+				t.Errorf("Get() output_filename = %q, want %q", config.OutputFilename, tt.want)
+			}
+		})
+	}
+
+	// The list shows the profiles Get returns
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range list {
+		config, err := store.Get(p.Name)
+		if err != nil || config.OutputFilename != p.OutputFilename {
+			t.Errorf("profile %s: listed %q, Get() = %v, %v", p.Name, p.OutputFilename, config, err)
+		}
+		names = append(names, p.Name)
+	}
+	if want := []string{"daily", "default", "monthly", "weekly"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List() = %q, want %q", names, want)
+	}
+	if list[1].ReadOnly != true || list[0].ReadOnly != false {
+		t.Errorf("read_only of daily, default = %v, %v, want false, true", list[0].ReadOnly, list[1].ReadOnly)
+	}
+}
+
+func TestProfileStoreGetInvalid(t *testing.T) {
+	store := testProfileStore(t, "output_filename: out.xlsx\n", map[string]string{"empty.yaml": "name: empty\noutput_filename: out.xlsx\n"})
+	for _, name := range []string{"", "empty"} {
+		if _, err := store.Get(name); err == nil || !strings.Contains(err.Error(), "at least one mapping is required") {
+			t.Errorf("Get(%q) error = %v, want a validation error", name, err)
+		}
+	}
+}
+
+func TestProfileStoreSaveDelete(t *testing.T) {
+	store := testProfileStore(t, testProfile("", "main.xlsx")+"---\n"+testProfile("weekly", "weekly.xlsx"), nil)
+	config := &transform.Config{
+		OutputFilename: "new.xlsx",
+		Mappings:       []transform.Mapping{{Source: "Sheet1!A1", Destination: "Sheet1!A1"}},
+	}
+
+	if err := store.Save("new", config); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get("new"); err != nil || got.OutputFilename != "new.xlsx" || got.Name != "new" {
+		t.Errorf("Get() of the saved profile = %+v, %v", got, err)
+	}
+	for _, name := range []string{"default", "weekly"} {
+		if err := store.Save(name, config); !errors.Is(err, errProfileReadOnly) {
+			t.Errorf("Save(%q) error = %v, want %v", name, err, errProfileReadOnly)
+		}
+		if err := store.Delete(name); !errors.Is(err, errProfileReadOnly) {
+			t.Errorf("Delete(%q) error = %v, want %v", name, err, errProfileReadOnly)
+		}
+	}
+	if err := store.Save("bad", &transform.Config{OutputFilename: "x.xlsx"}); err == nil {
+		t.Error("Save() of an invalid profile succeeded")
+	}
+
+	if err := store.Delete("new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("new"); !errors.Is(err, errProfileNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, errProfileNotFound)
+	}
+	if err := store.Delete("new"); !errors.Is(err, errProfileNotFound) {
+		t.Errorf("second Delete() error = %v, want %v", err, errProfileNotFound)
+	}
+}
+
+func TestValidateProfileName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"monthly", false},
+		{"отчет-2024", false},
+		{"", true},
+		{"default", true},
+		{strings.Repeat("a", 65), true},
+		{"..", true},
+		{"a/b", true},
+		{`a\b`, true},
+		{"a:b", true},
+	}
+	for _, tt := range tests {
+		if err := validateProfileName(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("validateProfileName(%q) error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
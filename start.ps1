@@ -29,6 +29,14 @@ try {
     exit 1
 }
 
+# Проверка файла пользователей: без него сервер не запускается
+if (-not (Test-Path "users.yaml" -PathType Leaf)) {
+    Write-Host "❌ Файл пользователей users.yaml не найден." -ForegroundColor Red
+    Write-Host "   Скопируйте users.example.yaml в users.yaml и задайте хеши паролей:" -ForegroundColor Red
+    Write-Host '   echo "пароль" | go run . hash-password' -ForegroundColor Red
+    exit 1
+}
+
 # Запуск через Docker Compose
 Write-Host ""
 Write-Host "📦 Building and starting containers..." -ForegroundColor Cyan
@@ -18,6 +18,14 @@ if ! command -v docker-compose &> /dev/null; then
     exit 1
 fi
 
+# Проверка файла пользователей: без него сервер не запускается
+if [ ! -f users.yaml ]; then
+    echo "❌ Файл пользователей users.yaml не найден."
+    echo "   Скопируйте users.example.yaml в users.yaml и задайте хеши паролей:"
+    echo "   echo \"пароль\" | go run . hash-password"
+    exit 1
+fi
+
 # Запуск через Docker Compose
 echo "📦 Building and starting containers..."
 docker-compose up -d --build
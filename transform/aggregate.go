@@ -0,0 +1,392 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Functions of the aggregate values
+const (
+	AggregateSum           = "sum"
+	AggregateCount         = "count"
+	AggregateAvg           = "avg"
+	AggregateMin           = "min"
+	AggregateMax           = "max"
+	AggregateCountDistinct = "count_distinct"
+)
+
+// Aggregate turns a range mapping into a summary: the rows of the source range are
+// grouped by the group_by columns and one row per group is written with the group
+// values followed by the aggregate values. Groups keep the order they first appear
+// in, unless sort_by is given.
+type Aggregate struct {
+	GroupBy        []string         `yaml:"group_by,omitempty" json:"group_by,omitempty"`
+	GroupByHeaders []string         `yaml:"group_by_headers,omitempty" json:"group_by_headers,omitempty"`
+	Values         []AggregateValue `yaml:"values,omitempty" json:"values,omitempty"`
+	SortBy         []SortKey        `yaml:"sort_by,omitempty" json:"sort_by,omitempty"`
+	NoTitles       bool             `yaml:"no_titles,omitempty" json:"no_titles,omitempty"`
+}
+
+// AggregateValue is an aggregate of a source column, given by its letter or by its header.
+// Title is the header of the result column.
+type AggregateValue struct {
+	Function string `yaml:"function" json:"function"`
+	Column   string `yaml:"column,omitempty" json:"column,omitempty"`
+	Header   string `yaml:"header,omitempty" json:"header,omitempty"`
+	Title    string `yaml:"title,omitempty" json:"title,omitempty"`
+}
+
+// width returns the number of columns of the summary table
+func (a *Aggregate) width() int {
+	return len(a.GroupBy) + len(a.GroupByHeaders) + len(a.Values)
+}
+
+// usesHeaders reports whether any group or value column is given by header
+func (a *Aggregate) usesHeaders() bool {
+	if len(a.GroupByHeaders) > 0 {
+		return true
+	}
+	for _, v := range a.Values {
+		if v.Header != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// title returns the header of the result column of the value
+func (v AggregateValue) title() string {
+	if v.Title != "" {
+		return v.Title
+	}
+	column := v.Header
+	if column == "" {
+		column = v.Column
+	}
+	if column == "" {
+		return v.Function
+	}
+	return v.Function + "(" + column + ")"
+}
+
+// validateAggregate checks the aggregate of a mapping
+func validateAggregate(m Mapping) error {
+	a := m.Aggregate
+	if a == nil {
+		return nil
+	}
+
+	_, sourceRange := parseReference(m.Source)
+	if !isRange(sourceRange) {
+		return fmt.Errorf("aggregate requires a range source")
+	}
+	if len(m.Columns) > 0 || len(m.Transforms) > 0 || len(m.Computed) > 0 || m.Join != nil {
+		return fmt.Errorf("aggregate cannot be combined with columns, transforms, computed or join")
+	}
+	if len(a.GroupBy) > 0 && len(a.GroupByHeaders) > 0 {
+		return fmt.Errorf("aggregate: use either group_by or group_by_headers")
+	}
+	if a.width() == 0 {
+		return fmt.Errorf("aggregate: group_by or values is required")
+	}
+	for i, col := range a.GroupBy {
+		if _, err := excelize.ColumnNameToNumber(col); err != nil {
+			return fmt.Errorf("aggregate: group_by[%d]: invalid column %q", i, col)
+		}
+	}
+	for i, header := range a.GroupByHeaders {
+		if headerKey(header) == "" {
+			return fmt.Errorf("aggregate: group_by_headers[%d]: header cannot be empty", i)
+		}
+	}
+
+	for i, v := range a.Values {
+		if v.Column != "" && v.Header != "" {
+			return fmt.Errorf("aggregate: values[%d]: use either column or header", i)
+		}
+		if v.Column != "" {
+			if _, err := excelize.ColumnNameToNumber(v.Column); err != nil {
+				return fmt.Errorf("aggregate: values[%d]: invalid column %q", i, v.Column)
+			}
+		}
+		switch strings.ToLower(v.Function) {
+		case AggregateCount:
+		case AggregateSum, AggregateAvg, AggregateMin, AggregateMax, AggregateCountDistinct:
+			if v.Column == "" && v.Header == "" {
+				return fmt.Errorf("aggregate: values[%d]: %s requires column or header", i, v.Function)
+			}
+		case "":
+			return fmt.Errorf("aggregate: values[%d]: function is required", i)
+		default:
+			return fmt.Errorf("aggregate: values[%d]: unknown function %q", i, v.Function)
+		}
+	}
+
+	if err := validateSortKeys(a.SortBy, "aggregate: sort_by"); err != nil {
+		return err
+	}
+	for i, key := range a.SortBy {
+		if _, ok := a.sortColumn(key); !ok {
+			return fmt.Errorf("aggregate: sort_by[%d]: no group or value column %s%s", i, key.Column, key.Header)
+		}
+	}
+	return nil
+}
+
+// sortColumn returns the index of the summary column a sort key refers to: a group_by
+// column by letter, or a group_by_headers column or a value by its header or title
+func (a *Aggregate) sortColumn(key SortKey) (int, bool) {
+	if key.Column != "" {
+		for i, col := range a.GroupBy {
+			if strings.EqualFold(col, key.Column) {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	for i, header := range a.GroupByHeaders {
+		if headerKey(header) == headerKey(key.Header) {
+			return i, true
+		}
+	}
+	groups := len(a.GroupBy) + len(a.GroupByHeaders)
+	for i, v := range a.Values {
+		if headerKey(v.title()) == headerKey(key.Header) || (v.Header != "" && headerKey(v.Header) == headerKey(key.Header)) {
+			return groups + i, true
+		}
+	}
+	return 0, false
+}
+
+// summary collects the rows of a mapping whose table is written once all rows are read
+type summary interface {
+	bind(headers headerIndex, row []string) error
+	add(values *rowValues) error
+	write(destFile *outputWorkbook, rc *rangeCopy)
+}
+
+// aggregator collects the groups of a summary while the source rows are read
+type aggregator struct {
+	spec      *Aggregate
+	groupCols []int
+	valueCols []int
+	titles    []string
+	groups    map[string]*aggregateGroup
+	order     []*aggregateGroup
+}
+
+// aggregateGroup holds the group values of the first row of a group and the running aggregates
+type aggregateGroup struct {
+	cells  []sourceCell
+	sort   []sortValue
+	states []aggregateState
+}
+
+type aggregateState struct {
+	count    int
+	sum      float64
+	min, max float64
+	distinct map[string]bool
+}
+
+func newAggregator(spec *Aggregate) *aggregator {
+	a := &aggregator{spec: spec, groups: make(map[string]*aggregateGroup)}
+	for _, col := range spec.GroupBy {
+		c, _ := excelize.ColumnNameToNumber(col)
+		a.groupCols = append(a.groupCols, c)
+		a.titles = append(a.titles, col)
+	}
+	a.titles = append(a.titles, spec.GroupByHeaders...)
+	for _, v := range spec.Values {
+		c := 0
+		if v.Column != "" {
+			c, _ = excelize.ColumnNameToNumber(v.Column)
+		}
+		a.valueCols = append(a.valueCols, c)
+		a.titles = append(a.titles, v.title())
+	}
+	return a
+}
+
+// bind resolves the columns given by header. Groups take their titles from the header row.
+func (a *aggregator) bind(headers headerIndex, row []string) error {
+	if len(a.spec.GroupByHeaders) > 0 {
+		cols, err := headers.columns(a.spec.GroupByHeaders)
+		if err != nil {
+			return err
+		}
+		a.groupCols = cols
+	}
+	for i, col := range a.groupCols {
+		if col <= len(row) && strings.TrimSpace(row[col-1]) != "" {
+			a.titles[i] = row[col-1]
+		}
+	}
+	for i, v := range a.spec.Values {
+		if v.Header == "" {
+			continue
+		}
+		col, err := headers.column(v.Header)
+		if err != nil {
+			return err
+		}
+		a.valueCols[i] = col
+	}
+	return nil
+}
+
+// add adds a source row to its group
+func (a *aggregator) add(values *rowValues) error {
+	keys := make([]string, len(a.groupCols))
+	for i, col := range a.groupCols {
+		keys[i], _ = values.text(col)
+	}
+	key := strings.Join(keys, "\x00")
+
+	group, ok := a.groups[key]
+	if !ok {
+		group = &aggregateGroup{states: make([]aggregateState, len(a.valueCols))}
+		for _, col := range a.groupCols {
+			src, err := values.sourceCell(col)
+			if err != nil {
+				return err
+			}
+			group.cells = append(group.cells, src)
+			group.sort = append(group.sort, rowSortValue(values, col))
+		}
+		a.groups[key] = group
+		a.order = append(a.order, group)
+	}
+
+	for i, col := range a.valueCols {
+		group.states[i].add(a.spec.Values[i].Function, values, col)
+	}
+	return nil
+}
+
+// add adds the value of column col of a row, counting the row if col is 0
+func (s *aggregateState) add(function string, values *rowValues, col int) {
+	if col == 0 {
+		s.count++
+		return
+	}
+	text, _ := values.text(col)
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	switch strings.ToLower(function) {
+	case AggregateCount:
+		s.count++
+	case AggregateCountDistinct:
+		if s.distinct == nil {
+			s.distinct = make(map[string]bool)
+		}
+		s.distinct[text] = true
+	default:
+		// Text in number columns is skipped, as by SUM in Excel
+		n, ok := values.number(col)
+		if !ok {
+			return
+		}
+		if s.count == 0 || n < s.min {
+			s.min = n
+		}
+		if s.count == 0 || n > s.max {
+			s.max = n
+		}
+		s.count++
+		s.sum += n
+	}
+}
+
+// result returns the aggregate value, ok is false if there is none
+func (s *aggregateState) result(function string) (float64, bool) {
+	switch strings.ToLower(function) {
+	case AggregateSum:
+		return s.sum, true
+	case AggregateCount:
+		return float64(s.count), true
+	case AggregateCountDistinct:
+		return float64(len(s.distinct)), true
+	case AggregateAvg:
+		return s.sum / float64(s.count), s.count > 0
+	case AggregateMin:
+		return s.min, s.count > 0
+	case AggregateMax:
+		return s.max, s.count > 0
+	}
+	return 0, false
+}
+
+// result returns aggregate i of a group
+func (a *aggregator) result(group *aggregateGroup, i int) (float64, bool) {
+	return group.states[i].result(a.spec.Values[i].Function)
+}
+
+// sorted returns the groups in the order of sort_by
+func (a *aggregator) sorted() []*aggregateGroup {
+	groups := a.order
+	if len(a.spec.SortBy) == 0 {
+		return groups
+	}
+
+	value := func(group *aggregateGroup, col int) sortValue {
+		if col < len(group.sort) {
+			return group.sort[col]
+		}
+		if n, ok := a.result(group, col-len(group.sort)); ok {
+			return numberSortValue(n)
+		}
+		return sortValue{kind: sortEmpty}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		for _, key := range a.spec.SortBy {
+			col, _ := a.spec.sortColumn(key)
+			if c := compareOrdered(value(groups[i], col), value(groups[j], col), key.descending()); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return groups
+}
+
+// write writes the summary table at the destination of the mapping
+func (a *aggregator) write(destFile *outputWorkbook, rc *rangeCopy) {
+	if !a.spec.NoTitles {
+		for i, title := range a.titles {
+			rc.writeCell(destFile, i, sourceCell{Type: excelize.CellTypeInlineString, Value: title}, nil)
+		}
+		rc.nextRow()
+	}
+
+	// Group values are copied from the first row of the group, formulas as values
+	opts := rc.opts
+	opts.Formulas = FormulasValues
+	groups := a.sorted()
+	groups = groups[min(rc.mapping.Skip, len(groups)):]
+	if rc.mapping.Limit > 0 && len(groups) > rc.mapping.Limit {
+		groups = groups[:rc.mapping.Limit]
+	}
+	for _, group := range groups {
+		for i, src := range group.cells {
+			if src.Value != "" {
+				rc.writeCell(destFile, i, src, &opts)
+			}
+		}
+		for i := range a.valueCols {
+			if n, ok := a.result(group, i); ok {
+				rc.writeCell(destFile, len(group.cells)+i, numberCell(n), nil)
+			}
+		}
+		rc.nextRow()
+	}
+}
+
+// numberCell returns a cell holding a number
+func numberCell(n float64) sourceCell {
+	return sourceCell{Type: excelize.CellTypeNumber, Value: formatNumber(n)}
+}
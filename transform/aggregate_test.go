@@ -0,0 +1,173 @@
+package transform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestTransformAggregate(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{
+		"Sales": {
+			{"Region", "Manager", "Amount", "Client"},
+			{"North", "ann", 10, "c1"},
+			{"South", "bob", 5, "c2"},
+			{"North", "ann", "н/д", "c1"},
+			{"East", "dan", "н/д", "c4"},
+			{"North", "cid", 20, "c3"},
+			{"South", "bob", 7, "c2"},
+		},
+	})
+	functions := func(column string) []AggregateValue {
+		var values []AggregateValue
+		for _, function := range []string{AggregateSum, AggregateAvg, AggregateCount, AggregateMin, AggregateMax} {
+			values = append(values, AggregateValue{Function: function, Header: column})
+		}
+		return values
+	}
+
+	tests := []struct {
+		name      string
+		mapping   Mapping
+		want      [][]string
+		wantTypes bool
+	}{
+		{
+			// East has no numbers: its sum is 0, count counts the text, avg, min and max are empty
+			name: "functions by header",
+			mapping: Mapping{Aggregate: &Aggregate{
+				GroupByHeaders: []string{"region"},
+				Values: append(functions("Amount"),
+					AggregateValue{Function: AggregateCountDistinct, Header: "Client", Title: "Clients"},
+					AggregateValue{Function: AggregateCount, Title: "Rows"}),
+			}},
+			want: [][]string{
+				{"Region", "sum(Amount)", "avg(Amount)", "count(Amount)", "min(Amount)", "max(Amount)", "Clients", "Rows"},
+				{"North", "30", "15", "3", "10", "20", "2", "3"},
+				{"South", "12", "6", "2", "5", "7", "1", "2"},
+				{"East", "0", "", "1", "", "", "1", "1"},
+			},
+			wantTypes: true,
+		},
+		{
+			name: "group_by with a header row",
+			mapping: Mapping{HeaderRow: 1, Aggregate: &Aggregate{
+				GroupBy: []string{"A", "B"},
+				Values:  []AggregateValue{{Function: AggregateSum, Column: "C"}},
+			}},
+			want: [][]string{
+				{"Region", "Manager", "sum(C)"},
+				{"North", "ann", "10"},
+				{"South", "bob", "12"},
+				{"East", "dan", "0"},
+				{"North", "cid", "20"},
+			},
+		},
+		{
+			// Without a header row the first row of the range is a group of its own
+			name: "group_by without a header row",
+			mapping: Mapping{Aggregate: &Aggregate{
+				GroupBy: []string{"A"},
+				Values:  []AggregateValue{{Function: AggregateCount}},
+			}},
+			want: [][]string{{"A", "count"}, {"Region", "1"}, {"North", "3"}, {"South", "2"}, {"East", "1"}},
+		},
+		{
+			name: "sorted top groups",
+			mapping: Mapping{Limit: 2, Aggregate: &Aggregate{
+				GroupByHeaders: []string{"Region"},
+				Values:         []AggregateValue{{Function: AggregateSum, Header: "Amount", Title: "Total"}},
+				SortBy:         []SortKey{{Header: "total", Order: "desc"}},
+				NoTitles:       true,
+			}},
+			want: [][]string{{"North", "30"}, {"South", "12"}},
+		},
+		{
+			name: "totals of the range",
+			mapping: Mapping{Aggregate: &Aggregate{
+				Values: []AggregateValue{{Function: AggregateSum, Header: "Amount"}, {Function: AggregateMax, Header: "Amount"}},
+			}},
+			want: [][]string{{"sum(Amount)", "max(Amount)"}, {"42", "20"}},
+		},
+		{
+			name: "no data rows",
+			mapping: Mapping{Source: "Sales!A1:D1", Aggregate: &Aggregate{
+				GroupByHeaders: []string{"Region"},
+				Values:         []AggregateValue{{Function: AggregateSum, Header: "Amount"}},
+			}},
+			want: [][]string{{"Region", "sum(Amount)"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping := tt.mapping
+			if mapping.Source == "" {
+				mapping.Source = "Sales!A1:D"
+			}
+			mapping.Destination = "Out!A1"
+			output, report := testTransform(t, &Config{
+				OutputFilename: "out.xlsx",
+				OutputSheets:   []OutputSheet{{Name: "Out", CreateIfNotExists: true}},
+				Mappings:       []Mapping{mapping},
+			}, source)
+			if report.ErrorCount > 0 {
+				t.Errorf("error count = %d", report.ErrorCount)
+			}
+			if got := testRows(t, output, "Out"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+			if !tt.wantTypes {
+				return
+			}
+			// Aggregates are numbers, group values keep the type of the source cell
+			for cell, want := range map[string]string{"A2": "North", "B2": "30", "C4": ""} {
+				got, _ := output.GetCellValue("Out", cell, excelize.Options{RawCellValue: true})
+				cellType, _ := output.GetCellType("Out", cell)
+				if got != want || (cell == "B2" && cellType != excelize.CellTypeUnset) {
+					t.Errorf("%s = %q of type %d, want %q", cell, got, cellType, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAggregate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping Mapping
+		wantErr string
+	}{
+		{"single cell", Mapping{Source: "S!A1", Aggregate: &Aggregate{GroupBy: []string{"A"}}}, "requires a range source"},
+		{"columns", Mapping{Columns: []string{"A"}, Aggregate: &Aggregate{GroupBy: []string{"A"}}}, "cannot be combined"},
+		{"both groups", Mapping{Aggregate: &Aggregate{GroupBy: []string{"A"}, GroupByHeaders: []string{"x"}}}, "either group_by or group_by_headers"},
+		{"empty", Mapping{Aggregate: &Aggregate{}}, "group_by or values is required"},
+		{"bad group column", Mapping{Aggregate: &Aggregate{GroupBy: []string{"1"}}}, `group_by[0]: invalid column "1"`},
+		{"empty group header", Mapping{Aggregate: &Aggregate{GroupByHeaders: []string{" "}}}, "header cannot be empty"},
+		{"column and header", Mapping{Aggregate: &Aggregate{Values: []AggregateValue{{Function: "sum", Column: "A", Header: "x"}}}}, "use either column or header"},
+		{"sum of nothing", Mapping{Aggregate: &Aggregate{Values: []AggregateValue{{Function: "sum"}}}}, "sum requires column or header"},
+		{"no function", Mapping{Aggregate: &Aggregate{Values: []AggregateValue{{Column: "A"}}}}, "function is required"},
+		{"unknown function", Mapping{Aggregate: &Aggregate{Values: []AggregateValue{{Function: "median", Column: "A"}}}}, `unknown function "median"`},
+		{"sort by value column", Mapping{Aggregate: &Aggregate{GroupBy: []string{"A"}, SortBy: []SortKey{{Column: "B"}}}}, "no group or value column B"},
+		{"valid", Mapping{Aggregate: &Aggregate{GroupBy: []string{"A"}, Values: []AggregateValue{{Function: "COUNT"}}, SortBy: []SortKey{{Header: "count"}}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping := tt.mapping
+			if mapping.Source == "" {
+				mapping.Source = "S!A1:D"
+			}
+			err := validateAggregate(mapping)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateAggregate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateAggregate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransformAppend(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{
+		"January":  {{"Month", "Amount"}, {"jan", 1}, {"jan", 2}},
+		"February": {{"Month", "Amount"}, {"feb", 3}},
+		"March":    {{"Month", "Amount"}, {"mar", 4}, {"mar", 5}, {"mar", 6}},
+		"Sheet1":   {{"total", 21}},
+	})
+
+	tests := []struct {
+		name     string
+		mappings []Mapping
+		want     [][]string
+	}{
+		{
+			name: "ranges",
+			mappings: []Mapping{
+				{Source: "January!A1:B1", Destination: "Out!A1"},
+				{Source: "January!A2:B", Destination: "Out!A2", Mode: ModeAppend},
+				{Source: "February!A2:B", Destination: "Out!A2", Mode: ModeAppend},
+				{Source: "March!A2:B", Destination: "Out!A2", Mode: ModeAppend},
+			},
+			want: [][]string{{"Month", "Amount"}, {"jan", "1"}, {"jan", "2"}, {"feb", "3"}, {"mar", "4"}, {"mar", "5"}, {"mar", "6"}},
+		},
+		{
+			// The same sheet is read by the first and the last mapping, the last one still waits
+			name: "same source sheet",
+			mappings: []Mapping{
+				{Source: "January!A2:B", Destination: "Out!A1", Mode: ModeAppend},
+				{Source: "February!A2:B", Destination: "Out!A1", Mode: ModeAppend},
+				{Source: "January!A2:A", Destination: "Out!A1", Mode: ModeAppend},
+			},
+			want: [][]string{{"jan", "1"}, {"jan", "2"}, {"feb", "3"}, {"jan"}, {"jan"}},
+		},
+		{
+			name: "single cells",
+			mappings: []Mapping{
+				{Source: "March!A1:B4", Destination: "Out!A2"},
+				{Source: "Sheet1!A1", Destination: "Out!A1", Mode: ModeAppend},
+				{Source: "Sheet1!B1", Destination: "Out!B1", Mode: ModeAppend},
+				{Source: "Sheet1!B1", Destination: "Out!C3", Mode: ModeAppend},
+			},
+			want: [][]string{nil, {"Month", "Amount"}, {"mar", "4", "21"}, {"mar", "5"}, {"mar", "6"}, {"total", "21"}},
+		},
+		{
+			// Append mappings below the columns they write to, not below the whole sheet
+			name: "columns",
+			mappings: []Mapping{
+				{Source: "March!A1:A4", Destination: "Out!A1"},
+				{Source: "January!B2:B", Destination: "Out!B1", Mode: ModeAppend},
+				{Source: "February!A2:B", Destination: "Out!A1", Mode: ModeAppend},
+			},
+			want: [][]string{{"Month", "1"}, {"mar", "2"}, {"mar"}, {"mar"}, {"feb", "3"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, report := testTransform(t, &Config{
+				OutputFilename: "out.xlsx",
+				OutputSheets:   []OutputSheet{{Name: "Out", CreateIfNotExists: true}},
+				Mappings:       tt.mappings,
+			}, source)
+			if report.ErrorCount > 0 {
+				t.Errorf("error count = %d", report.ErrorCount)
+			}
+			if got := testRows(t, output, "Out"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
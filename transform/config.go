@@ -0,0 +1,415 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Config describes a transformation: the mappings applied to the source workbooks
+// and the sheets of the output workbook
+type Config struct {
+	Name           string           `yaml:"name,omitempty" json:"name,omitempty"`
+	OutputFilename string           `yaml:"output_filename" json:"output_filename"`
+	OutputFormat   string           `yaml:"output_format,omitempty" json:"output_format,omitempty"`
+	Inputs         map[string]Input `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+	CSV            *CSVOptions      `yaml:"csv,omitempty" json:"csv,omitempty"`
+	InputPassword  string           `yaml:"input_password,omitempty" json:"input_password,omitempty"`
+	Mappings       []Mapping        `yaml:"mappings" json:"mappings"`
+	OutputSheets   []OutputSheet    `yaml:"output_sheets" json:"output_sheets"`
+	ReportSheet    bool             `yaml:"report_sheet,omitempty" json:"report_sheet,omitempty"`
+	Protection     *Protection      `yaml:"protection,omitempty" json:"protection,omitempty"`
+}
+
+// Mapping copies a cell or a range of the source workbook to the output workbook
+type Mapping struct {
+	Source            string           `yaml:"source" json:"source"`
+	Destination       string           `yaml:"destination" json:"destination"`
+	Mode              string           `yaml:"mode,omitempty" json:"mode,omitempty"`
+	Columns           []string         `yaml:"columns,omitempty" json:"columns,omitempty"`
+	HeaderRow         int              `yaml:"header_row,omitempty" json:"header_row,omitempty"`
+	StopAtBlank       bool             `yaml:"stop_at_blank_row,omitempty" json:"stop_at_blank_row,omitempty"`
+	FilterColumn      string           `yaml:"filter_column,omitempty" json:"filter_column,omitempty"`
+	FilterMask        string           `yaml:"filter_mask,omitempty" json:"filter_mask,omitempty"`
+	Filters           []Filter         `yaml:"filters,omitempty" json:"filters,omitempty"`
+	FilterMatch       string           `yaml:"filter_match,omitempty" json:"filter_match,omitempty"`
+	Formulas          string           `yaml:"formulas,omitempty" json:"formulas,omitempty"`
+	CopyStyles        string           `yaml:"copy_styles,omitempty" json:"copy_styles,omitempty"`
+	Transforms        []Transform      `yaml:"transforms,omitempty" json:"transforms,omitempty"`
+	Computed          []ComputedColumn `yaml:"computed,omitempty" json:"computed,omitempty"`
+	Join              *Join            `yaml:"join,omitempty" json:"join,omitempty"`
+	Aggregate         *Aggregate       `yaml:"aggregate,omitempty" json:"aggregate,omitempty"`
+	SortBy            []SortKey        `yaml:"sort_by,omitempty" json:"sort_by,omitempty"`
+	DistinctOn        []string         `yaml:"distinct_on,omitempty" json:"distinct_on,omitempty"`
+	DistinctOnHeaders []string         `yaml:"distinct_on_headers,omitempty" json:"distinct_on_headers,omitempty"`
+	Skip              int              `yaml:"skip,omitempty" json:"skip,omitempty"`
+	Limit             int              `yaml:"limit,omitempty" json:"limit,omitempty"`
+	Transpose         bool             `yaml:"transpose,omitempty" json:"transpose,omitempty"`
+	Unpivot           *Unpivot         `yaml:"unpivot,omitempty" json:"unpivot,omitempty"`
+	Pivot             *Pivot           `yaml:"pivot,omitempty" json:"pivot,omitempty"`
+}
+
+// copyOptions controls how copyCellValue copies a single cell
+type copyOptions struct {
+	Formulas   string
+	CopyStyles string
+	styles     *styleCache
+}
+
+func (m Mapping) copyOptions(styles *styleCache) copyOptions {
+	return copyOptions{Formulas: m.Formulas, CopyStyles: m.CopyStyles, styles: styles}
+}
+
+// OutputSheet is a sheet created in the output workbook when no template is used
+type OutputSheet struct {
+	Name              string `yaml:"name" json:"name"`
+	CreateIfNotExists bool   `yaml:"create_if_not_exists" json:"create_if_not_exists"`
+}
+
+// Validate checks if the configuration is valid
+func (c *Config) Validate() error {
+	if c.OutputFilename == "" {
+		return fmt.Errorf("output_filename is required")
+	}
+
+	if err := ValidateOutputFormat(c.OutputFormat); err != nil {
+		return err
+	}
+
+	if len(c.Mappings) == 0 {
+		return fmt.Errorf("at least one mapping is required")
+	}
+
+	for i, m := range c.Mappings {
+		if m.Source == "" {
+			return fmt.Errorf("mapping %d: source is required", i)
+		}
+		if m.Destination == "" {
+			return fmt.Errorf("mapping %d: destination is required", i)
+		}
+		switch m.Mode {
+		case "", ModeOverwrite, ModeAppend:
+		default:
+			return fmt.Errorf("mapping %d: mode must be one of overwrite, append", i)
+		}
+		switch m.Formulas {
+		case "", FormulasTranslate, FormulasValues, FormulasVerbatim:
+		default:
+			return fmt.Errorf("mapping %d: formulas must be one of translate, values, verbatim", i)
+		}
+		switch m.CopyStyles {
+		case "", CopyStylesNone, CopyStylesValues, CopyStylesFull:
+		default:
+			return fmt.Errorf("mapping %d: copy_styles must be one of none, values, full", i)
+		}
+		if _, err := compileFilters(m); err != nil {
+			return fmt.Errorf("mapping %d: %w", i, err)
+		}
+		if err := validateColumns(m); err != nil {
+			return fmt.Errorf("mapping %d: %w", i, err)
+		}
+		if _, err := compileTransforms(m); err != nil {
+			return fmt.Errorf("mapping %d: %w", i, err)
+		}
+		if err := validateComputed(m); err != nil {
+			return fmt.Errorf("mapping %d: %w", i, err)
+		}
+		if err := validateJoin(m); err != nil {
+			return fmt.Errorf("mapping %d: %w", i, err)
+		}
+		if err := validateAggregate(m); err != nil {
+			return fmt.Errorf("mapping %d: %w", i, err)
+		}
+		if err := validateRowOrder(m); err != nil {
+			return fmt.Errorf("mapping %d: %w", i, err)
+		}
+		if err := validateReshape(m); err != nil {
+			return fmt.Errorf("mapping %d: %w", i, err)
+		}
+	}
+
+	if err := validateCSV(c.CSV); err != nil {
+		return fmt.Errorf("csv: %w", err)
+	}
+	if err := c.validateInputs(); err != nil {
+		return err
+	}
+	if err := c.validateProtection(); err != nil {
+		return err
+	}
+
+	for i, sheet := range c.OutputSheets {
+		if sheet.CreateIfNotExists {
+			if err := ValidateSheetName(sheet.Name); err != nil {
+				return fmt.Errorf("output_sheet %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateColumns checks the header-based column selection of a mapping
+func validateColumns(m Mapping) error {
+	if m.HeaderRow == 0 && !m.needsHeaders() {
+		return nil
+	}
+
+	_, sourceRange := parseReference(m.Source)
+	if !isRange(sourceRange) {
+		return fmt.Errorf("columns, header_row and columns given by header require a range source")
+	}
+	if m.HeaderRow < 0 {
+		return fmt.Errorf("header_row must be a row number")
+	}
+	if _, startRow, _, _, err := parseRangeCoords(sourceRange); err == nil && m.HeaderRow > startRow {
+		return fmt.Errorf("header_row %d is below the first row of the source range", m.HeaderRow)
+	}
+	for j, name := range m.Columns {
+		if headerKey(name) == "" {
+			return fmt.Errorf("columns[%d]: header cannot be empty", j)
+		}
+	}
+
+	return nil
+}
+
+// validateComputed checks the computed columns of a mapping
+func validateComputed(m Mapping) error {
+	if _, err := compileComputed(m); err != nil || len(m.Computed) == 0 {
+		return err
+	}
+
+	// Computed columns follow the copied columns, so their number must be known
+	_, sourceRange := parseReference(m.Source)
+	if !isRange(sourceRange) {
+		return fmt.Errorf("computed columns require a range source")
+	}
+	if _, _, endCol, _, err := parseRangeCoords(sourceRange); err == nil && endCol == 0 && len(m.Columns) == 0 {
+		return fmt.Errorf("computed columns require a last column in the source range, or columns")
+	}
+	return nil
+}
+
+// computedHeaders reports whether any computed column of the mapping has a header
+func (m Mapping) computedHeaders() bool {
+	for _, c := range m.Computed {
+		if c.Header != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// needsHeaders reports whether the mapping refers to any column by header
+func (m Mapping) needsHeaders() bool {
+	if len(m.Columns) > 0 || usesHeaders(m.Filters) {
+		return true
+	}
+	if m.Join != nil && m.Join.KeyHeader != "" {
+		return true
+	}
+	if m.Aggregate != nil && m.Aggregate.usesHeaders() {
+		return true
+	}
+	if len(m.DistinctOnHeaders) > 0 {
+		return true
+	}
+	// Unpivot and pivot take their titles from the header row
+	if m.Unpivot != nil || m.Pivot != nil {
+		return true
+	}
+	for _, key := range m.SortBy {
+		if key.Header != "" {
+			return true
+		}
+	}
+	for _, t := range m.Transforms {
+		if t.Header != "" {
+			return true
+		}
+	}
+	exprs, _ := compileComputed(m)
+	for _, expr := range exprs {
+		if expr.usesHeaders() {
+			return true
+		}
+	}
+	return false
+}
+
+func parseReference(ref string) (sheet, cellOrRange string) {
+	// The input alias selects the workbook, not the sheet
+	_, ref = splitInput(ref)
+
+	// Split by '!'
+	parts := splitReference(ref)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return "Sheet1", ref
+}
+
+func splitReference(ref string) []string {
+	for i, char := range ref {
+		if char == '!' {
+			return []string{ref[:i], ref[i+1:]}
+		}
+	}
+	return []string{ref}
+}
+
+// usedRange is the source range keyword for the used range of a sheet
+const usedRange = "used_range"
+
+func isRange(cellRef string) bool {
+	if isUsedRange(cellRef) {
+		return true
+	}
+	for _, char := range cellRef {
+		if char == ':' {
+			return true
+		}
+	}
+	return false
+}
+
+func isUsedRange(cellRef string) bool {
+	return strings.EqualFold(strings.TrimSpace(cellRef), usedRange)
+}
+
+// parseRangeCoords parses a range such as A1:C10. The end may be left open: A2:H and A:H
+// end at the last row with data, A2:* also at the last column with data.
+// An open end is returned as 0.
+func parseRangeCoords(rangeRef string) (startCol, startRow, endCol, endRow int, err error) {
+	start, end, ok := strings.Cut(rangeRef, ":")
+	if !ok {
+		return 0, 0, 0, 0, fmt.Errorf("invalid range format")
+	}
+
+	// A whole column starts at the first row
+	if isColumnName(start) {
+		if startCol, err = excelize.ColumnNameToNumber(start); err != nil {
+			return 0, 0, 0, 0, err
+		}
+		startRow = 1
+	} else if startCol, startRow, err = excelize.CellNameToCoordinates(start); err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	switch {
+	case end == "*":
+		return startCol, startRow, 0, 0, nil
+	case isColumnName(end):
+		if endCol, err = excelize.ColumnNameToNumber(end); err != nil {
+			return 0, 0, 0, 0, err
+		}
+	default:
+		if endCol, endRow, err = excelize.CellNameToCoordinates(end); err != nil {
+			return 0, 0, 0, 0, err
+		}
+	}
+
+	return startCol, startRow, endCol, endRow, nil
+}
+
+// isColumnName reports whether ref is a column name without a row number, such as AB
+func isColumnName(ref string) bool {
+	if ref == "" {
+		return false
+	}
+	for _, char := range ref {
+		if (char < 'A' || char > 'Z') && (char < 'a' || char > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesMask checks if a string matches a pattern with wildcards (*)
+// Example: matchesMask("abc123", "*3*") returns true
+func matchesMask(value, mask string) bool {
+	if mask == "" {
+		return true // empty mask matches everything
+	}
+
+	// Split mask by wildcards
+	parts := []string{}
+	current := ""
+	for _, char := range mask {
+		if char == '*' {
+			if current != "" {
+				parts = append(parts, current)
+				current = ""
+			}
+		} else {
+			current += string(char)
+		}
+	}
+	if current != "" {
+		parts = append(parts, current)
+	}
+
+	// If no wildcards, do exact match
+	if len(parts) == 0 {
+		return true
+	}
+	if len(parts) == 1 && mask[0] != '*' && mask[len(mask)-1] != '*' {
+		return value == mask
+	}
+
+	// Check if all parts exist in order
+	position := 0
+	for _, part := range parts {
+		index := -1
+		for i := position; i <= len(value)-len(part); i++ {
+			if value[i:i+len(part)] == part {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			return false
+		}
+		position = index + len(part)
+	}
+
+	// Check prefix and suffix
+	if len(mask) > 0 && mask[0] != '*' && len(parts) > 0 {
+		if len(value) < len(parts[0]) || value[:len(parts[0])] != parts[0] {
+			return false
+		}
+	}
+	if len(mask) > 0 && mask[len(mask)-1] != '*' && len(parts) > 0 {
+		lastPart := parts[len(parts)-1]
+		if len(value) < len(lastPart) || value[len(value)-len(lastPart):] != lastPart {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidateSheetName checks if the sheet name is valid for Excel
+// Sheet names must be 1-31 characters and cannot contain: [ ] : * ? / \
+func ValidateSheetName(name string) error {
+	if name == "" {
+		return fmt.Errorf("sheet name cannot be empty")
+	}
+
+	if len(name) > 31 {
+		return fmt.Errorf("sheet name cannot exceed 31 characters, got %d", len(name))
+	}
+
+	invalidChars := []rune{'[', ']', ':', '*', '?', '/', '\\'}
+	for _, char := range name {
+		for _, invalid := range invalidChars {
+			if char == invalid {
+				return fmt.Errorf("sheet name contains invalid character: '%c'", char)
+			}
+		}
+	}
+
+	return nil
+}
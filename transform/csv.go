@@ -0,0 +1,436 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Encodings of CSV files
+const (
+	EncodingUTF8   = "utf-8"
+	EncodingCP1251 = "cp1251"
+	EncodingKOI8R  = "koi8-r"
+)
+
+// csvSheetName is the virtual sheet a CSV file is read into
+const csvSheetName = "csv"
+
+// csvDelimiters are the delimiters tried when the delimiter is not configured, in order of preference
+var csvDelimiters = []rune{';', ',', '\t', '|'}
+
+// utf8BOM is the byte order mark some programs write at the start of UTF-8 files
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// CSVOptions controls how CSV and TSV files are read. Options left empty are detected from the file.
+type CSVOptions struct {
+	// Delimiter is a single character, "tab" for TSV files
+	Delimiter string `yaml:"delimiter,omitempty" json:"delimiter,omitempty"`
+	// Encoding is utf-8, cp1251 or koi8-r
+	Encoding string `yaml:"encoding,omitempty" json:"encoding,omitempty"`
+	// DecimalSeparator is "." or ","
+	DecimalSeparator string `yaml:"decimal_separator,omitempty" json:"decimal_separator,omitempty"`
+	// Quote is the quote character, '"' by default, "none" if fields are never quoted
+	Quote string `yaml:"quote,omitempty" json:"quote,omitempty"`
+	// Sheet is the name of the virtual sheet, csv by default
+	Sheet string `yaml:"sheet,omitempty" json:"sheet,omitempty"`
+	// Text keeps all values as text, numbers are not converted
+	Text bool `yaml:"text,omitempty" json:"text,omitempty"`
+}
+
+// forFile returns the options a file is read with: .tsv files are tab-delimited
+// unless a delimiter is configured
+func (o *CSVOptions) forFile(filename string) *CSVOptions {
+	if !strings.EqualFold(filepath.Ext(filename), ".tsv") || (o != nil && o.Delimiter != "") {
+		return o
+	}
+	tsv := CSVOptions{}
+	if o != nil {
+		tsv = *o
+	}
+	tsv.Delimiter = "tab"
+	return &tsv
+}
+
+// validateCSV checks the CSV options
+func validateCSV(o *CSVOptions) error {
+	if o == nil {
+		return nil
+	}
+	if _, err := o.delimiter(); err != nil {
+		return err
+	}
+	if _, err := o.quote(); err != nil {
+		return err
+	}
+	switch o.encoding() {
+	case "", EncodingUTF8, EncodingCP1251, EncodingKOI8R:
+	default:
+		return fmt.Errorf("encoding must be one of utf-8, cp1251, koi8-r")
+	}
+	switch o.DecimalSeparator {
+	case "", ".", ",":
+	default:
+		return fmt.Errorf(`decimal_separator must be "." or ","`)
+	}
+	if o.Sheet != "" {
+		if err := ValidateSheetName(o.Sheet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delimiter returns the configured delimiter, 0 if it is detected
+func (o *CSVOptions) delimiter() (rune, error) {
+	switch strings.ToLower(o.Delimiter) {
+	case "":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(o.Delimiter)
+	if size != len(o.Delimiter) || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("delimiter must be a single character or tab")
+	}
+	return r, nil
+}
+
+// quote returns the quote character, 0 if fields are not quoted
+func (o *CSVOptions) quote() (rune, error) {
+	switch strings.ToLower(o.Quote) {
+	case "":
+		return '"', nil
+	case "none":
+		return 0, nil
+	}
+	r, size := utf8.DecodeRuneInString(o.Quote)
+	if size != len(o.Quote) {
+		return 0, fmt.Errorf(`quote must be a single character or "none"`)
+	}
+	return r, nil
+}
+
+// encoding returns the canonical name of the configured encoding
+func (o *CSVOptions) encoding() string {
+	switch strings.ToLower(strings.ReplaceAll(o.Encoding, "_", "-")) {
+	case "":
+		return ""
+	case "utf-8", "utf8", "utf-8-bom":
+		return EncodingUTF8
+	case "cp1251", "windows-1251", "win1251":
+		return EncodingCP1251
+	case "koi8-r", "koi8r":
+		return EncodingKOI8R
+	}
+	return o.Encoding
+}
+
+// isText reports whether data looks like a text file rather than a binary one
+func isText(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8192)], 0) < 0
+}
+
+// readCSV reads a CSV file into a workbook with a single sheet
+func readCSV(data []byte, o *CSVOptions) (*sourceWorkbook, error) {
+	if o == nil {
+		o = &CSVOptions{}
+	}
+	text, err := decodeCSV(data, o.encoding())
+	if err != nil {
+		return nil, err
+	}
+
+	delimiter, _ := o.delimiter()
+	quote, _ := o.quote()
+	if delimiter == 0 {
+		delimiter = detectDelimiter(text, quote)
+	}
+	rows := parseCSV(text, delimiter, quote)
+
+	decimal := o.DecimalSeparator
+	if decimal == "" {
+		decimal = detectDecimalSeparator(rows, delimiter)
+	}
+	sheet := o.Sheet
+	if sheet == "" {
+		sheet = csvSheetName
+	}
+
+	file := excelize.NewFile()
+	defer file.Close()
+	if err := file.SetSheetName("Sheet1", sheet); err != nil {
+		return nil, err
+	}
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+	for r, fields := range rows {
+		cells := make([]interface{}, len(fields))
+		for i, field := range fields {
+			if n, ok := csvNumber(field, decimal); ok && !o.Text {
+				cells[i] = n
+			} else if field != "" {
+				cells[i] = field
+			}
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, r+1)
+		if err := stream.SetRow(cell, cells); err != nil {
+			return nil, fmt.Errorf("row %d: %w", r+1, err)
+		}
+	}
+	if err := stream.Flush(); err != nil {
+		return nil, err
+	}
+
+	// The package is read back so that sheets are streamed like those of .xlsx files
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	workbook, err := excelize.OpenReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	return &sourceWorkbook{File: workbook, data: buf.Bytes()}, nil
+}
+
+// decodeCSV converts the file to UTF-8. Without an encoding, UTF-8 is used if the file is valid
+// UTF-8, otherwise CP1251 or KOI8-R is chosen by the case of Cyrillic letters.
+func decodeCSV(data []byte, encoding string) (string, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if encoding == "" {
+		encoding = detectEncoding(data)
+	}
+
+	var decoder *charmap.Charmap
+	switch encoding {
+	case EncodingUTF8:
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("file is not valid UTF-8, set csv encoding")
+		}
+		return string(data), nil
+	case EncodingCP1251:
+		decoder = charmap.Windows1251
+	case EncodingKOI8R:
+		decoder = charmap.KOI8R
+	}
+	text, err := decoder.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", encoding, err)
+	}
+	return string(text), nil
+}
+
+// detectEncoding guesses the encoding of a Russian text. Lowercase letters are the most
+// frequent: CP1251 has them in 0xE0-0xFF and uppercase in 0xC0-0xDF, KOI8-R the other way round.
+func detectEncoding(data []byte) string {
+	if utf8.Valid(data) {
+		return EncodingUTF8
+	}
+	var low, high int
+	for _, b := range data {
+		switch {
+		case b >= 0xE0:
+			high++
+		case b >= 0xC0:
+			low++
+		}
+	}
+	if low > high {
+		return EncodingKOI8R
+	}
+	return EncodingCP1251
+}
+
+// detectDelimiter returns the delimiter found the same number of times on the first lines,
+// or the most frequent one on the first line
+func detectDelimiter(text string, quote rune) rune {
+	lines := parseCSVLines(text, quote, 20)
+	if len(lines) == 0 {
+		return ','
+	}
+
+	best, bestCount, bestConsistent := ',', 0, false
+	for _, d := range csvDelimiters {
+		count := strings.Count(lines[0], string(d))
+		if count == 0 {
+			continue
+		}
+		consistent := true
+		for _, line := range lines[1:] {
+			if strings.Count(line, string(d)) != count {
+				consistent = false
+				break
+			}
+		}
+		// Consistent delimiters win over more frequent ones
+		if (consistent && !bestConsistent) || (consistent == bestConsistent && count > bestCount) {
+			best, bestCount, bestConsistent = d, count, consistent
+		}
+	}
+	return best
+}
+
+// parseCSVLines returns up to n non-empty records of the text with quoted fields removed,
+// so that delimiters inside quotes are not counted
+func parseCSVLines(text string, quote rune, n int) []string {
+	var lines []string
+	var line strings.Builder
+	quoted := false
+	for _, r := range text {
+		switch {
+		case quote != 0 && r == quote:
+			quoted = !quoted
+		case quoted:
+		case r == '\n' || r == '\r':
+			if line.Len() > 0 {
+				lines = append(lines, line.String())
+				if len(lines) == n {
+					return lines
+				}
+			}
+			line.Reset()
+		default:
+			line.WriteRune(r)
+		}
+	}
+	if line.Len() > 0 {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+// parseCSV splits the text into records. Quoted fields may contain delimiters, line breaks
+// and doubled quotes. Lines may end with CRLF, LF or CR.
+func parseCSV(text string, delimiter, quote rune) [][]string {
+	var rows [][]string
+	var row []string
+	var field strings.Builder
+	quoted, wasQuoted := false, false
+
+	endField := func() {
+		row = append(row, field.String())
+		field.Reset()
+		wasQuoted = false
+	}
+	endRow := func() {
+		wasQuotedRow := wasQuoted
+		endField()
+		// A line without any value is an empty row
+		if len(row) == 1 && row[0] == "" && !wasQuotedRow {
+			row = nil
+		}
+		rows = append(rows, row)
+		row = nil
+	}
+
+	// next returns the rune after position i
+	next := func(i int) rune {
+		r, _ := utf8.DecodeRuneInString(text[i:])
+		return r
+	}
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		if quoted {
+			if r == quote {
+				if i < len(text) && next(i) == quote {
+					field.WriteRune(quote)
+					i += size
+				} else {
+					quoted = false
+				}
+				continue
+			}
+			field.WriteRune(r)
+			continue
+		}
+
+		switch {
+		case quote != 0 && r == quote && strings.TrimSpace(field.String()) == "":
+			field.Reset()
+			quoted, wasQuoted = true, true
+		case r == delimiter:
+			endField()
+		case r == '\r':
+			if i < len(text) && text[i] == '\n' {
+				i++
+			}
+			endRow()
+		case r == '\n':
+			endRow()
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if field.Len() > 0 || len(row) > 0 || quoted {
+		endRow()
+	}
+	return rows
+}
+
+// csvNumberPattern matches the numbers converted from CSV text. Values with leading zeros
+// and long digit strings such as codes and account numbers stay text.
+var csvNumberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]{0,14})(\.[0-9]+)?$`)
+
+// csvNumber parses a CSV value as a number with the given decimal separator.
+// Spaces are allowed as thousands separators.
+func csvNumber(value, decimal string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if decimal == "," {
+		if strings.Contains(value, ".") {
+			return 0, false
+		}
+		value = strings.ReplaceAll(value, ",", ".")
+	} else if strings.Contains(value, ",") {
+		return 0, false
+	}
+	value = strings.NewReplacer(" ", "", "\u00a0", "").Replace(value)
+	if !csvNumberPattern.MatchString(value) {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	return n, err == nil
+}
+
+// detectDecimalSeparator returns "," if more values look like numbers with a decimal comma
+// than with a decimal point. A comma delimiter cannot be a decimal separator.
+func detectDecimalSeparator(rows [][]string, delimiter rune) string {
+	if delimiter == ',' {
+		return "."
+	}
+	var comma, point int
+	for _, row := range rows {
+		for _, field := range row {
+			field = strings.TrimSpace(field)
+			switch {
+			case !strings.ContainsAny(field, ".,"):
+			case strings.Contains(field, ","):
+				if _, ok := csvNumber(field, ","); ok {
+					comma++
+				}
+			default:
+				if _, ok := csvNumber(field, "."); ok {
+					point++
+				}
+			}
+		}
+	}
+	if comma > point {
+		return ","
+	}
+	return "."
+}
@@ -0,0 +1,233 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestDetectDelimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want rune
+	}{
+		{"semicolon", "a;b;c\n1;2;3\n", ';'},
+		{"comma", "a,b,c\n1,2,3\n", ','},
+		{"tab", "a\tb\n1\t2\n", '\t'},
+		{"pipe", "a|b\n1|2\n", '|'},
+		{"consistent wins over frequent", "a;b,c,d\n1;2,3\n4;5\n", ';'},
+		{"decimal commas with semicolons", "name;price\nx;1,50\ny;2,75\n", ';'},
+		{"delimiters inside quotes ignored", "\"a;b;c\",d\n\"1;2\",3\n", ','},
+		{"single column", "a\nb\n", ','},
+		{"empty", "", ','},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectDelimiter(tt.text, '"'); got != tt.want {
+				t.Errorf("detectDelimiter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		quote rune
+		want  [][]string
+	}{
+		{"simple", "a;b\n1;2", '"', [][]string{{"a", "b"}, {"1", "2"}}},
+		{"CRLF and CR", "a;b\r\n1;2\r3;4\r\n", '"', [][]string{{"a", "b"}, {"1", "2"}, {"3", "4"}}},
+		{"empty line", "a\n\nb\n", '"', [][]string{{"a"}, nil, {"b"}}},
+		{"empty fields", ";a;\n", '"', [][]string{{"", "a", ""}}},
+		{"quoted delimiter and line break", "\"a;b\";\"c\nd\"\n", '"', [][]string{{"a;b", "c\nd"}}},
+		{"doubled quote", `"say ""hi""";x`, '"', [][]string{{`say "hi"`, "x"}}},
+		{"quoted empty field", "\"\"\n", '"', [][]string{{""}}},
+		{"quote inside a field", `5" disk;x`, '"', [][]string{{`5" disk`, "x"}}},
+		{"no quoting", `"a";b`, 0, [][]string{{`"a"`, "b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCSV(tt.text, ';', tt.quote); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCSV() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVNumber(t *testing.T) {
+	tests := []struct {
+		value   string
+		decimal string
+		want    float64
+		ok      bool
+	}{
+		{"42", ".", 42, true},
+		{"-3.25", ".", -3.25, true},
+		{" 7 ", ".", 7, true},
+		{"1 234.5", ".", 1234.5, true},
+		{"1 234,5", ",", 1234.5, true},
+		{"3,5", ",", 3.5, true},
+		{"3,5", ".", 0, false},
+		{"3.5", ",", 0, false},
+		{"1,234.5", ".", 0, false},
+		{"0.5", ".", 0.5, true},
+		{"007", ".", 0, false},
+		{"40817810099910004312", ".", 0, false},
+		{"1e5", ".", 0, false},
+		{"+1", ".", 0, false},
+		{"", ".", 0, false},
+		{"abc", ".", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := csvNumber(tt.value, tt.decimal); got != tt.want || ok != tt.ok {
+			t.Errorf("csvNumber(%q, %q) = %v, %v, want %v, %v", tt.value, tt.decimal, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDetectDecimalSeparator(t *testing.T) {
+	tests := []struct {
+		name      string
+		rows      [][]string
+		delimiter rune
+		want      string
+	}{
+		{"decimal comma", [][]string{{"x", "1,5"}, {"y", "2,25"}}, ';', ","},
+		{"decimal point", [][]string{{"x", "1.5"}, {"y", "2.25"}}, ';', "."},
+		{"integers only", [][]string{{"1", "2"}}, ';', "."},
+		{"comma delimiter", [][]string{{"1,5"}}, ',', "."},
+		{"dates do not count", [][]string{{"01.02.2023", "01.03.2023", "1,5"}}, '\t', ","},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectDecimalSeparator(tt.rows, tt.delimiter); got != tt.want {
+				t.Errorf("detectDecimalSeparator() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCSV(t *testing.T) {
+	const text = "Город;Сумма\nМосква;100\n"
+	cp1251, _ := charmap.Windows1251.NewEncoder().String(text)
+	koi8r, _ := charmap.KOI8R.NewEncoder().String(text)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		encoding string
+		want     string
+		wantErr  bool
+	}{
+		{"UTF-8", []byte(text), "", text, false},
+		{"UTF-8 with BOM", append(append([]byte{}, utf8BOM...), text...), "", text, false},
+		{"detected CP1251", []byte(cp1251), "", text, false},
+		{"detected KOI8-R", []byte(koi8r), "", text, false},
+		{"configured KOI8-R", []byte(koi8r), EncodingKOI8R, text, false},
+		{"configured UTF-8 on CP1251", []byte(cp1251), EncodingUTF8, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCSV(tt.data, tt.encoding)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeCSV() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decodeCSV() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    CSVOptions
+		wantErr bool
+	}{
+		{"empty", CSVOptions{}, false},
+		{"tab", CSVOptions{Delimiter: "tab", Encoding: "Windows-1251", DecimalSeparator: ","}, false},
+		{"escaped tab", CSVOptions{Delimiter: `\t`, Quote: "none"}, false},
+		{"long delimiter", CSVOptions{Delimiter: ";;"}, true},
+		{"line break delimiter", CSVOptions{Delimiter: "\n"}, true},
+		{"long quote", CSVOptions{Quote: "''"}, true},
+		{"unknown encoding", CSVOptions{Encoding: "utf-16"}, true},
+		{"decimal separator", CSVOptions{DecimalSeparator: ";"}, true},
+		{"sheet name", CSVOptions{Sheet: "a/b"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCSV(&tt.opts); (err != nil) != tt.wantErr {
+				t.Errorf("validateCSV() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCSVOptionsForFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     *CSVOptions
+		filename string
+		want     string
+	}{
+		{"csv", &CSVOptions{}, "data.csv", ""},
+		{"tsv", nil, "data.TSV", "tab"},
+		{"tsv keeps other options", &CSVOptions{Encoding: EncodingCP1251}, "data.tsv", "tab"},
+		{"configured delimiter wins", &CSVOptions{Delimiter: ";"}, "data.tsv", ";"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.opts.forFile(tt.filename)
+			delimiter := ""
+			if got != nil {
+				delimiter = got.Delimiter
+			}
+			if delimiter != tt.want {
+				t.Errorf("forFile(%q) delimiter = %q, want %q", tt.filename, delimiter, tt.want)
+			}
+			if tt.opts != nil && got.Encoding != tt.opts.Encoding {
+				t.Errorf("forFile(%q) encoding = %q, want %q", tt.filename, got.Encoding, tt.opts.Encoding)
+			}
+		})
+	}
+	opts := &CSVOptions{}
+	opts.forFile("data.tsv")
+	if opts.Delimiter != "" {
+		t.Error("forFile() changed the configured options")
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	// Commas in a .tsv file are part of the values, not delimiters
+	data := []byte("Название\tЦена\tСчёт\n\"Стол, дубовый\"\t1 200,50\t007\n")
+	src, err := openSource(data, "prices.tsv", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"A1", "Название"},
+		{"A2", "Стол, дубовый"},
+		{"B2", "1200.5"},
+		{"C2", "007"},
+	}
+	for _, tt := range tests {
+		got, err := src.GetCellValue(csvSheetName, tt.cell, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cell, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,1219 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ProgressFunc receives the completion percentage of a mapping, identified by its index
+type ProgressFunc func(mapping, percent int)
+
+// Engine applies a transformation configuration to source workbooks.
+// An Engine holds no state between transformations and may be used concurrently.
+type Engine struct {
+	config *Config
+
+	// Logger receives processing messages, log.Default() is used if nil
+	Logger *log.Logger
+	// TemplatesDir is searched for an output template named after output_filename.
+	// Templates are not used if it is empty.
+	TemplatesDir string
+	// Progress receives the completion percentage of every mapping, it may be nil
+	Progress ProgressFunc
+	// LookupDir holds the workbooks join mappings read with join.file.
+	// Lookup files are not used if it is empty.
+	LookupDir string
+	// Password opens encrypted source workbooks, it replaces the passwords of the configuration
+	Password string
+}
+
+// NewEngine validates the configuration and creates an engine for it.
+// The configuration must not be changed while the engine is in use.
+func NewEngine(config *Config) (*Engine, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+	return &Engine{config: config}, nil
+}
+
+// sourceWorkbook is a workbook the mappings read from
+type sourceWorkbook struct {
+	*excelize.File
+	// data is the package of a workbook read from memory, sheetCells streams it
+	data []byte
+	// date1904 selects the 1904 date system for date serials
+	date1904 bool
+	// styles copies the styles of the workbook to the output workbook
+	styles *styleCache
+}
+
+// Transform reads a .xlsx or .xls workbook from source, applies the configuration
+// and writes the output workbook to dest. Processing stops with ctx.Err() when ctx is canceled.
+func (e *Engine) Transform(ctx context.Context, source io.Reader, dest io.Writer) (*ProcessingReport, error) {
+	return e.TransformInputs(ctx, map[string]io.Reader{"": source}, dest)
+}
+
+// TransformInputs reads the input workbooks by alias, the default input has the empty alias,
+// applies the configuration and writes the output workbook to dest. Mappings reading
+// an optional input that is not provided are skipped. Inputs with a Name method, such as
+// *os.File, are read as TSV files if the name ends with .tsv.
+func (e *Engine) TransformInputs(ctx context.Context, inputs map[string]io.Reader, dest io.Writer) (*ProcessingReport, error) {
+	aliases := make([]string, 0, len(inputs))
+	for alias := range inputs {
+		aliases = append(aliases, alias)
+	}
+	if err := e.config.CheckInputs(aliases); err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]*sourceWorkbook, len(inputs))
+	defer func() {
+		for _, sourceFile := range sources {
+			sourceFile.Close()
+		}
+	}()
+	for alias, source := range inputs {
+		name := "source file"
+		if alias != "" {
+			name = "input " + alias
+		}
+		data, err := io.ReadAll(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		// Files opened with os.Open are named, the name tells .tsv files apart
+		var filename string
+		if named, ok := source.(interface{ Name() string }); ok {
+			filename = named.Name()
+		}
+		password, passwordErr := e.password(alias)
+		sourceFile, err := openSource(data, filename, e.config.csvOptions(alias), password)
+		if errors.Is(err, ErrPasswordRequired) && passwordErr != nil {
+			err = passwordErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		sources[alias] = sourceFile
+	}
+
+	return e.transform(ctx, sources, dest)
+}
+
+// TransformFile applies the configuration to an opened workbook and writes the output workbook to dest
+func (e *Engine) TransformFile(ctx context.Context, sourceFile *excelize.File, dest io.Writer) (*ProcessingReport, error) {
+	if err := e.config.CheckInputs([]string{""}); err != nil {
+		return nil, err
+	}
+	return e.transform(ctx, map[string]*sourceWorkbook{"": {File: sourceFile}}, dest)
+}
+
+func (e *Engine) transform(ctx context.Context, sources map[string]*sourceWorkbook, dest io.Writer) (*ProcessingReport, error) {
+	config := e.config
+
+	destFile, streamedSheets, err := e.openOutput()
+	if err != nil {
+		return nil, err
+	}
+	defer destFile.Close()
+
+	// Sheets created here are empty and can be written with a stream writer
+	output := newOutputWorkbook(destFile)
+	for _, name := range streamedSheets {
+		if err := output.streamSheet(name); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, sourceFile := range sources {
+		if props, err := sourceFile.GetWorkbookProps(); err == nil && props.Date1904 != nil {
+			sourceFile.date1904 = *props.Date1904
+		}
+		sourceFile.styles = newStyleCache(sourceFile.File, destFile)
+	}
+
+	// Apply mappings
+	report := &ProcessingReport{}
+	mappingReports := make([]*MappingReport, len(config.Mappings))
+	for i, mapping := range config.Mappings {
+		mappingReports[i] = newMappingReport(mapping)
+	}
+	if err := e.applyMappings(ctx, sources, output, mappingReports); err != nil {
+		return nil, err
+	}
+	for _, mappingReport := range mappingReports {
+		report.add(mappingReport)
+	}
+
+	if err := output.finish(); err != nil {
+		return nil, fmt.Errorf("failed to write output sheets: %w", err)
+	}
+
+	if config.ReportSheet {
+		if err := writeReportSheet(destFile, report); err != nil {
+			return nil, fmt.Errorf("failed to write report sheet: %w", err)
+		}
+	}
+
+	if format := config.outputFormat(); format != FormatXLSX {
+		if report.OutputFilename, err = exportData(destFile, format, config.OutputFilename, dest); err != nil {
+			return nil, fmt.Errorf("failed to save output file: %w", err)
+		}
+		return report, nil
+	}
+
+	var opts excelize.Options
+	if config.Protection != nil {
+		protected, protectOpts, err := config.Protection.protect(destFile)
+		if err != nil {
+			return nil, err
+		}
+		if protected != destFile {
+			defer protected.Close()
+		}
+		destFile, opts = protected, protectOpts
+	}
+
+	// The file name selects the content type of the package (.xlsx, .xlsm, ...)
+	destFile.Path = config.OutputFilename
+	if err := destFile.Write(dest, opts); err != nil {
+		return nil, fmt.Errorf("failed to save output file: %w", err)
+	}
+	report.OutputFilename = config.OutputFilename
+
+	return report, nil
+}
+
+// openOutput opens the template of the output workbook, or creates a new workbook
+// with the configured output sheets. It returns the sheets it created.
+func (e *Engine) openOutput() (*excelize.File, []string, error) {
+	config := e.config
+
+	// Check if template file exists in templates folder
+	if e.TemplatesDir != "" {
+		templatePath := filepath.Join(e.TemplatesDir, config.OutputFilename)
+		if _, err := os.Stat(templatePath); err == nil {
+			// Template exists - use it as base
+			e.logf("Using template file: %s", templatePath)
+			destFile, err := excelize.OpenFile(templatePath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to open template file: %w", err)
+			}
+			return destFile, nil, nil
+		}
+	}
+
+	// No template - create new file
+	e.logf("No template found, creating new file")
+	destFile := excelize.NewFile()
+	var createdSheets []string
+
+	// Create output sheets if needed
+	for _, sheet := range config.OutputSheets {
+		if sheet.CreateIfNotExists {
+			index, err := destFile.NewSheet(sheet.Name)
+			if err != nil {
+				destFile.Close()
+				return nil, nil, fmt.Errorf("failed to create sheet %s: %w", sheet.Name, err)
+			}
+			// Set as active sheet if it's the first one
+			if index == 1 {
+				destFile.SetActiveSheet(index)
+			}
+			createdSheets = append(createdSheets, sheet.Name)
+		}
+	}
+
+	// Delete default Sheet1 if we created custom sheets
+	if len(config.OutputSheets) > 0 {
+		destFile.DeleteSheet("Sheet1")
+	}
+
+	return destFile, createdSheets, nil
+}
+
+func (e *Engine) logf(format string, args ...interface{}) {
+	if e.Logger != nil {
+		e.Logger.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// fail records an error that stopped a mapping
+func (e *Engine) fail(report *MappingReport, err error) {
+	e.logf("Warning: failed to apply mapping %s -> %s: %v", report.Source, report.Destination, err)
+	report.addError("%v", err)
+}
+
+// applyMappings applies the mappings in order. Range mappings reading the same source sheet
+// are applied together, in a single pass over the sheet, when the first of them is reached.
+// A failed mapping is recorded in its report and does not stop the others,
+// only cancellation of ctx does.
+func (e *Engine) applyMappings(ctx context.Context, sources map[string]*sourceWorkbook, destFile *outputWorkbook, reports []*MappingReport) error {
+	mappings := e.config.Mappings
+	progress := e.Progress
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+
+	// Register where every mapping starts writing, so streamed rows are flushed only when complete
+	cursors := make([]*destCursor, len(mappings))
+	for i, mapping := range mappings {
+		destSheet, destCell := parseReference(mapping.Destination)
+		_, destRow, _ := excelize.CellNameToCoordinates(destCell)
+		if mapping.Mode == ModeAppend {
+			first, last := mapping.destColumns()
+			cursors[i] = destFile.reserveAppend(destSheet, destRow, first, last)
+		} else {
+			cursors[i] = destFile.reserve(destSheet, destRow)
+		}
+	}
+
+	applied := make([]bool, len(mappings))
+
+	for i, mapping := range mappings {
+		if applied[i] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Optional inputs that were not provided are skipped
+		input := mapping.input()
+		sourceFile := sources[input]
+		if sourceFile == nil {
+			applied[i] = true
+			e.logf("Mapping %s -> %s: skipped, input %s was not provided", mapping.Source, mapping.Destination, input)
+			cursors[i].release()
+			destFile.flush()
+			progress(i, 100)
+			continue
+		}
+
+		sourceSheet, sourceRange := parseReference(mapping.Source)
+		if !isRange(sourceRange) {
+			applied[i] = true
+			if mapping.Mode == ModeAppend {
+				mapping.Destination = e.appendDestination(destFile, mapping, cursors[i])
+			}
+			if err := applyMapping(sourceFile, destFile, mapping, sourceFile.styles, reports[i]); err != nil {
+				e.fail(reports[i], err)
+			}
+			cursors[i].release()
+			destFile.flush()
+			progress(i, 100)
+			continue
+		}
+
+		// Collect the range mappings reading this sheet. An append mapping writes below
+		// the rows of the earlier mappings writing to its sheet, and a mapping that may
+		// overwrite cells of an earlier one must write after it, so they wait for them.
+		var group []int
+		for j := i; j < len(mappings); j++ {
+			sheet, ref := parseReference(mappings[j].Source)
+			if applied[j] || mappings[j].input() != input || sheet != sourceSheet || !isRange(ref) {
+				continue
+			}
+			if j > i && mappings[j].Mode == ModeAppend && writesBefore(mappings, applied, i, j) {
+				continue
+			}
+			if j > i && overlapsBefore(mappings, applied, i, j) {
+				continue
+			}
+			group = append(group, j)
+		}
+
+		var copies []*rangeCopy
+		for _, j := range group {
+			applied[j] = true
+			rc, err := newRangeCopy(sourceFile, j, mappings[j], sourceFile.styles, reports[j], cursors[j])
+			if err != nil {
+				e.fail(reports[j], err)
+				cursors[j].release()
+				progress(j, 100)
+				continue
+			}
+			if mappings[j].Join != nil {
+				if rc.join, err = e.loadLookup(lookupSource(sources, sourceFile, mappings[j].Join), destFile, mappings[j].Join, rc.opts); err != nil {
+					e.fail(reports[j], fmt.Errorf("join: %w", err))
+					cursors[j].release()
+					progress(j, 100)
+					continue
+				}
+			}
+			if mappings[j].Mode == ModeAppend {
+				rc.destRow = destFile.appendRow(rc.cursor)
+				e.logf("Mapping %s -> %s: appending at row %d", rc.report.Source, rc.report.Destination, rc.destRow)
+			}
+			copies = append(copies, rc)
+		}
+
+		if err := e.copyRange(ctx, sourceFile, destFile, sourceSheet, copies, progress); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			for _, rc := range copies {
+				e.fail(rc.report, err)
+			}
+		}
+		for _, rc := range copies {
+			rc.cursor.release()
+			progress(rc.index, 100)
+			if !rc.failed {
+				rc.report.Range = rc.resolvedRange()
+				if rc.report.Range != rc.report.Source {
+					e.logf("Mapping %s -> %s: read source range %s", rc.report.Source, rc.report.Destination, rc.report.Range)
+				}
+			}
+		}
+		destFile.flush()
+	}
+
+	return nil
+}
+
+// writesBefore reports whether a mapping from i up to j, not applied yet, writes to the sheet of mapping j
+func writesBefore(mappings []Mapping, applied []bool, i, j int) bool {
+	destSheet, _ := parseReference(mappings[j].Destination)
+	for k := i; k < j; k++ {
+		sheet, _ := parseReference(mappings[k].Destination)
+		if !applied[k] && sheetKey(sheet) == sheetKey(destSheet) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlapsBefore reports whether a mapping from i up to j, not applied yet, may write to cells mapping j writes to
+func overlapsBefore(mappings []Mapping, applied []bool, i, j int) bool {
+	for k := i; k < j; k++ {
+		if !applied[k] && mappings[k].overlaps(mappings[j]) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps reports whether two mappings may write to the same output cells
+func (m Mapping) overlaps(other Mapping) bool {
+	sheet, _ := parseReference(m.Destination)
+	otherSheet, _ := parseReference(other.Destination)
+	if sheetKey(sheet) != sheetKey(otherSheet) {
+		return false
+	}
+	firstCol, lastCol := m.destColumns()
+	otherFirstCol, otherLastCol := other.destColumns()
+	firstRow, lastRow := m.destRows()
+	otherFirstRow, otherLastRow := other.destRows()
+	return firstCol <= otherLastCol && otherFirstCol <= lastCol &&
+		firstRow <= otherLastRow && otherFirstRow <= lastRow
+}
+
+// destRows returns the first and last output row of a mapping.
+// The last row is math.MaxInt if it depends on the data, appended rows may be anywhere.
+func (m Mapping) destRows() (first, last int) {
+	if m.Mode == ModeAppend {
+		return 1, math.MaxInt
+	}
+	_, destCell := parseReference(m.Destination)
+	_, first, _ = excelize.CellNameToCoordinates(destCell)
+
+	_, sourceRange := parseReference(m.Source)
+	if !isRange(sourceRange) {
+		return first, first
+	}
+	// Transposed, unpivoted and grouped rows depend on the data
+	if m.Transpose || m.Pivot != nil || m.Unpivot != nil || m.Aggregate != nil {
+		return first, math.MaxInt
+	}
+	_, startRow, _, endRow, err := parseRangeCoords(sourceRange)
+	if err != nil || endRow == 0 {
+		return first, math.MaxInt
+	}
+	return first, first + endRow - startRow
+}
+
+// appendDestination returns the destination of a single cell append mapping, below the used rows of its column
+func (e *Engine) appendDestination(destFile *outputWorkbook, mapping Mapping, cursor *destCursor) string {
+	destSheet, destCell := parseReference(mapping.Destination)
+	col, _, err := excelize.CellNameToCoordinates(destCell)
+	if err != nil {
+		return mapping.Destination
+	}
+	cell, _ := excelize.CoordinatesToCellName(col, destFile.appendRow(cursor))
+	e.logf("Mapping %s -> %s: appending at %s", mapping.Source, mapping.Destination, cell)
+	return destSheet + "!" + cell
+}
+
+// destColumns returns the first and last output column of a mapping.
+// The last column is math.MaxInt if it depends on the data.
+func (m Mapping) destColumns() (first, last int) {
+	_, destCell := parseReference(m.Destination)
+	first, _, _ = excelize.CellNameToCoordinates(destCell)
+
+	_, sourceRange := parseReference(m.Source)
+	if !isRange(sourceRange) {
+		return first, first
+	}
+	// Transposed copies and pivot tables grow to the right with the data
+	if m.Transpose || m.Pivot != nil {
+		return first, math.MaxInt
+	}
+	if m.Unpivot != nil {
+		return first, first + m.Unpivot.width() - 1
+	}
+	if m.Aggregate != nil {
+		return first, first + m.Aggregate.width() - 1
+	}
+	if len(m.Columns) > 0 {
+		return first, first + len(m.Columns) + m.Join.width() + len(m.Computed) - 1
+	}
+	startCol, _, endCol, _, err := parseRangeCoords(sourceRange)
+	if err != nil || endCol == 0 {
+		return first, math.MaxInt
+	}
+	return first, first + endCol - startCol + m.Join.width() + len(m.Computed)
+}
+
+// applyMapping copies a single cell mapping
+func applyMapping(sourceFile *sourceWorkbook, destFile *outputWorkbook, mapping Mapping, styles *styleCache, report *MappingReport) error {
+	// Parse source and destination (sheet!cell)
+	sourceSheet, sourceCell := parseReference(mapping.Source)
+	destSheet, destCell := parseReference(mapping.Destination)
+
+	src, err := readSourceCell(sourceFile.File, sourceSheet, sourceCell)
+	if err != nil {
+		return err
+	}
+
+	transforms, err := compileTransforms(mapping)
+	if err != nil {
+		return err
+	}
+	if len(transforms) > 0 {
+		col, row, _ := excelize.CellNameToCoordinates(sourceCell)
+		values := &rowValues{values: make([]string, col), file: sourceFile, sheet: sourceSheet, row: row}
+		values.values[col-1] = src.Value
+		if src, err = applyTransforms(transforms, src, col, values); err != nil {
+			return err
+		}
+	}
+
+	report.Range = inputReference(mapping.input(), sourceSheet+"!"+sourceCell)
+	report.RowsScanned, report.RowsMatched = 1, 1
+	if err := copyCellValue(destFile, src, destSheet, destCell, mapping.copyOptions(styles)); err != nil {
+		return err
+	}
+	report.CellsWritten++
+	return nil
+}
+
+// parseFloat attempts to parse a string as a float64
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+func copyCellValue(destFile *outputWorkbook, src sourceCell, destSheet, destCell string, opts copyOptions) error {
+	// Copy formula first: numeric formula results have no cell type
+	copied, err := copyCellFormula(destFile, src, destSheet, destCell, opts)
+	if err != nil {
+		return err
+	}
+	if !copied {
+		if err := copyCellData(destFile, src, destSheet, destCell); err != nil {
+			return err
+		}
+	}
+
+	// Copy cell style if possible
+	if err := copyCellStyle(destFile, src, destSheet, destCell, opts); err != nil {
+		return fmt.Errorf("failed to copy cell style: %w", err)
+	}
+
+	return nil
+}
+
+// copyCellData copies the value of a cell, preserving its type
+func copyCellData(destFile *outputWorkbook, src sourceCell, destSheet, destCell string) error {
+	// Dates and formatted numbers are written from the stored value, the style formats them again
+	if src.Raw != "" {
+		if src.Type == excelize.CellTypeBool {
+			if err := destFile.SetCellValue(destSheet, destCell, src.Raw == "1"); err != nil {
+				return fmt.Errorf("failed to set cell bool: %w", err)
+			}
+			return nil
+		}
+		if numValue, err := strconv.ParseFloat(src.Raw, 64); err == nil {
+			if err := destFile.SetCellFloat(destSheet, destCell, numValue, -1, 64); err != nil {
+				return fmt.Errorf("failed to set cell float: %w", err)
+			}
+			return nil
+		}
+	}
+
+	// Copy value based on type
+	switch src.Type {
+	case excelize.CellTypeNumber:
+		// Try to parse as float to preserve number type
+		if numValue, err := parseFloat(src.Value); err == nil {
+			if err := destFile.SetCellFloat(destSheet, destCell, numValue, -1, 64); err != nil {
+				return fmt.Errorf("failed to set cell float: %w", err)
+			}
+		} else {
+			// Fallback to string if parsing fails
+			if err := destFile.SetCellValue(destSheet, destCell, src.Value); err != nil {
+				return fmt.Errorf("failed to set cell value: %w", err)
+			}
+		}
+
+	case excelize.CellTypeBool:
+		boolValue := src.Value
+		if err := destFile.SetCellValue(destSheet, destCell, boolValue == "TRUE" || boolValue == "true" || boolValue == "1"); err != nil {
+			return fmt.Errorf("failed to set cell bool: %w", err)
+		}
+
+	case excelize.CellTypeFormula:
+		// Formula was not copied, keep the calculated value
+		if numValue, err := parseFloat(src.Value); err == nil {
+			if err := destFile.SetCellFloat(destSheet, destCell, numValue, -1, 64); err != nil {
+				return fmt.Errorf("failed to set cell float: %w", err)
+			}
+		} else if err := destFile.SetCellValue(destSheet, destCell, src.Value); err != nil {
+			return fmt.Errorf("failed to set cell value: %w", err)
+		}
+
+	default:
+		// String or other types
+		value := src.Value
+		// Try to detect if it's actually a number
+		if numValue, err := parseFloat(value); err == nil && value != "" {
+			if err := destFile.SetCellFloat(destSheet, destCell, numValue, -1, 64); err != nil {
+				return fmt.Errorf("failed to set cell float: %w", err)
+			}
+		} else {
+			if err := destFile.SetCellValue(destSheet, destCell, value); err != nil {
+				return fmt.Errorf("failed to set cell value: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// rangeCopy is the state of a range mapping while the rows of its source sheet are read
+type rangeCopy struct {
+	index       int
+	mapping     Mapping
+	sourceSheet string
+	destSheet   string
+	startCol    int
+	startRow    int
+	endCol      int
+	endRow      int
+	destCol     int
+	destRow     int
+	openCols    bool
+	openRows    bool
+	estimated   int
+	dataCol     int
+	dataRow     int
+	columns     []int
+	headerRow   int
+	bound       bool
+	failed      bool
+	stopped     bool
+	filter      rowFilter
+	transforms  []*transformStep
+	computed    []*expression
+	join        *lookupTable
+	joinKey     int
+	summary     summary
+	unpivot     *unpivotCopy
+	sortCols    []int
+	sorted      []*rowValues
+	distinct    []int
+	seen        map[string]bool
+	skipped     int
+	titleRow    int
+	dataRows    int
+	rowOffset   int
+	opts        copyOptions
+	report      *MappingReport
+	cursor      *destCursor
+}
+
+func newRangeCopy(sourceFile *sourceWorkbook, index int, mapping Mapping, styles *styleCache, report *MappingReport, cursor *destCursor) (*rangeCopy, error) {
+	sourceSheet, sourceRange := parseReference(mapping.Source)
+	destSheet, destCell := parseReference(mapping.Destination)
+
+	// Parse the range, open ends are 0
+	var startCol, startRow, endCol, endRow int
+	var err error
+	if isUsedRange(sourceRange) {
+		// The used range is found by a pass over the sheet: recorded ranges may be stale
+		var ok bool
+		if startCol, startRow, endCol, endRow, ok, err = scanUsedRange(sourceFile, sourceSheet); err != nil {
+			return nil, fmt.Errorf("failed to find the used range: %w", err)
+		}
+		if !ok {
+			startCol, startRow, endCol, endRow = 1, 1, 1, 0
+		}
+	} else if startCol, startRow, endCol, endRow, err = parseRangeCoords(sourceRange); err != nil {
+		return nil, fmt.Errorf("failed to parse range: %w", err)
+	}
+
+	// The used range recorded in the workbook estimates the progress of ranges ending with the data
+	estimated := 0
+	if endRow == 0 {
+		if _, _, _, dimEnd, ok := sheetDimension(sourceFile, sourceSheet); ok {
+			estimated = dimEnd
+		}
+	}
+
+	// Parse destination cell
+	destCol, destRow, err := excelize.CellNameToCoordinates(destCell)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse destination cell: %w", err)
+	}
+
+	filter, err := compileFilters(mapping)
+	if err != nil {
+		return nil, err
+	}
+	transforms, err := compileTransforms(mapping)
+	if err != nil {
+		return nil, err
+	}
+	computed, err := compileComputed(mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &rangeCopy{
+		index:       index,
+		mapping:     mapping,
+		sourceSheet: sourceSheet,
+		destSheet:   destSheet,
+		startCol:    startCol,
+		startRow:    startRow,
+		endCol:      endCol,
+		endRow:      endRow,
+		openCols:    endCol == 0,
+		openRows:    endRow == 0,
+		estimated:   estimated,
+		destCol:     destCol,
+		destRow:     destRow,
+		filter:      filter,
+		transforms:  transforms,
+		computed:    computed,
+		opts:        mapping.copyOptions(styles),
+		report:      report,
+		cursor:      cursor,
+	}
+
+	switch {
+	case mapping.Aggregate != nil:
+		rc.summary = newAggregator(mapping.Aggregate)
+	case mapping.Pivot != nil:
+		rc.summary = newPivotTable(mapping.Pivot)
+	case mapping.Unpivot != nil:
+		rc.unpivot = newUnpivotCopy(mapping.Unpivot)
+	}
+	// Reshaped formulas would refer to the wrong cells, their values are copied unless verbatim is set explicitly
+	if mapping.reshapes() && rc.opts.Formulas != FormulasVerbatim {
+		rc.opts.Formulas = FormulasValues
+	}
+	for _, key := range mapping.SortBy {
+		col, _ := excelize.ColumnNameToNumber(key.Column)
+		rc.sortCols = append(rc.sortCols, col)
+	}
+	if len(mapping.DistinctOn)+len(mapping.DistinctOnHeaders) > 0 {
+		for _, name := range mapping.DistinctOn {
+			col, _ := excelize.ColumnNameToNumber(name)
+			rc.distinct = append(rc.distinct, col)
+		}
+		rc.seen = make(map[string]bool)
+	}
+
+	// Columns given by header are resolved when the header row is read.
+	// Summaries also take the titles of their group columns from header_row.
+	rc.headerRow = mapping.HeaderRow
+	if rc.headerRow == 0 && mapping.needsHeaders() {
+		rc.headerRow = startRow
+	}
+	if rc.openRows {
+		rc.endRow = math.MaxInt
+	}
+	// The header row inside the range is copied as is, computed columns write their headers to it.
+	// It is not filtered, sorted, joined or counted as a matched row.
+	if rc.headerRow == startRow || mapping.computedHeaders() {
+		rc.titleRow = startRow
+	}
+	if mapping.Join != nil && mapping.Join.Key != "" {
+		rc.joinKey, _ = excelize.ColumnNameToNumber(mapping.Join.Key)
+	}
+	if len(mapping.Columns) == 0 {
+		for c := startCol; c <= endCol; c++ {
+			rc.columns = append(rc.columns, c)
+		}
+	}
+
+	return rc, nil
+}
+
+// extendColumns adds the columns of a range without a last column that the row reaches
+func (rc *rangeCopy) extendColumns(row []string) {
+	if !rc.openCols || len(rc.mapping.Columns) > 0 {
+		return
+	}
+	for c := rc.startCol + len(rc.columns); c <= len(row); c++ {
+		rc.columns = append(rc.columns, c)
+	}
+}
+
+// lastValue returns the last copied column the row has a value in, or 0 for a blank row
+func (rc *rangeCopy) lastValue(row []string) int {
+	last := 0
+	for _, c := range rc.columns {
+		if c <= len(row) && c > last && row[c-1] != "" {
+			last = c
+		}
+	}
+	return last
+}
+
+// percent estimates the progress of the mapping after row r
+func (rc *rangeCopy) percent(r int) int {
+	end := rc.endRow
+	if rc.openRows {
+		if rc.estimated == 0 {
+			return 0
+		}
+		if r >= rc.estimated {
+			return 99
+		}
+		end = rc.estimated
+	}
+	return (r - rc.startRow + 1) * 100 / (end - rc.startRow + 1)
+}
+
+// resolvedRange returns the source range the mapping has read, with open ends
+// replaced by the last row and column with data
+func (rc *rangeCopy) resolvedRange() string {
+	endCol, endRow := rc.endCol, rc.endRow
+	if rc.openCols {
+		endCol = max(rc.dataCol, rc.startCol)
+	}
+	if rc.openRows || rc.stopped {
+		endRow = max(rc.dataRow, rc.startRow)
+	}
+	start, _ := excelize.CoordinatesToCellName(rc.startCol, rc.startRow)
+	end, _ := excelize.CoordinatesToCellName(endCol, endRow)
+	return inputReference(rc.mapping.input(), rc.sourceSheet+"!"+start+":"+end)
+}
+
+// bindHeaders resolves the columns and filters given by header
+func (rc *rangeCopy) bindHeaders(row []string) error {
+	headers := newHeaderIndex(rc.sourceSheet, rc.headerRow, row)
+	if len(rc.mapping.Columns) > 0 {
+		columns, err := headers.columns(rc.mapping.Columns)
+		if err != nil {
+			return err
+		}
+		rc.columns = columns
+	}
+	if rc.filter != nil {
+		if err := rc.filter.bind(headers); err != nil {
+			return err
+		}
+	}
+	for _, step := range rc.transforms {
+		if err := step.bind(headers); err != nil {
+			return err
+		}
+	}
+	for _, expr := range rc.computed {
+		if err := expr.bind(headers); err != nil {
+			return err
+		}
+	}
+	if rc.mapping.Join != nil && rc.mapping.Join.KeyHeader != "" {
+		col, err := headers.column(rc.mapping.Join.KeyHeader)
+		if err != nil {
+			return fmt.Errorf("join: %w", err)
+		}
+		rc.joinKey = col
+	}
+	if rc.summary != nil {
+		if err := rc.summary.bind(headers, row); err != nil {
+			return err
+		}
+	}
+	if rc.unpivot != nil {
+		if err := rc.unpivot.bind(headers, row); err != nil {
+			return err
+		}
+	}
+	for i, key := range rc.mapping.SortBy {
+		if key.Header == "" {
+			continue
+		}
+		col, err := headers.column(key.Header)
+		if err != nil {
+			return fmt.Errorf("sort_by: %w", err)
+		}
+		rc.sortCols[i] = col
+	}
+	if len(rc.mapping.DistinctOnHeaders) > 0 {
+		columns, err := headers.columns(rc.mapping.DistinctOnHeaders)
+		if err != nil {
+			return fmt.Errorf("distinct_on_headers: %w", err)
+		}
+		rc.distinct = columns
+	}
+	rc.bound = true
+	return nil
+}
+
+// copyRow copies one source row if it matches the mapping filter.
+// Cell types, styles and formulas come from cells, or are looked up if cells is nil.
+func (rc *rangeCopy) copyRow(sourceFile *sourceWorkbook, destFile *outputWorkbook, r int, row []string, cells *sheetRow) {
+	rc.report.RowsScanned++
+	values := &rowValues{values: row, cells: cells, file: sourceFile, sheet: rc.sourceSheet, row: r}
+
+	// Apply filters if specified
+	title := r == rc.titleRow
+	if !title && rc.filter != nil && !rc.filter.match(values) {
+		return
+	}
+
+	if !title && rc.duplicate(values) {
+		rc.report.Duplicates++
+		return
+	}
+
+	// Sorted rows are kept until all rows are read
+	if !title && len(rc.sortCols) > 0 {
+		rc.bufferRow(values)
+		return
+	}
+	rc.writeRow(sourceFile, destFile, values, title)
+}
+
+// writeRow writes a source row that passed the filters and the distinct check,
+// or the header row of the range
+func (rc *rangeCopy) writeRow(sourceFile *sourceWorkbook, destFile *outputWorkbook, values *rowValues, title bool) {
+	r, row, cells := values.row, values.values, values.cells
+
+	// Rows of an inner join without a lookup row are skipped
+	var joined []sourceCell
+	if rc.join != nil && !title {
+		key, _ := values.text(rc.joinKey)
+		var found bool
+		if joined, found = rc.join.find(key); !found {
+			rc.report.addUnmatched(key)
+			if rc.mapping.Join.Type == JoinInner {
+				return
+			}
+		}
+	}
+
+	if !title {
+		rc.report.RowsMatched++
+	}
+
+	// Summaries only collect the rows, the table is written by finish
+	if rc.summary != nil {
+		if title {
+			return
+		}
+		rc.dataRows++
+		if err := rc.summary.add(values); err != nil {
+			rc.report.addError("row %d: %v", r, err)
+		}
+		return
+	}
+
+	if !title {
+		if rc.skipped < rc.mapping.Skip {
+			rc.skipped++
+			return
+		}
+		rc.dataRows++
+	}
+
+	if rc.unpivot != nil {
+		rc.writeUnpivot(destFile, values, title)
+		return
+	}
+
+	// Columns are written in the configured order, missing trailing cells are left empty
+	for i, c := range rc.columns {
+		if c > len(row) {
+			continue
+		}
+		sourceCellName, _ := excelize.CoordinatesToCellName(c, r)
+		destCellName := rc.destCell(i)
+
+		var src sourceCell
+		var err error
+		if cells != nil {
+			src = cells.sourceCell(rc.sourceSheet, c, row[c-1])
+		} else {
+			src, err = readSourceCell(sourceFile.File, rc.sourceSheet, sourceCellName)
+		}
+
+		if err == nil && len(rc.transforms) > 0 && !title {
+			// A value that cannot be transformed is reported and copied unchanged
+			var transformed sourceCell
+			if transformed, err = applyTransforms(rc.transforms, src, c, values); err != nil {
+				rc.report.addError("%s: %v", sourceCellName, err)
+			} else {
+				src = transformed
+			}
+			err = nil
+		}
+
+		// Copy cell with type preservation
+		if err == nil {
+			err = copyCellValue(destFile, src, rc.destSheet, destCellName, rc.opts)
+		}
+		if err != nil {
+			rc.report.addError("%s -> %s: %v", sourceCellName, destCellName, err)
+		} else {
+			rc.report.CellsWritten++
+		}
+	}
+
+	// Lookup columns follow the copied columns, their headers go to the header row
+	joinCol := len(rc.columns)
+	if rc.join != nil {
+		rc.writeJoined(destFile, joinCol, joined, title)
+	}
+
+	// Computed columns follow the copied and lookup columns
+	for i, expr := range rc.computed {
+		destCellName := rc.destCell(joinCol + rc.mapping.Join.width() + i)
+		if title && expr.header == "" {
+			continue
+		}
+		if err := rc.writeComputed(destFile, expr, destCellName, values, title); err != nil {
+			rc.report.addError("%s: %v", destCellName, err)
+		} else {
+			rc.report.CellsWritten++
+		}
+	}
+	rc.nextRow()
+}
+
+// destCell returns the output cell of column i of the current output row.
+// A transposed copy writes every output row to a column.
+func (rc *rangeCopy) destCell(i int) string {
+	col, row := rc.destCol+i, rc.destRow+rc.rowOffset
+	if rc.mapping.Transpose {
+		col, row = rc.destCol+rc.rowOffset, rc.destRow+i
+	}
+	name, _ := excelize.CoordinatesToCellName(col, row)
+	return name
+}
+
+// nextRow moves to the next output row
+func (rc *rangeCopy) nextRow() {
+	rc.rowOffset++
+	// A transposed copy writes to all its rows until it finishes
+	if !rc.mapping.Transpose {
+		rc.cursor.moveTo(rc.destRow + rc.rowOffset)
+	}
+}
+
+// writeCell writes a cell to column i of the current output row. The cell is copied
+// with opts, or as a plain value if opts is nil.
+func (rc *rangeCopy) writeCell(destFile *outputWorkbook, i int, src sourceCell, opts *copyOptions) {
+	destCellName := rc.destCell(i)
+	var err error
+	if opts != nil {
+		err = copyCellValue(destFile, src, rc.destSheet, destCellName, *opts)
+	} else {
+		err = copyCellData(destFile, src, rc.destSheet, destCellName)
+	}
+	if err != nil {
+		rc.report.addError("%s: %v", destCellName, err)
+	} else {
+		rc.report.CellsWritten++
+	}
+}
+
+// writeJoined writes the lookup columns of a row, or their headers in the header row
+func (rc *rangeCopy) writeJoined(destFile *outputWorkbook, first int, cells []sourceCell, title bool) {
+	if title {
+		for i, header := range rc.join.headers {
+			rc.writeCell(destFile, first+i, sourceCell{Type: excelize.CellTypeInlineString, Value: header}, nil)
+		}
+		return
+	}
+
+	for i, src := range cells {
+		if src.Value == "" && src.Formula == "" {
+			continue
+		}
+		rc.writeCell(destFile, first+i, src, &rc.join.opts)
+	}
+}
+
+// writeComputed writes the value of a computed column, or its header in the header row
+func (rc *rangeCopy) writeComputed(destFile *outputWorkbook, expr *expression, destCell string, values *rowValues, title bool) error {
+	src := sourceCell{Type: excelize.CellTypeInlineString}
+	if title {
+		src.Value = expr.header
+		return copyCellData(destFile, src, rc.destSheet, destCell)
+	}
+
+	value, err := expr.eval(&exprContext{row: values, index: rc.dataRows})
+	if err != nil {
+		return err
+	}
+	if n, ok := value.(float64); ok {
+		src.Type, src.Value = excelize.CellTypeNumber, formatNumber(n)
+	} else {
+		src.Value = exprText(value)
+	}
+	return copyCellData(destFile, src, rc.destSheet, destCell)
+}
+
+// copyRange streams the rows of sourceSheet once and hands every row to the range
+// mappings that cover it. Reading stops after the last row needed by any mapping,
+// so the sheet is never loaded into memory as a whole. Cell values come from the
+// excelize row iterator, cell types, styles and formulas from sheetCells.
+func (e *Engine) copyRange(ctx context.Context, sourceFile *sourceWorkbook, destFile *outputWorkbook, sourceSheet string, copies []*rangeCopy, progress ProgressFunc) error {
+	lastRow := 0
+	for _, rc := range copies {
+		if rc.endRow > lastRow {
+			lastRow = rc.endRow
+		}
+	}
+	if lastRow == 0 {
+		return nil
+	}
+
+	rows, err := sourceFile.Rows(sourceSheet)
+	if err != nil {
+		return fmt.Errorf("failed to get rows: %w", err)
+	}
+	defer rows.Close()
+
+	sheet, err := openSheetCells(sourceFile, sourceSheet)
+	if err != nil {
+		// Slow path: every cell is looked up in the loaded worksheet
+		e.logf("Warning: cannot stream cells of sheet %s, looking them up one by one: %v", sourceSheet, err)
+	} else {
+		defer sheet.Close()
+	}
+
+	for r := 1; r <= lastRow && rows.Next(); r++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		row, err := rows.Columns()
+		if err != nil {
+			return fmt.Errorf("failed to read row %d: %w", r, err)
+		}
+
+		var cells *sheetRow
+		if sheet != nil {
+			if cells, err = sheet.row(r); err != nil {
+				return fmt.Errorf("failed to read row %d: %w", r, err)
+			}
+		}
+
+		for _, rc := range copies {
+			if rc.failed || rc.stopped {
+				continue
+			}
+			if r == rc.headerRow {
+				if err := rc.bindHeaders(row); err != nil {
+					e.stopCopy(rc, err, progress)
+					continue
+				}
+			}
+			if r >= rc.startRow && r <= rc.endRow {
+				rc.extendColumns(row)
+				if last := rc.lastValue(row); last > 0 {
+					rc.dataRow, rc.dataCol = r, max(rc.dataCol, last)
+				} else if rc.mapping.StopAtBlank {
+					// The table ends at the first blank row
+					rc.stopped = true
+					rc.finish(destFile)
+					rc.cursor.release()
+					progress(rc.index, 100)
+					continue
+				}
+				rc.copyRow(sourceFile, destFile, r, row, cells)
+				if rc.limitReached() {
+					// A top-N copy is complete once it has written its rows
+					rc.stopped = true
+					rc.cursor.release()
+					progress(rc.index, 100)
+					continue
+				}
+				progress(rc.index, rc.percent(r))
+			}
+		}
+		destFile.flush()
+
+		// Ranges ending with the data are complete once every mapping has stopped
+		pending := false
+		for _, rc := range copies {
+			if !rc.failed && !rc.stopped && r < rc.endRow {
+				pending = true
+			}
+		}
+		if !pending {
+			break
+		}
+	}
+	if err := rows.Error(); err != nil {
+		return err
+	}
+
+	for _, rc := range copies {
+		if rc.headerRow > 0 && !rc.bound && !rc.failed {
+			e.stopCopy(rc, fmt.Errorf("header row %d not found in sheet %s", rc.headerRow, sourceSheet), progress)
+		}
+	}
+	for _, rc := range copies {
+		if !rc.failed && !rc.stopped {
+			rc.finish(destFile)
+		}
+	}
+	return nil
+}
+
+// finish writes the output a range mapping produces once all its rows are read
+func (rc *rangeCopy) finish(destFile *outputWorkbook) {
+	if rc.summary != nil {
+		rc.summary.write(destFile, rc)
+	}
+	if len(rc.sortCols) > 0 {
+		rc.writeSorted(destFile)
+	}
+}
+
+// stopCopy fails a range mapping while the other mappings of the sheet go on
+func (e *Engine) stopCopy(rc *rangeCopy, err error, progress ProgressFunc) {
+	rc.failed = true
+	e.fail(rc.report, err)
+	rc.cursor.release()
+	progress(rc.index, 100)
+}
@@ -0,0 +1,243 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// testWorkbook builds a workbook with the rows of every sheet written from A1
+func testWorkbook(t *testing.T, sheets map[string][][]interface{}) *excelize.File {
+	t.Helper()
+	file := excelize.NewFile()
+	t.Cleanup(func() { file.Close() })
+	for name, rows := range sheets {
+		if _, err := file.NewSheet(name); err != nil {
+			t.Fatal(err)
+		}
+		for i, row := range rows {
+			cell, _ := excelize.CoordinatesToCellName(1, i+1)
+			if err := file.SetSheetRow(name, cell, &row); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return file
+}
+
+// testEngine creates an engine that does not log
+func testEngine(t *testing.T, config *Config) *Engine {
+	t.Helper()
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Logger = log.New(io.Discard, "", 0)
+	return engine
+}
+
+// testTransform runs the configuration on the source workbook and opens the output workbook
+func testTransform(t *testing.T, config *Config, source *excelize.File) (*excelize.File, *ProcessingReport) {
+	t.Helper()
+	return testRun(t, testEngine(t, config), source)
+}
+
+// testRun runs the engine on the source workbook and opens the output workbook
+func testRun(t *testing.T, engine *Engine, source *excelize.File) (*excelize.File, *ProcessingReport) {
+	t.Helper()
+	var in, out bytes.Buffer
+	if err := source.Write(&in); err != nil {
+		t.Fatal(err)
+	}
+	report, err := engine.Transform(context.Background(), &in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := excelize.OpenReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file, report
+}
+
+// testRows returns the displayed values of an output sheet
+func testRows(t *testing.T, file *excelize.File, sheet string) [][]string {
+	t.Helper()
+	rows, err := file.GetRows(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestTransformStoredValues(t *testing.T) {
+	source := excelize.NewFile()
+	defer source.Close()
+	amountStyle, _ := source.NewStyle(&excelize.Style{NumFmt: 4})
+	dateStyle, _ := source.NewStyle(&excelize.Style{NumFmt: 14})
+	source.SetSheetRow("Sheet1", "A1", &[]interface{}{1234.5, 45000, true, "text"})
+	source.SetCellStyle("Sheet1", "A1", "A1", amountStyle)
+	source.SetCellStyle("Sheet1", "B1", "B1", dateStyle)
+
+	// The range is streamed from the package, the single cell is read with excelize
+	output, _ := testTransform(t, &Config{
+		OutputFilename: "out.xlsx",
+		Mappings: []Mapping{
+			{Source: "Sheet1!A1:D1", Destination: "Sheet1!A1"},
+			{Source: "Sheet1!B1", Destination: "Sheet1!B2"},
+		},
+	}, source)
+
+	tests := []struct {
+		cell     string
+		wantType excelize.CellType
+		want     string
+		numFmt   int
+	}{
+		{"A1", excelize.CellTypeUnset, "1234.5", 4},
+		{"B1", excelize.CellTypeUnset, "45000", 14},
+		{"C1", excelize.CellTypeBool, "1", 0},
+		{"D1", excelize.CellTypeSharedString, "text", 0},
+		{"B2", excelize.CellTypeUnset, "45000", 14},
+	}
+	for _, tt := range tests {
+		cellType, err := output.GetCellType("Sheet1", tt.cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := output.GetCellValue("Sheet1", tt.cell, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cellType != tt.wantType || got != tt.want {
+			t.Errorf("%s = %q of type %d, want %q of type %d", tt.cell, got, cellType, tt.want, tt.wantType)
+		}
+		styleID, _ := output.GetCellStyle("Sheet1", tt.cell)
+		if style, err := output.GetStyle(styleID); err != nil || style.NumFmt != tt.numFmt {
+			t.Errorf("%s number format = %v, %v, want %d", tt.cell, style, err, tt.numFmt)
+		}
+	}
+}
+
+func TestTransformHeaderRow(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{
+		"Sheet1": {
+			{"ID", "Name", "Status", "Amount"},
+			{3, "c", "paid", 30},
+			{1, "a", "open", 10},
+			{2, "b", "paid", 20},
+		},
+		"Ref": {{"ID", "Region"}, {1, "North"}, {3, "East"}},
+	})
+
+	// Columns are given by letter, header_row alone keeps the header out of the data
+	output, report := testTransform(t, &Config{
+		OutputFilename: "out.xlsx",
+		Mappings: []Mapping{{
+			Source:      "Sheet1!A1:D4",
+			Destination: "Sheet1!A1",
+			HeaderRow:   1,
+			Filters:     []Filter{{Column: "C", Value: "paid"}},
+			SortBy:      []SortKey{{Column: "A"}},
+			Join:        &Join{Source: "Ref!A1:B3", Key: "A", LookupKey: "A", Columns: []string{"B"}},
+		}},
+	}, source)
+
+	want := [][]string{
+		{"ID", "Name", "Status", "Amount"},
+		{"2", "b", "paid", "20"},
+		{"3", "c", "paid", "30", "East"},
+	}
+	if got := testRows(t, output, "Sheet1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+	if got := report.Mappings[0].UnmatchedKeys; !reflect.DeepEqual(got, []string{"2"}) {
+		t.Errorf("unmatched keys = %q, want [2]", got)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	source := excelize.NewFile()
+	defer source.Close()
+	dateStyle, _ := source.NewStyle(&excelize.Style{NumFmt: 14})
+	source.SetSheetRow("Sheet1", "A1", &[]interface{}{"text", 42, 1.5, true, 45000, 84})
+	source.SetCellStyle("Sheet1", "E1", "E1", dateStyle)
+	source.SetCellFormula("Sheet1", "F1", "B1*2")
+
+	type cell struct {
+		value    string
+		cellType excelize.CellType
+		formula  string
+	}
+	// Text is written to the streamed sheet as inline strings
+	tests := []struct {
+		name     string
+		mappings []Mapping
+		want     map[string]cell
+	}{
+		{
+			name:     "range",
+			mappings: []Mapping{{Source: "Sheet1!A1:F1", Destination: "Out!B2"}},
+			want: map[string]cell{
+				"B2": {"text", excelize.CellTypeInlineString, ""},
+				"C2": {"42", excelize.CellTypeUnset, ""},
+				"D2": {"1.5", excelize.CellTypeUnset, ""},
+				"E2": {"1", excelize.CellTypeBool, ""},
+				"F2": {"45000", excelize.CellTypeUnset, ""},
+				"G2": {"", excelize.CellTypeFormula, "B1*2"},
+			},
+		},
+		{
+			name:     "translated formulas",
+			mappings: []Mapping{{Source: "Sheet1!A1:F1", Destination: "Out!B2", Formulas: FormulasTranslate}},
+			want:     map[string]cell{"G2": {"", excelize.CellTypeFormula, "C2*2"}},
+		},
+		{
+			name:     "formula values",
+			mappings: []Mapping{{Source: "Sheet1!F1", Destination: "Out!A1", Formulas: FormulasValues}},
+			want:     map[string]cell{"A1": {"84", excelize.CellTypeUnset, ""}},
+		},
+		{
+			name: "single cells",
+			mappings: []Mapping{
+				{Source: "Sheet1!D1", Destination: "Out!A1"},
+				{Source: "Sheet1!A1", Destination: "Out!A2"},
+				{Source: "Sheet1!E1", Destination: "Out!A3"},
+				{Source: "Sheet1!F1", Destination: "Out!G4", Formulas: FormulasTranslate},
+			},
+			want: map[string]cell{
+				"A1": {"1", excelize.CellTypeBool, ""},
+				"A2": {"text", excelize.CellTypeInlineString, ""},
+				"A3": {"45000", excelize.CellTypeUnset, ""},
+				"G4": {"", excelize.CellTypeFormula, "C4*2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, report := testTransform(t, &Config{
+				OutputFilename: "out.xlsx",
+				OutputSheets:   []OutputSheet{{Name: "Out", CreateIfNotExists: true}},
+				Mappings:       tt.mappings,
+			}, source)
+			if report.ErrorCount > 0 {
+				t.Errorf("error count = %d", report.ErrorCount)
+			}
+			for name, want := range tt.want {
+				var got cell
+				got.value, _ = output.GetCellValue("Out", name, excelize.Options{RawCellValue: true})
+				got.cellType, _ = output.GetCellType("Out", name)
+				got.formula, _ = output.GetCellFormula("Out", name)
+				if got != want {
+					t.Errorf("%s = %+v, want %+v", name, got, want)
+				}
+			}
+		})
+	}
+}
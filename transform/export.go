@@ -0,0 +1,413 @@
+package transform
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Output formats of a transformation
+const (
+	FormatXLSX   = "xlsx"
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatODS    = "ods"
+)
+
+// ValidateOutputFormat checks an output format, empty is the workbook format
+func ValidateOutputFormat(format string) error {
+	switch format {
+	case "", FormatXLSX, FormatCSV, FormatJSON, FormatNDJSON, FormatODS:
+		return nil
+	}
+	return fmt.Errorf("output_format must be one of xlsx, ods, csv, json, ndjson")
+}
+
+// outputFormat returns the output format of the configuration
+func (c *Config) outputFormat() string {
+	if c.OutputFormat == "" {
+		return FormatXLSX
+	}
+	return c.OutputFormat
+}
+
+// exportData writes the visible sheets of the output workbook to w in a data format or as an
+// .ods package and returns the output file name with the extension of the format. CSV and NDJSON
+// sheets are zipped if there are several, a JSON file always holds an object with an array per sheet.
+func exportData(destFile *excelize.File, format, filename string, w io.Writer) (string, error) {
+	// The workbook is read back like a source, so that streamed sheets are complete
+	buf, err := destFile.WriteToBuffer()
+	if err != nil {
+		return "", err
+	}
+	book, err := excelize.OpenReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return "", err
+	}
+	defer book.Close()
+	workbook := &sourceWorkbook{File: book, data: buf.Bytes()}
+	if props, err := book.GetWorkbookProps(); err == nil && props.Date1904 != nil {
+		workbook.date1904 = *props.Date1904
+	}
+	ex := &exporter{workbook: workbook, numberKinds: make(map[int]string)}
+
+	// Hidden sheets, such as the report sheet, are not exported
+	var sheets []string
+	for _, sheet := range book.GetSheetList() {
+		if visible, err := book.GetSheetVisible(sheet); err == nil && visible {
+			sheets = append(sheets, sheet)
+		}
+	}
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	out := bufio.NewWriter(w)
+	switch {
+	case format == FormatODS:
+		filename = base + ".ods"
+		err = ex.writeODS(out, sheets)
+	case format == FormatJSON:
+		filename = base + ".json"
+		err = ex.writeJSON(out, sheets)
+	case len(sheets) == 1:
+		filename = base + "." + format
+		err = ex.writeSheet(out, sheets[0], format)
+	default:
+		filename = base + ".zip"
+		archive := zip.NewWriter(out)
+		for _, sheet := range sheets {
+			var entry io.Writer
+			if entry, err = archive.Create(sheet + "." + format); err != nil {
+				break
+			}
+			if err = ex.writeSheet(entry, sheet, format); err != nil {
+				break
+			}
+		}
+		if closeErr := archive.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return filename, out.Flush()
+}
+
+// exporter converts the cells of the output workbook to data values
+type exporter struct {
+	workbook *sourceWorkbook
+	// numberKinds caches the kind of numbers formatted by a style
+	numberKinds map[int]string
+}
+
+// writeSheet writes a sheet as CSV or NDJSON
+func (ex *exporter) writeSheet(w io.Writer, sheet, format string) error {
+	if format == FormatCSV {
+		return ex.writeCSV(w, sheet)
+	}
+	return ex.eachObject(sheet, func(object []byte) error {
+		if _, err := w.Write(object); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	})
+}
+
+// writeJSON writes an object with the array of every sheet. The shape does not depend
+// on the number of sheets, so that readers do not have to tell the cases apart.
+func (ex *exporter) writeJSON(w io.Writer, sheets []string) error {
+	writeArray := func(sheet string) error {
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+		sep := "\n"
+		err := ex.eachObject(sheet, func(object []byte) error {
+			if _, err := io.WriteString(w, sep); err != nil {
+				return err
+			}
+			sep = ",\n"
+			_, err := w.Write(object)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "\n]")
+		return err
+	}
+
+	if len(sheets) == 0 {
+		_, err := io.WriteString(w, "{}\n")
+		return err
+	}
+	for i, sheet := range sheets {
+		sep := ",\n"
+		if i == 0 {
+			sep = "{\n"
+		}
+		if _, err := fmt.Fprintf(w, "%s%s: ", sep, jsonEncode(sheet)); err != nil {
+			return err
+		}
+		if err := writeArray(sheet); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\n}\n")
+	return err
+}
+
+// writeCSV writes the values of a sheet as CSV, every record as wide as the sheet
+func (ex *exporter) writeCSV(w io.Writer, sheet string) error {
+	width := sheetWidth(ex.workbook, sheet)
+	writer := csv.NewWriter(w)
+	err := eachRow(ex.workbook, sheet, func(values *rowValues) error {
+		record := make([]string, max(width, len(values.values)))
+		for col := 1; col <= len(values.values); col++ {
+			switch v := ex.value(values, col).(type) {
+			case float64:
+				record[col-1] = strconv.FormatFloat(v, 'f', -1, 64)
+			case string:
+				record[col-1] = v
+			default:
+				record[col-1] = values.values[col-1]
+			}
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// eachObject passes every data row of a sheet to fn as a JSON object keyed by the headers
+// of the first row. Empty rows are skipped.
+func (ex *exporter) eachObject(sheet string, fn func(object []byte) error) error {
+	var keys []string
+	return eachRow(ex.workbook, sheet, func(values *rowValues) error {
+		if isBlankRow(values.values) {
+			return nil
+		}
+		if keys == nil {
+			keys = objectKeys(values.values)
+			return nil
+		}
+
+		var object bytes.Buffer
+		object.WriteByte('{')
+		for col := 1; col <= max(len(keys), len(values.values)); col++ {
+			if col > 1 {
+				object.WriteByte(',')
+			}
+			key := ""
+			if col <= len(keys) {
+				key = keys[col-1]
+			} else {
+				key, _ = excelize.ColumnNumberToName(col)
+			}
+			object.WriteString(jsonEncode(key))
+			object.WriteByte(':')
+			object.WriteString(jsonEncode(ex.value(values, col)))
+		}
+		object.WriteByte('}')
+		return fn(object.Bytes())
+	})
+}
+
+// objectKeys returns the keys of the header row. Columns without a header are keyed by
+// their letter, repeated headers get a number suffix.
+func objectKeys(headers []string) []string {
+	keys := make([]string, len(headers))
+	seen := make(map[string]bool)
+	for i, header := range headers {
+		name := strings.TrimSpace(header)
+		if name == "" {
+			name, _ = excelize.ColumnNumberToName(i + 1)
+		}
+		key := name
+		for n := 2; seen[key]; n++ {
+			key = name + "_" + strconv.Itoa(n)
+		}
+		seen[key] = true
+		keys[i] = key
+	}
+	return keys
+}
+
+// Kinds of exported cells, named after the OpenDocument value types
+const (
+	cellEmpty      = ""
+	cellString     = "string"
+	cellFloat      = "float"
+	cellPercentage = "percentage"
+	cellDate       = "date"
+	cellTime       = "time"
+	cellBoolean    = "boolean"
+)
+
+// exportCell is a cell of the output workbook with its value type
+type exportCell struct {
+	kind string
+	// text is the displayed value
+	text   string
+	number float64
+	flag   bool
+	date   time.Time
+}
+
+// cell returns a cell typed by its stored value and number format
+func (ex *exporter) cell(values *rowValues, col int) exportCell {
+	text, _ := values.text(col)
+	if text == "" {
+		return exportCell{}
+	}
+	var info cellInfo
+	if values.cells != nil {
+		info = values.cells.cells[col]
+	}
+	if info.cellType == "b" {
+		return exportCell{kind: cellBoolean, text: text, flag: info.value == "1"}
+	}
+	n, ok := values.rawNumber(col)
+	if !ok {
+		return exportCell{kind: cellString, text: text}
+	}
+
+	switch ex.numberKind(info.style) {
+	case cellDate:
+		if d, err := excelize.ExcelDateToTime(n, ex.workbook.date1904); err == nil {
+			// Serials below 1 are times of day
+			if n < 1 {
+				return exportCell{kind: cellTime, text: text, number: n, date: d}
+			}
+			return exportCell{kind: cellDate, text: text, number: n, date: d}
+		}
+	case cellPercentage:
+		return exportCell{kind: cellPercentage, text: text, number: n}
+	}
+	return exportCell{kind: cellFloat, text: text, number: n}
+}
+
+// value returns the value of a cell for CSV and JSON: numbers and percentages as their stored
+// value, dates as ISO 8601 text, booleans as booleans, other values as displayed and empty cells as nil
+func (ex *exporter) value(values *rowValues, col int) interface{} {
+	cell := ex.cell(values, col)
+	switch cell.kind {
+	case cellEmpty:
+		return nil
+	case cellBoolean:
+		return cell.flag
+	case cellDate:
+		return isoDate(cell.date)
+	case cellTime:
+		return cell.date.Format("15:04:05")
+	case cellFloat, cellPercentage:
+		return cell.number
+	}
+	return cell.text
+}
+
+// isoDate formats a date as ISO 8601, with the time only if it is not midnight
+func isoDate(d time.Time) string {
+	if d.Hour() == 0 && d.Minute() == 0 && d.Second() == 0 {
+		return d.Format("2006-01-02")
+	}
+	return d.Format("2006-01-02T15:04:05")
+}
+
+// numberKind returns cellDate or cellPercentage if a cell style formats numbers as dates
+// or percentages, cellFloat otherwise
+func (ex *exporter) numberKind(styleID int) string {
+	if styleID == 0 {
+		return cellFloat
+	}
+	if kind, ok := ex.numberKinds[styleID]; ok {
+		return kind
+	}
+	kind := cellFloat
+	if style, err := ex.workbook.GetStyle(styleID); err == nil {
+		format := ""
+		if style.CustomNumFmt != nil {
+			format = *style.CustomNumFmt
+		}
+		switch {
+		case isDateNumFmt(style.NumFmt, format):
+			kind = cellDate
+		case style.NumFmt == 9 || style.NumFmt == 10 || strings.Contains(format, "%"):
+			kind = cellPercentage
+		}
+	}
+	ex.numberKinds[styleID] = kind
+	return kind
+}
+
+// jsonEncode encodes a string, number, boolean or nil without escaping HTML characters
+func jsonEncode(v interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// sheetWidth returns the number of columns of a sheet, from its recorded dimension or its values
+func sheetWidth(workbook *sourceWorkbook, sheet string) int {
+	if _, _, endCol, _, ok := sheetDimension(workbook, sheet); ok {
+		return endCol
+	}
+	_, _, endCol, _, _, _ := scanUsedRange(workbook, sheet)
+	return endCol
+}
+
+// isBlankRow reports whether all values of a row are empty
+func isBlankRow(row []string) bool {
+	for _, value := range row {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// eachRow passes the rows of a sheet to fn in order, with their cell types
+func eachRow(workbook *sourceWorkbook, sheet string, fn func(values *rowValues) error) error {
+	rows, err := workbook.Rows(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to read sheet %s: %w", sheet, err)
+	}
+	defer rows.Close()
+
+	cells, err := openSheetCells(workbook, sheet)
+	if err != nil {
+		return fmt.Errorf("failed to read sheet %s: %w", sheet, err)
+	}
+	defer cells.Close()
+
+	for r := 1; rows.Next(); r++ {
+		row, err := rows.Columns()
+		if err != nil {
+			return fmt.Errorf("failed to read row %d of sheet %s: %w", r, sheet, err)
+		}
+		sheetRow, err := cells.row(r)
+		if err != nil {
+			return fmt.Errorf("failed to read row %d of sheet %s: %w", r, sheet, err)
+		}
+		if err := fn(&rowValues{values: row, cells: sheetRow, file: workbook, sheet: sheet, row: r}); err != nil {
+			return err
+		}
+	}
+	return rows.Error()
+}
@@ -0,0 +1,189 @@
+package transform
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// testExportWorkbook builds an output workbook with a Data sheet of typed values,
+// a Notes sheet and a hidden Report sheet
+func testExportWorkbook(t *testing.T, notes bool) *excelize.File {
+	t.Helper()
+	file := excelize.NewFile()
+	t.Cleanup(func() { file.Close() })
+
+	mustSet := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dateStyle, err := file.NewStyle(&excelize.Style{NumFmt: 14})
+	mustSet(err)
+	amountStyle, err := file.NewStyle(&excelize.Style{NumFmt: 4})
+	mustSet(err)
+	percentStyle, err := file.NewStyle(&excelize.Style{NumFmt: 9})
+	mustSet(err)
+	timeStyle, err := file.NewStyle(&excelize.Style{NumFmt: 20})
+	mustSet(err)
+
+	mustSet(file.SetSheetName("Sheet1", "Data"))
+	mustSet(file.SetSheetRow("Data", "A1", &[]interface{}{"Name", "Amount", "Date", "Flag", "Code", "Share", "Time", "", "Name"}))
+	mustSet(file.SetSheetRow("Data", "A2", &[]interface{}{`"A" & <B>`, 1234.5, 44999, true, "007", 0.25, 0.5, "x", "dup"}))
+	mustSet(file.SetCellStyle("Data", "B2", "B2", amountStyle))
+	mustSet(file.SetCellStyle("Data", "C2", "C2", dateStyle))
+	mustSet(file.SetCellStyle("Data", "F2", "F2", percentStyle))
+	mustSet(file.SetCellStyle("Data", "G2", "G2", timeStyle))
+	mustSet(file.SetSheetRow("Data", "A4", &[]interface{}{"Last", -1}))
+
+	if notes {
+		_, err = file.NewSheet("Notes")
+		mustSet(err)
+		mustSet(file.SetSheetRow("Notes", "A1", &[]interface{}{"Note"}))
+		mustSet(file.SetSheetRow("Notes", "A2", &[]interface{}{"ok"}))
+	}
+
+	_, err = file.NewSheet("Report")
+	mustSet(err)
+	mustSet(file.SetCellValue("Report", "A1", "hidden"))
+	mustSet(file.SetSheetVisible("Report", false))
+	return file
+}
+
+const (
+	testDataObject1 = `{"Name":"\"A\" & <B>","Amount":1234.5,"Date":"2023-03-14","Flag":true,"Code":"007","Share":0.25,"Time":"12:00:00","H":"x","Name_2":"dup"}`
+	testDataObject2 = `{"Name":"Last","Amount":-1,"Date":null,"Flag":null,"Code":null,"Share":null,"Time":null,"H":null,"Name_2":null}`
+)
+
+func TestExportData(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		notes    bool
+		wantFile string
+		want     string
+	}{
+		{
+			name:     "CSV",
+			format:   FormatCSV,
+			wantFile: "out.csv",
+			want: "Name,Amount,Date,Flag,Code,Share,Time,,Name\n" +
+				`"""A"" & <B>",1234.5,2023-03-14,TRUE,007,0.25,12:00:00,x,dup` + "\n" +
+				",,,,,,,,\n" +
+				"Last,-1,,,,,,,\n",
+		},
+		{
+			name:     "NDJSON",
+			format:   FormatNDJSON,
+			wantFile: "out.ndjson",
+			want:     testDataObject1 + "\n" + testDataObject2 + "\n",
+		},
+		{
+			name:     "JSON of one sheet",
+			format:   FormatJSON,
+			wantFile: "out.json",
+			want:     "{\n\"Data\": [\n" + testDataObject1 + ",\n" + testDataObject2 + "\n]\n}\n",
+		},
+		{
+			name:     "JSON of several sheets",
+			format:   FormatJSON,
+			notes:    true,
+			wantFile: "out.json",
+			want: "{\n\"Data\": [\n" + testDataObject1 + ",\n" + testDataObject2 + "\n],\n" +
+				"\"Notes\": [\n" + `{"Note":"ok"}` + "\n]\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			filename, err := exportData(testExportWorkbook(t, tt.notes), tt.format, "out.xlsx", &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filename != tt.wantFile {
+				t.Errorf("filename = %q, want %q", filename, tt.wantFile)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+			if tt.format == FormatJSON && !json.Valid(out.Bytes()) {
+				t.Error("output is not valid JSON")
+			}
+		})
+	}
+}
+
+func TestExportZip(t *testing.T) {
+	var out bytes.Buffer
+	filename, err := exportData(testExportWorkbook(t, true), FormatNDJSON, "out.xlsx", &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filename != "out.zip" {
+		t.Errorf("filename = %q, want out.zip", filename)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]string)
+	for _, entry := range archive.File {
+		data, err := readZipEntry(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[entry.Name] = string(data)
+	}
+	want := map[string]string{
+		"Data.ndjson":  testDataObject1 + "\n" + testDataObject2 + "\n",
+		"Notes.ndjson": `{"Note":"ok"}` + "\n",
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %q, want %q", entries, want)
+	}
+}
+
+func TestWriteJSONWithoutSheets(t *testing.T) {
+	var out bytes.Buffer
+	ex := &exporter{numberKinds: make(map[int]string)}
+	if err := ex.writeJSON(&out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "{}\n" {
+		t.Errorf("writeJSON() = %q, want %q", out.String(), "{}\n")
+	}
+}
+
+func TestObjectKeys(t *testing.T) {
+	tests := []struct {
+		headers []string
+		want    []string
+	}{
+		{[]string{"a", "b"}, []string{"a", "b"}},
+		{[]string{" a ", "", "c"}, []string{"a", "B", "c"}},
+		{[]string{"a", "a", "a_2", "a"}, []string{"a", "a_2", "a_2_2", "a_3"}},
+		{[]string{"B", ""}, []string{"B", "B_2"}},
+	}
+	for _, tt := range tests {
+		if got := objectKeys(tt.headers); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("objectKeys(%q) = %q, want %q", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	for _, format := range []string{"", FormatXLSX, FormatODS, FormatCSV, FormatJSON, FormatNDJSON} {
+		if err := ValidateOutputFormat(format); err != nil {
+			t.Errorf("ValidateOutputFormat(%q) = %v", format, err)
+		}
+	}
+	if err := ValidateOutputFormat("xls"); err == nil {
+		t.Error("ValidateOutputFormat(xls) succeeded")
+	}
+}
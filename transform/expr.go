@@ -0,0 +1,546 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ComputedColumn is an output column computed from the source row by an expression.
+// Computed columns are written after the copied columns, in the order given.
+// Header, if set, is written in the first row of the range instead of a computed value.
+type ComputedColumn struct {
+	Header     string `yaml:"header,omitempty" json:"header,omitempty"`
+	Expression string `yaml:"expression" json:"expression"`
+}
+
+// expression is a compiled computed column expression.
+//
+// Grammar:
+//
+//	expr    = concat
+//	concat  = sum { "&" sum }
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | string | "[" column "]" | "{" header "}" | name "(" [ expr { "," expr } ] ")" | "(" expr ")"
+type expression struct {
+	header string
+	root   exprNode
+	refs   []*columnRef
+}
+
+// exprContext is the row an expression is evaluated for
+type exprContext struct {
+	row   *rowValues
+	index int
+}
+
+// exprNode evaluates to a string, a float64 or a cellRefValue
+type exprNode interface {
+	eval(ctx *exprContext) (interface{}, error)
+}
+
+// cellRefValue is the value of a referenced cell: text functions use the displayed
+// value, arithmetic uses the stored number of number cells
+type cellRefValue struct {
+	text     string
+	number   float64
+	isNumber bool
+}
+
+type literal struct {
+	value interface{}
+}
+
+type columnRef struct {
+	col    int
+	header string
+}
+
+type negation struct {
+	operand exprNode
+}
+
+type binaryOp struct {
+	op          byte
+	left, right exprNode
+}
+
+type call struct {
+	name string
+	fn   exprFunc
+	args []exprNode
+}
+
+// exprFunc is a built-in function, with the number of arguments it accepts (max -1 for any)
+type exprFunc struct {
+	min, max int
+	eval     func(ctx *exprContext, args []interface{}) (interface{}, error)
+}
+
+var exprFuncs = map[string]exprFunc{
+	"concat": {0, -1, func(_ *exprContext, args []interface{}) (interface{}, error) {
+		var b strings.Builder
+		for _, arg := range args {
+			b.WriteString(exprText(arg))
+		}
+		return b.String(), nil
+	}},
+	"upper": textFunc(strings.ToUpper),
+	"lower": textFunc(strings.ToLower),
+	"trim":  textFunc(func(s string) string { return strings.Join(strings.Fields(s), " ") }),
+	"title": textFunc(titleCase),
+	"replace": {3, 3, func(_ *exprContext, args []interface{}) (interface{}, error) {
+		return strings.ReplaceAll(exprText(args[0]), exprText(args[1]), exprText(args[2])), nil
+	}},
+	"left": {2, 2, func(_ *exprContext, args []interface{}) (interface{}, error) {
+		n, err := exprNumber(args[1])
+		if err != nil {
+			return nil, err
+		}
+		runes := []rune(exprText(args[0]))
+		return string(runes[:clamp(int(n), len(runes))]), nil
+	}},
+	"right": {2, 2, func(_ *exprContext, args []interface{}) (interface{}, error) {
+		n, err := exprNumber(args[1])
+		if err != nil {
+			return nil, err
+		}
+		runes := []rune(exprText(args[0]))
+		return string(runes[len(runes)-clamp(int(n), len(runes)):]), nil
+	}},
+	"split": {3, 3, func(_ *exprContext, args []interface{}) (interface{}, error) {
+		n, err := exprNumber(args[2])
+		if err != nil {
+			return nil, err
+		}
+		return splitPart(exprText(args[0]), exprText(args[1]), int(n)), nil
+	}},
+	"number": {1, 1, func(_ *exprContext, args []interface{}) (interface{}, error) {
+		return exprNumber(args[0])
+	}},
+	"round": {1, 2, func(_ *exprContext, args []interface{}) (interface{}, error) {
+		n, err := exprNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		digits := 0.0
+		if len(args) == 2 {
+			if digits, err = exprNumber(args[1]); err != nil {
+				return nil, err
+			}
+		}
+		scale := math.Pow(10, digits)
+		return math.Round(n*scale) / scale, nil
+	}},
+	"row": {0, 0, func(ctx *exprContext, _ []interface{}) (interface{}, error) {
+		return float64(ctx.row.row), nil
+	}},
+	"index": {0, 0, func(ctx *exprContext, _ []interface{}) (interface{}, error) {
+		return float64(ctx.index), nil
+	}},
+}
+
+func textFunc(fn func(string) string) exprFunc {
+	return exprFunc{1, 1, func(_ *exprContext, args []interface{}) (interface{}, error) {
+		return fn(exprText(args[0])), nil
+	}}
+}
+
+func clamp(n, limit int) int {
+	return max(0, min(n, limit))
+}
+
+// compileComputed compiles the computed columns of a mapping
+func compileComputed(m Mapping) ([]*expression, error) {
+	var exprs []*expression
+	for i, c := range m.Computed {
+		expr, err := parseExpression(c.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("computed[%d]: %w", i, err)
+		}
+		expr.header = c.Header
+		exprs = append(exprs, expr)
+	}
+	return exprs, nil
+}
+
+func (e *expression) bind(headers headerIndex) error {
+	for _, ref := range e.refs {
+		if ref.header == "" {
+			continue
+		}
+		col, err := headers.column(ref.header)
+		if err != nil {
+			return err
+		}
+		ref.col = col
+	}
+	return nil
+}
+
+func (e *expression) usesHeaders() bool {
+	for _, ref := range e.refs {
+		if ref.header != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// eval computes the value of the expression for a row
+func (e *expression) eval(ctx *exprContext) (interface{}, error) {
+	value, err := e.root.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ref, ok := value.(cellRefValue); ok {
+		if ref.isNumber {
+			return ref.number, nil
+		}
+		return ref.text, nil
+	}
+	return value, nil
+}
+
+func (n *literal) eval(*exprContext) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *columnRef) eval(ctx *exprContext) (interface{}, error) {
+	text, _ := ctx.row.text(n.col)
+	if number, ok := ctx.row.rawNumber(n.col); ok {
+		return cellRefValue{text: text, number: number, isNumber: true}, nil
+	}
+	return cellRefValue{text: text}, nil
+}
+
+func (n *negation) eval(ctx *exprContext) (interface{}, error) {
+	value, err := n.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	number, err := exprNumber(value)
+	if err != nil {
+		return nil, err
+	}
+	return -number, nil
+}
+
+func (n *binaryOp) eval(ctx *exprContext) (interface{}, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == '&' {
+		return exprText(left) + exprText(right), nil
+	}
+
+	a, err := exprNumber(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := exprNumber(right)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case '+':
+		return a + b, nil
+	case '-':
+		return a - b, nil
+	case '*':
+		return a * b, nil
+	default:
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return a / b, nil
+	}
+}
+
+func (n *call) eval(ctx *exprContext) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	value, err := n.fn.eval(ctx, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return value, nil
+}
+
+// exprText converts a value to text, numbers are written without exponent
+func exprText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return formatNumber(v)
+	case cellRefValue:
+		return v.text
+	}
+	return ""
+}
+
+// exprNumber converts a value to a number. Text is parsed as by the number transform,
+// empty text is 0 as in Excel.
+func exprNumber(value interface{}) (float64, error) {
+	var text string
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case cellRefValue:
+		if v.isNumber {
+			return v.number, nil
+		}
+		text = v.text
+	case string:
+		text = v
+	}
+	if strings.TrimSpace(text) == "" {
+		return 0, nil
+	}
+	n, ok := parseNumber(text)
+	if !ok {
+		return 0, fmt.Errorf("%q is not a number", text)
+	}
+	return n, nil
+}
+
+// exprParser is a recursive descent parser of expressions
+type exprParser struct {
+	src  string
+	pos  int
+	refs []*columnRef
+}
+
+func parseExpression(src string) (*expression, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("expression is required")
+	}
+	p := &exprParser{src: src}
+	root, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return &expression{root: root, refs: p.refs}, nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q, position %d: %s", p.src, p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// accept consumes the next character if it is one of chars
+func (p *exprParser) accept(chars string) (byte, bool) {
+	p.skipSpace()
+	if p.pos < len(p.src) && strings.IndexByte(chars, p.src[p.pos]) >= 0 {
+		p.pos++
+		return p.src[p.pos-1], true
+	}
+	return 0, false
+}
+
+func (p *exprParser) parseConcat() (exprNode, error) {
+	return p.parseBinary("&", p.parseSum)
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	return p.parseBinary("+-", p.parseProduct)
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	return p.parseBinary("*/", p.parseUnary)
+}
+
+func (p *exprParser) parseBinary(ops string, operand func() (exprNode, error)) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryOp{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negation{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end")
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		node, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, p.errorf("missing )")
+		}
+		return node, nil
+	case c == '"':
+		return p.parseString()
+	case c == '[':
+		name, err := p.parseDelimited(']')
+		if err != nil {
+			return nil, err
+		}
+		col, err := excelize.ColumnNameToNumber(strings.TrimSpace(name))
+		if err != nil {
+			return nil, p.errorf("invalid column [%s]", name)
+		}
+		ref := &columnRef{col: col}
+		p.refs = append(p.refs, ref)
+		return ref, nil
+	case c == '{':
+		header, err := p.parseDelimited('}')
+		if err != nil {
+			return nil, err
+		}
+		if headerKey(header) == "" {
+			return nil, p.errorf("empty header {}")
+		}
+		ref := &columnRef{header: header}
+		p.refs = append(p.refs, ref)
+		return ref, nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.parseNumber()
+	}
+
+	r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	if unicode.IsLetter(r) {
+		return p.parseCall()
+	}
+	return nil, p.errorf("unexpected %q", string(r))
+}
+
+func (p *exprParser) parseString() (exprNode, error) {
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.src); p.pos++ {
+		if p.src[p.pos] != '"' {
+			b.WriteByte(p.src[p.pos])
+			continue
+		}
+		// "" is an escaped quote
+		if p.pos+1 < len(p.src) && p.src[p.pos+1] == '"' {
+			b.WriteByte('"')
+			p.pos++
+			continue
+		}
+		p.pos++
+		return &literal{value: b.String()}, nil
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+func (p *exprParser) parseDelimited(close byte) (string, error) {
+	end := strings.IndexByte(p.src[p.pos+1:], close)
+	if end < 0 {
+		return "", p.errorf("missing %c", close)
+	}
+	name := p.src[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return name, nil
+}
+
+func (p *exprParser) parseNumber() (exprNode, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+		p.pos++
+	}
+	n, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number")
+	}
+	return &literal{value: n}, nil
+}
+
+func (p *exprParser) parseCall() (exprNode, error) {
+	start := p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		p.pos += size
+	}
+	name := strings.ToLower(p.src[start:p.pos])
+
+	fn, ok := exprFuncs[name]
+	if !ok {
+		p.pos = start
+		return nil, p.errorf("unknown function %s", name)
+	}
+	if _, ok := p.accept("("); !ok {
+		return nil, p.errorf("missing ( after %s", name)
+	}
+
+	node := &call{name: name, fn: fn}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseConcat()
+			if err != nil {
+				return nil, err
+			}
+			node.args = append(node.args, arg)
+			if _, ok := p.accept(")"); ok {
+				break
+			}
+			if _, ok := p.accept(","); !ok {
+				return nil, p.errorf("missing , or )")
+			}
+		}
+	}
+
+	if len(node.args) < fn.min || fn.max >= 0 && len(node.args) > fn.max {
+		return nil, p.errorf("wrong number of arguments for %s", name)
+	}
+	return node, nil
+}
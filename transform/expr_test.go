@@ -0,0 +1,158 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpressionEval(t *testing.T) {
+	// A: text, B: a number cell displayed with a thousands separator, C: a number typed as text
+	row := &rowValues{
+		values: []string{"  иван  петров ", "1 200", "2,5"},
+		cells: &sheetRow{cells: map[int]cellInfo{
+			1: {cellType: "s", value: "0"},
+			2: {cellType: "n", value: "1200"},
+			3: {cellType: "s", value: "1"},
+		}},
+		row: 7,
+	}
+	ctx := &exprContext{row: row, index: 3}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"12 / 3 / 2", 2.0},
+		{"-2 * -3", 6.0},
+		{"--2", 2.0},
+		{"1 + 2 & 3 * 4", "312"},
+		{`"a" & 1.50`, "a1.5"},
+		{`"say ""hi"""`, `say "hi"`},
+		{"[B] * 2", 2400.0},
+		{"[B] & \"\"", "1 200"},
+		{"[C] * 2", 5.0},
+		{"[b]", 1200.0},
+		{"[A]", "  иван  петров "},
+		{"title(trim([A]))", "Иван Петров"},
+		{"UPPER(left(trim([A]), 4))", "ИВАН"},
+		{"right(\"abc\", 10)", "abc"},
+		{"left(\"abc\", -1)", ""},
+		{`split("a;b;c", ";", -1)`, "c"},
+		{`replace("a-b-c", "-", "")`, "abc"},
+		{`concat()`, ""},
+		{`concat("x", 1, [B])`, "x11 200"},
+		{"round(2 / 3, 2)", 0.67},
+		{"round(2.5)", 3.0},
+		{`number("1 234,5") + 0.5`, 1235.0},
+		{`"" + 1`, 1.0},
+		{"row() * 10 + index()", 73.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parseExpression(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := expr.eval(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("eval() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpressionParseErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"", "expression is required"},
+		{"1 +", "position 4: unexpected end"},
+		{"(1 + 2", "missing )"},
+		{"1 2", `unexpected "2"`},
+		{`"abc`, "unterminated string"},
+		{"[B", "missing ]"},
+		{"[1]", "invalid column [1]"},
+		{"{ }", "empty header {}"},
+		{"1..2", "invalid number"},
+		{"sum(1, 2)", "unknown function sum"},
+		{"upper", "missing ( after upper"},
+		{"upper(1 2)", "missing , or )"},
+		{"upper()", "wrong number of arguments for upper"},
+		{"left(\"a\", 1, 2)", "wrong number of arguments for left"},
+		{"1 % 2", `unexpected "% 2"`},
+		{"#", `unexpected "#"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseExpression(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseExpression(%q) error = %v, want %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpressionEvalErrors(t *testing.T) {
+	ctx := &exprContext{row: textRow("abc")}
+
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"1 / 0", "division by zero"},
+		{"1 / (2 - 2)", "division by zero"},
+		{"[A] + 1", `"abc" is not a number`},
+		{"-[A]", `"abc" is not a number`},
+		{`round(1, "x")`, `round: "x" is not a number`},
+		{`left([A], "two")`, `left: "two" is not a number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parseExpression(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = expr.eval(ctx)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("eval() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpressionHeaders(t *testing.T) {
+	exprs, err := compileComputed(Mapping{Computed: []ComputedColumn{
+		{Header: "ФИО", Expression: "{Фамилия} & \" \" & {Имя}"},
+		{Expression: "[A]"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exprs[0].usesHeaders() || exprs[1].usesHeaders() {
+		t.Fatalf("usesHeaders() = %v, %v, want true, false", exprs[0].usesHeaders(), exprs[1].usesHeaders())
+	}
+	if err := exprs[0].bind(newHeaderIndex("Data", 1, []string{"Имя", "фамилия"})); err != nil {
+		t.Fatal(err)
+	}
+	got, err := exprs[0].eval(&exprContext{row: textRow("Иван", "Петров")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Петров Иван" {
+		t.Errorf("eval() = %q, want %q", got, "Петров Иван")
+	}
+
+	if err := exprs[0].bind(newHeaderIndex("Data", 1, []string{"Имя"})); err == nil {
+		t.Error("bind() succeeded without the header")
+	}
+	if _, err := compileComputed(Mapping{Computed: []ComputedColumn{{Expression: "[A]"}, {Expression: "1 +"}}}); err == nil || !strings.HasPrefix(err.Error(), "computed[1]: ") {
+		t.Errorf("compileComputed() error = %v, want it to name computed[1]", err)
+	}
+}
@@ -0,0 +1,493 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Filter operators of the mapping "filters" option
+const (
+	OpEquals         = "equals"
+	OpNotEquals      = "not_equals"
+	OpContains       = "contains"
+	OpNotContains    = "not_contains"
+	OpMask           = "mask"
+	OpRegex          = "regex"
+	OpIn             = "in"
+	OpNotIn          = "not_in"
+	OpGreater        = "gt"
+	OpGreaterOrEqual = "gte"
+	OpLess           = "lt"
+	OpLessOrEqual    = "lte"
+	OpBetween        = "between"
+	OpDateBefore     = "date_before"
+	OpDateAfter      = "date_after"
+	OpDateBetween    = "date_between"
+	OpEmpty          = "empty"
+	OpNotEmpty       = "not_empty"
+)
+
+// How the conditions of a filter list are combined
+const (
+	FilterMatchAll = "all"
+	FilterMatchAny = "any"
+)
+
+// operatorAliases maps the symbolic operator spellings to operator names
+var operatorAliases = map[string]string{
+	"=":  OpEquals,
+	"==": OpEquals,
+	"!=": OpNotEquals,
+	"<>": OpNotEquals,
+	">":  OpGreater,
+	">=": OpGreaterOrEqual,
+	"<":  OpLess,
+	"<=": OpLessOrEqual,
+}
+
+// dateLayouts are the date formats accepted in filter values and text cells
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"02.01.2006",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"01-02-06",
+	"1/2/2006",
+	"1/2/06",
+}
+
+// Filter is a condition on a column of the source row, or a group of conditions
+// combined with Any (OR) or All (AND). The column is given by its letter or by its header.
+type Filter struct {
+	Column     string   `yaml:"column,omitempty" json:"column,omitempty"`
+	Header     string   `yaml:"header,omitempty" json:"header,omitempty"`
+	Operator   string   `yaml:"operator,omitempty" json:"operator,omitempty"`
+	Value      string   `yaml:"value,omitempty" json:"value,omitempty"`
+	Values     []string `yaml:"values,omitempty" json:"values,omitempty"`
+	Min        string   `yaml:"min,omitempty" json:"min,omitempty"`
+	Max        string   `yaml:"max,omitempty" json:"max,omitempty"`
+	IgnoreCase bool     `yaml:"ignore_case,omitempty" json:"ignore_case,omitempty"`
+	Any        []Filter `yaml:"any,omitempty" json:"any,omitempty"`
+	All        []Filter `yaml:"all,omitempty" json:"all,omitempty"`
+}
+
+// rowFilter decides whether a source row is copied
+type rowFilter interface {
+	match(row *rowValues) bool
+	// bind resolves the columns given by header once the header row has been read
+	bind(headers headerIndex) error
+}
+
+// filterGroup matches when all (or any) of its filters match
+type filterGroup struct {
+	any     bool
+	filters []rowFilter
+}
+
+func (g *filterGroup) match(row *rowValues) bool {
+	for _, f := range g.filters {
+		if f.match(row) == g.any {
+			return g.any
+		}
+	}
+	return !g.any
+}
+
+func (g *filterGroup) bind(headers headerIndex) error {
+	for _, f := range g.filters {
+		if err := f.bind(headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// condition is a compiled Filter on a single column
+type condition struct {
+	col        int
+	header     string
+	op         string
+	text       string
+	set        map[string]bool
+	re         *regexp.Regexp
+	min, max   float64
+	from, to   time.Time
+	ignoreCase bool
+	// skipMissing rejects rows that end before the column, as filter_column always did
+	skipMissing bool
+}
+
+func (c *condition) bind(headers headerIndex) error {
+	if c.header == "" {
+		return nil
+	}
+	col, err := headers.column(c.header)
+	if err != nil {
+		return err
+	}
+	c.col = col
+	return nil
+}
+
+func (c *condition) match(row *rowValues) bool {
+	value, ok := row.text(c.col)
+	if !ok && c.skipMissing {
+		return false
+	}
+
+	switch c.op {
+	case OpEmpty:
+		return strings.TrimSpace(value) == ""
+	case OpNotEmpty:
+		return strings.TrimSpace(value) != ""
+	case OpGreater, OpGreaterOrEqual, OpLess, OpLessOrEqual, OpBetween:
+		n, ok := row.number(c.col)
+		if !ok {
+			return false
+		}
+		switch c.op {
+		case OpGreater:
+			return n > c.min
+		case OpGreaterOrEqual:
+			return n >= c.min
+		case OpLess:
+			return n < c.max
+		case OpLessOrEqual:
+			return n <= c.max
+		default:
+			return n >= c.min && n <= c.max
+		}
+	case OpDateBefore, OpDateAfter, OpDateBetween:
+		d, ok := row.date(c.col)
+		if !ok {
+			return false
+		}
+		switch c.op {
+		case OpDateBefore:
+			return d.Before(c.to)
+		case OpDateAfter:
+			return d.After(c.from)
+		default:
+			return !d.Before(c.from) && !d.After(c.to)
+		}
+	case OpRegex:
+		return c.re.MatchString(value)
+	}
+
+	if c.ignoreCase {
+		value = strings.ToLower(value)
+	}
+	switch c.op {
+	case OpEquals:
+		return value == c.text
+	case OpNotEquals:
+		return value != c.text
+	case OpContains:
+		return strings.Contains(value, c.text)
+	case OpNotContains:
+		return !strings.Contains(value, c.text)
+	case OpMask:
+		return matchesMask(value, c.text)
+	case OpIn:
+		return c.set[value]
+	case OpNotIn:
+		return !c.set[value]
+	}
+	return false
+}
+
+// compileFilters builds the row filter of a mapping, or returns nil if the mapping has no filters.
+// The legacy filter_column/filter_mask pair is combined with the filters list by AND.
+func compileFilters(m Mapping) (rowFilter, error) {
+	var filters []rowFilter
+
+	if m.FilterColumn != "" && m.FilterMask != "" {
+		col, err := excelize.ColumnNameToNumber(m.FilterColumn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter_column: %w", err)
+		}
+		filters = append(filters, &condition{col: col, op: OpMask, text: m.FilterMask, skipMissing: true})
+	}
+
+	if len(m.Filters) > 0 {
+		var anyMatch bool
+		switch m.FilterMatch {
+		case "", FilterMatchAll:
+		case FilterMatchAny:
+			anyMatch = true
+		default:
+			return nil, fmt.Errorf("filter_match must be one of all, any")
+		}
+
+		group, err := compileGroup(m.Filters, anyMatch, "filters")
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, group)
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil, nil
+	case 1:
+		return filters[0], nil
+	default:
+		return &filterGroup{filters: filters}, nil
+	}
+}
+
+func compileGroup(filters []Filter, anyMatch bool, path string) (*filterGroup, error) {
+	group := &filterGroup{any: anyMatch}
+	for i, f := range filters {
+		compiled, err := compileFilter(f, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		group.filters = append(group.filters, compiled)
+	}
+	return group, nil
+}
+
+func compileFilter(f Filter, path string) (rowFilter, error) {
+	if len(f.Any) > 0 || len(f.All) > 0 {
+		if f.Column != "" || f.Header != "" || f.Operator != "" {
+			return nil, fmt.Errorf("%s: a filter group cannot have a column or an operator", path)
+		}
+		if len(f.Any) > 0 && len(f.All) > 0 {
+			return nil, fmt.Errorf("%s: use either any or all in a filter group", path)
+		}
+		if len(f.Any) > 0 {
+			return compileGroup(f.Any, true, path+".any")
+		}
+		return compileGroup(f.All, false, path+".all")
+	}
+
+	var col int
+	var err error
+	switch {
+	case f.Column != "" && f.Header != "":
+		return nil, fmt.Errorf("%s: use either column or header", path)
+	case f.Header != "":
+	case f.Column != "":
+		if col, err = excelize.ColumnNameToNumber(f.Column); err != nil {
+			return nil, fmt.Errorf("%s: invalid column: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: column or header is required", path)
+	}
+
+	op := strings.ToLower(strings.TrimSpace(f.Operator))
+	if alias, ok := operatorAliases[op]; ok {
+		op = alias
+	}
+	if op == "" {
+		op = OpEquals
+	}
+
+	c := &condition{col: col, header: f.Header, op: op, ignoreCase: f.IgnoreCase}
+	text := f.Value
+	if f.IgnoreCase {
+		text = strings.ToLower(text)
+	}
+
+	switch op {
+	case OpEmpty, OpNotEmpty:
+	case OpEquals, OpNotEquals:
+		c.text = text
+	case OpContains, OpNotContains, OpMask:
+		if f.Value == "" {
+			return nil, fmt.Errorf("%s: %s requires a value", path, op)
+		}
+		c.text = text
+	case OpRegex:
+		pattern := f.Value
+		if f.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		if c.re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("%s: invalid regex: %w", path, err)
+		}
+	case OpIn, OpNotIn:
+		if len(f.Values) == 0 {
+			return nil, fmt.Errorf("%s: %s requires a list of values", path, op)
+		}
+		c.set = make(map[string]bool, len(f.Values))
+		for _, v := range f.Values {
+			if f.IgnoreCase {
+				v = strings.ToLower(v)
+			}
+			c.set[v] = true
+		}
+	case OpGreater, OpGreaterOrEqual:
+		if c.min, err = parseFilterNumber(f.Value, path); err != nil {
+			return nil, err
+		}
+	case OpLess, OpLessOrEqual:
+		if c.max, err = parseFilterNumber(f.Value, path); err != nil {
+			return nil, err
+		}
+	case OpBetween:
+		if c.min, err = parseFilterNumber(f.Min, path+".min"); err != nil {
+			return nil, err
+		}
+		if c.max, err = parseFilterNumber(f.Max, path+".max"); err != nil {
+			return nil, err
+		}
+	case OpDateBefore:
+		if c.to, err = parseFilterDate(f.Value, path); err != nil {
+			return nil, err
+		}
+	case OpDateAfter:
+		if c.from, err = parseFilterDate(f.Value, path); err != nil {
+			return nil, err
+		}
+	case OpDateBetween:
+		if c.from, err = parseFilterDate(f.Min, path+".min"); err != nil {
+			return nil, err
+		}
+		if c.to, err = parseFilterDate(f.Max, path+".max"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown operator %q", path, f.Operator)
+	}
+
+	return c, nil
+}
+
+func parseFilterNumber(value, path string) (float64, error) {
+	n, ok := parseNumber(value)
+	if !ok {
+		return 0, fmt.Errorf("%s: %q is not a number", path, value)
+	}
+	return n, nil
+}
+
+func parseFilterDate(value, path string) (time.Time, error) {
+	d, ok := parseDate(value)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s: %q is not a date, use YYYY-MM-DD", path, value)
+	}
+	return d, nil
+}
+
+// parseNumber parses a number as typed by a user or displayed in a cell:
+// spaces separate thousands, a lone comma is the decimal separator.
+func parseNumber(s string) (float64, bool) {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\u00a0' {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return 0, false
+	}
+	if strings.Contains(s, ",") {
+		if strings.Contains(s, ".") {
+			s = strings.ReplaceAll(s, ",", "")
+		} else {
+			s = strings.ReplaceAll(s, ",", ".")
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	return n, err == nil
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// rowValues gives filters access to the cells of a source row: the displayed values
+// and, for numbers and dates, the raw values stored in the workbook.
+type rowValues struct {
+	values []string
+	cells  *sheetRow
+	file   *sourceWorkbook
+	sheet  string
+	row    int
+}
+
+// text returns the displayed value of a cell and whether the row reaches the column
+func (r *rowValues) text(col int) (string, bool) {
+	if col > len(r.values) {
+		return "", false
+	}
+	return r.values[col-1], true
+}
+
+// number returns the numeric value of a number cell, or parses the displayed value
+func (r *rowValues) number(col int) (float64, bool) {
+	if n, ok := r.rawNumber(col); ok {
+		return n, true
+	}
+	value, _ := r.text(col)
+	return parseNumber(value)
+}
+
+// date converts date serials of number cells, or parses the displayed value
+func (r *rowValues) date(col int) (time.Time, bool) {
+	if n, ok := r.rawNumber(col); ok {
+		d, err := excelize.ExcelDateToTime(n, r.file.date1904)
+		return d, err == nil
+	}
+	value, _ := r.text(col)
+	return parseDate(value)
+}
+
+// sourceCell returns the cell of a column with its type, style and formula, or an empty cell
+func (r *rowValues) sourceCell(col int) (sourceCell, error) {
+	text, _ := r.text(col)
+	if text == "" {
+		return sourceCell{}, nil
+	}
+	if r.cells != nil {
+		return r.cells.sourceCell(r.sheet, col, text), nil
+	}
+	cell, err := excelize.CoordinatesToCellName(col, r.row)
+	if err != nil {
+		return sourceCell{}, err
+	}
+	return readSourceCell(r.file.File, r.sheet, cell)
+}
+
+// rawNumber returns the stored value of a number cell
+func (r *rowValues) rawNumber(col int) (float64, bool) {
+	var raw string
+	if r.cells != nil {
+		info := r.cells.cells[col]
+		if info.cellType != "" && info.cellType != "n" {
+			return 0, false
+		}
+		raw = info.value
+	} else {
+		cell, err := excelize.CoordinatesToCellName(col, r.row)
+		if err != nil {
+			return 0, false
+		}
+		cellType, _ := r.file.GetCellType(r.sheet, cell)
+		if cellType != excelize.CellTypeUnset && cellType != excelize.CellTypeNumber {
+			return 0, false
+		}
+		raw, _ = r.file.GetCellValue(r.sheet, cell, excelize.Options{RawCellValue: true})
+	}
+	if raw == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(raw, 64)
+	return n, err == nil
+}
@@ -0,0 +1,218 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+)
+
+// textRow builds a source row of text cells
+func textRow(values ...string) *rowValues {
+	cells := make(map[int]cellInfo, len(values))
+	for i, value := range values {
+		cells[i+1] = cellInfo{cellType: "s", value: value}
+	}
+	return &rowValues{values: values, cells: &sheetRow{cells: cells}}
+}
+
+func TestFilterOperators(t *testing.T) {
+	row := textRow("Москва", "1 234,50", "15.03.2023", "", "ACC-2023-17")
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"equals", Filter{Column: "A", Value: "Москва"}, true},
+		{"equals is case sensitive", Filter{Column: "A", Value: "москва"}, false},
+		{"equals ignoring case", Filter{Column: "A", Value: "москва", IgnoreCase: true}, true},
+		{"symbolic not equals", Filter{Column: "A", Operator: "<>", Value: "Казань"}, true},
+		{"contains", Filter{Column: "E", Operator: OpContains, Value: "2023"}, true},
+		{"not contains", Filter{Column: "E", Operator: OpNotContains, Value: "2023"}, false},
+		{"mask", Filter{Column: "E", Operator: OpMask, Value: "ACC-*-17"}, true},
+		{"regex", Filter{Column: "E", Operator: OpRegex, Value: `^acc-\d{4}-\d+$`, IgnoreCase: true}, true},
+		{"in", Filter{Column: "A", Operator: OpIn, Values: []string{"Казань", "Москва"}}, true},
+		{"not in", Filter{Column: "A", Operator: OpNotIn, Values: []string{"Казань", "Москва"}}, false},
+		{"number with spaces and decimal comma", Filter{Column: "B", Operator: ">", Value: "1234"}, true},
+		{"less or equal", Filter{Column: "B", Operator: "<=", Value: "1234.5"}, true},
+		{"between", Filter{Column: "B", Operator: OpBetween, Min: "1000", Max: "1 000 000"}, true},
+		{"number on text", Filter{Column: "A", Operator: OpGreater, Value: "0"}, false},
+		{"date before", Filter{Column: "C", Operator: OpDateBefore, Value: "2023-04-01"}, true},
+		{"date after", Filter{Column: "C", Operator: OpDateAfter, Value: "2023-04-01"}, false},
+		{"date between is inclusive", Filter{Column: "C", Operator: OpDateBetween, Min: "2023-03-15", Max: "2023-03-15"}, true},
+		{"empty", Filter{Column: "D", Operator: OpEmpty}, true},
+		{"not empty", Filter{Column: "D", Operator: OpNotEmpty}, false},
+		{"column past the end of the row is empty", Filter{Column: "Z", Operator: OpEmpty}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := compileFilter(tt.filter, "filters[0]")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.match(row); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterNumberCells(t *testing.T) {
+	// A date cell stores the serial number, its displayed value may be in any format
+	row := &rowValues{
+		values: []string{"15 мар 2023", "1,5"},
+		cells: &sheetRow{cells: map[int]cellInfo{
+			1: {value: "44999"},
+			2: {cellType: "n", value: "1.5"},
+		}},
+		file: &sourceWorkbook{},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"date serial", Filter{Column: "A", Operator: OpDateBetween, Min: "2023-03-01", Max: "2023-03-31"}, true},
+		{"stored number", Filter{Column: "B", Operator: OpLess, Value: "2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := compileFilter(tt.filter, "filters[0]")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.match(row); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping Mapping
+		row     *rowValues
+		want    bool
+	}{
+		{
+			name: "all by default",
+			mapping: Mapping{Filters: []Filter{
+				{Column: "A", Value: "x"},
+				{Column: "B", Value: "y"},
+			}},
+			row:  textRow("x", "z"),
+			want: false,
+		},
+		{
+			name: "any",
+			mapping: Mapping{FilterMatch: FilterMatchAny, Filters: []Filter{
+				{Column: "A", Value: "x"},
+				{Column: "B", Value: "y"},
+			}},
+			row:  textRow("x", "z"),
+			want: true,
+		},
+		{
+			name: "nested any inside all",
+			mapping: Mapping{Filters: []Filter{
+				{Column: "A", Value: "x"},
+				{Any: []Filter{
+					{Column: "B", Value: "y"},
+					{Column: "B", Value: "z"},
+				}},
+			}},
+			row:  textRow("x", "z"),
+			want: true,
+		},
+		{
+			name: "legacy filter_column combined by AND",
+			mapping: Mapping{FilterColumn: "A", FilterMask: "x*", FilterMatch: FilterMatchAny, Filters: []Filter{
+				{Column: "B", Value: "y"},
+			}},
+			row:  textRow("abc", "y"),
+			want: false,
+		},
+		{
+			name:    "legacy filter_column skips short rows",
+			mapping: Mapping{FilterColumn: "C", FilterMask: "*"},
+			row:     textRow("x"),
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := compileFilters(tt.mapping)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.match(tt.row); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterHeaders(t *testing.T) {
+	f, err := compileFilters(Mapping{Filters: []Filter{{Header: "Город", Value: "Москва"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.bind(newHeaderIndex("Data", 1, []string{"Сумма", "  город "})); err != nil {
+		t.Fatal(err)
+	}
+	if !f.match(textRow("10", "Москва")) {
+		t.Error("the filter does not use the column of the header")
+	}
+	if err := f.bind(newHeaderIndex("Data", 1, []string{"Сумма"})); err == nil {
+		t.Error("bind() succeeded without the header")
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping Mapping
+		wantErr string
+	}{
+		{"no column", Mapping{Filters: []Filter{{Value: "x"}}}, "filters[0]: column or header is required"},
+		{"column and header", Mapping{Filters: []Filter{{Column: "A", Header: "H"}}}, "use either column or header"},
+		{"unknown operator", Mapping{Filters: []Filter{{Column: "A", Operator: "like"}}}, `unknown operator "like"`},
+		{"invalid regex", Mapping{Filters: []Filter{{Column: "A", Operator: OpRegex, Value: "("}}}, "invalid regex"},
+		{"in without values", Mapping{Filters: []Filter{{Column: "A", Operator: OpIn}}}, "requires a list of values"},
+		{"not a number", Mapping{Filters: []Filter{{Column: "A", Operator: OpGreater, Value: "many"}}}, `"many" is not a number`},
+		{"not a date", Mapping{Filters: []Filter{{Column: "A", Operator: OpDateBetween, Min: "2023-01-01", Max: "soon"}}}, "filters[0].max"},
+		{"group with column", Mapping{Filters: []Filter{{Column: "A", Any: []Filter{{Column: "B"}}}}}, "cannot have a column"},
+		{"nested path", Mapping{Filters: []Filter{{All: []Filter{{Column: "A"}, {Value: "x"}}}}}, "filters[0].all[1]"},
+		{"filter_match", Mapping{FilterMatch: "some", Filters: []Filter{{Column: "A"}}}, "filter_match must be one of all, any"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileFilters(tt.mapping)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compileFilters() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+		ok   bool
+	}{
+		{"42", 42, true},
+		{"-1.5", -1.5, true},
+		{"1 234,5", 1234.5, true},
+		{"1 234", 1234, true},
+		{"1,234.5", 1234.5, true},
+		{"", 0, false},
+		{"abc", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseNumber(tt.s); got != tt.want || ok != tt.ok {
+			t.Errorf("parseNumber(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
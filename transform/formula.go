@@ -0,0 +1,266 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Formula handling modes for the mapping "formulas" option.
+// Formulas are copied verbatim by default, translation is opt-in.
+const (
+	FormulasTranslate = "translate"
+	FormulasValues    = "values"
+	FormulasVerbatim  = "verbatim"
+)
+
+// formulaRefPattern matches an optionally sheet-qualified A1 reference:
+// cells (B2, $B$2), cell ranges (B2:C10), column ranges (A:C) and row ranges (1:5)
+var formulaRefPattern = regexp.MustCompile(`((?:'(?:[^']|'')+'|[\p{L}_][\p{L}\p{N}_.]*)!)?` +
+	`(\$?[A-Za-z]{1,3}\$?[0-9]+(?::\$?[A-Za-z]{1,3}\$?[0-9]+)?|\$?[A-Za-z]{1,3}:\$?[A-Za-z]{1,3}|\$?[0-9]+:\$?[0-9]+)`)
+
+// formulaContext describes where a formula is copied from and to
+type formulaContext struct {
+	sourceSheet string
+	destSheet   string
+	rowOffset   int
+	colOffset   int
+	sheetExists func(name string) bool
+}
+
+// translateFormula shifts relative references by the mapping offset and rewrites
+// references to the source sheet so that they point at the destination sheet.
+// It returns false if the formula references a sheet that does not exist in the output.
+func translateFormula(formula string, ctx formulaContext) (string, bool) {
+	var out strings.Builder
+	resolved := true
+
+	// Process the formula outside of string literals only
+	inString := false
+	start := 0
+	flush := func(end int) {
+		segment := formula[start:end]
+		if inString {
+			out.WriteString(segment)
+			return
+		}
+		translated, ok := translateSegment(segment, ctx)
+		if !ok {
+			resolved = false
+		}
+		out.WriteString(translated)
+	}
+
+	for i := 0; i < len(formula); i++ {
+		if formula[i] != '"' {
+			continue
+		}
+		if inString {
+			// Escaped quote inside a string literal
+			if i+1 < len(formula) && formula[i+1] == '"' {
+				i++
+				continue
+			}
+			flush(i + 1)
+			start = i + 1
+			inString = false
+		} else {
+			flush(i)
+			start = i
+			inString = true
+		}
+	}
+	flush(len(formula))
+
+	return out.String(), resolved
+}
+
+func translateSegment(segment string, ctx formulaContext) (string, bool) {
+	var out strings.Builder
+	resolved := true
+	last := 0
+
+	for _, loc := range formulaRefPattern.FindAllStringSubmatchIndex(segment, -1) {
+		start, end := loc[0], loc[1]
+
+		// Skip function names (LOG10(), identifiers (Total2023) and parts of longer tokens
+		if start > 0 && isFormulaNameChar(rune(segment[start-1])) {
+			continue
+		}
+		if end < len(segment) && (isFormulaNameChar(rune(segment[end])) || segment[end] == '(') {
+			continue
+		}
+
+		sheet := ""
+		if loc[2] != -1 {
+			sheet = unquoteSheetName(segment[loc[2] : loc[3]-1])
+		}
+		ref := segment[loc[4]:loc[5]]
+
+		out.WriteString(segment[last:start])
+		last = end
+
+		shifted, err := shiftReference(ref, ctx.rowOffset, ctx.colOffset)
+		if err != nil {
+			out.WriteString("#REF!")
+			continue
+		}
+
+		switch {
+		case sheet == "":
+			out.WriteString(shifted)
+		case strings.EqualFold(sheet, ctx.sourceSheet):
+			// The referenced data was moved along with the mapping
+			out.WriteString(quoteSheetName(ctx.destSheet) + "!" + shifted)
+		case ctx.sheetExists(sheet):
+			out.WriteString(quoteSheetName(sheet) + "!" + shifted)
+		default:
+			resolved = false
+			out.WriteString(segment[start:end])
+		}
+	}
+	out.WriteString(segment[last:])
+
+	return out.String(), resolved
+}
+
+func isFormulaNameChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '!'
+}
+
+// shiftReference moves the relative parts of a cell, column or row reference
+func shiftReference(ref string, rowOffset, colOffset int) (string, error) {
+	parts := strings.Split(ref, ":")
+	for i, part := range parts {
+		shifted, err := shiftReferencePart(part, rowOffset, colOffset)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = shifted
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+func shiftReferencePart(part string, rowOffset, colOffset int) (string, error) {
+	i := 0
+	colAbs := i < len(part) && part[i] == '$'
+	if colAbs {
+		i++
+	}
+	colStart := i
+	for i < len(part) && unicode.IsLetter(rune(part[i])) {
+		i++
+	}
+	col := part[colStart:i]
+
+	rowAbs := i < len(part) && part[i] == '$'
+	if rowAbs {
+		i++
+	}
+	row := part[i:]
+
+	// A "$" in front of a bare row number belongs to the row
+	if col == "" && colAbs {
+		colAbs, rowAbs = false, true
+	}
+
+	var b strings.Builder
+	if col != "" {
+		colNum, err := excelize.ColumnNameToNumber(col)
+		if err != nil {
+			return "", err
+		}
+		if !colAbs {
+			colNum += colOffset
+		}
+		name, err := excelize.ColumnNumberToName(colNum)
+		if err != nil {
+			return "", err
+		}
+		if colAbs {
+			b.WriteByte('$')
+		}
+		b.WriteString(name)
+	}
+
+	if row != "" {
+		rowNum, err := strconv.Atoi(row)
+		if err != nil {
+			return "", err
+		}
+		if !rowAbs {
+			rowNum += rowOffset
+		}
+		if rowNum < 1 || rowNum > excelize.TotalRows {
+			return "", fmt.Errorf("row %d out of range", rowNum)
+		}
+		if rowAbs {
+			b.WriteByte('$')
+		}
+		b.WriteString(strconv.Itoa(rowNum))
+	}
+
+	return b.String(), nil
+}
+
+// quoteSheetName quotes a sheet name for use in a formula when required
+func quoteSheetName(name string) string {
+	for i, r := range name {
+		if !(r < unicode.MaxASCII && (unicode.IsLetter(r) || r == '_' || (i > 0 && unicode.IsDigit(r)))) {
+			return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+		}
+	}
+	return name
+}
+
+func unquoteSheetName(name string) string {
+	if len(name) >= 2 && name[0] == '\'' && name[len(name)-1] == '\'' {
+		return strings.ReplaceAll(name[1:len(name)-1], "''", "'")
+	}
+	return name
+}
+
+// copyCellFormula copies the formula of a source cell according to the formulas mode.
+// It returns false if the cell has no formula or the value should be copied instead.
+func copyCellFormula(destFile *outputWorkbook, src sourceCell, destSheet, destCell string, opts copyOptions) (bool, error) {
+	formula := src.Formula
+	if opts.Formulas == FormulasValues || formula == "" {
+		return false, nil
+	}
+
+	if opts.Formulas == FormulasTranslate {
+		srcCol, srcRow, err := excelize.CellNameToCoordinates(src.Name)
+		if err != nil {
+			return false, err
+		}
+		dstCol, dstRow, err := excelize.CellNameToCoordinates(destCell)
+		if err != nil {
+			return false, err
+		}
+
+		translated, ok := translateFormula(formula, formulaContext{
+			sourceSheet: src.Sheet,
+			destSheet:   destSheet,
+			rowOffset:   dstRow - srcRow,
+			colOffset:   dstCol - srcCol,
+			sheetExists: func(name string) bool {
+				index, _ := destFile.GetSheetIndex(name)
+				return index != -1
+			},
+		})
+		if !ok {
+			// The formula references a sheet missing in the output, keep the calculated value
+			return false, nil
+		}
+		formula = translated
+	}
+
+	if err := destFile.SetCellFormula(destSheet, destCell, formula); err != nil {
+		return false, fmt.Errorf("failed to set cell formula: %w", err)
+	}
+	return true, nil
+}
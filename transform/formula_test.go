@@ -0,0 +1,122 @@
+package transform
+
+import "testing"
+
+func TestTranslateFormula(t *testing.T) {
+	ctx := formulaContext{
+		sourceSheet: "Source",
+		destSheet:   "Итог",
+		rowOffset:   2,
+		colOffset:   1,
+		sheetExists: func(name string) bool { return name == "Rates" },
+	}
+
+	tests := []struct {
+		name     string
+		formula  string
+		want     string
+		resolved bool
+	}{
+		{"relative cell", "A1+B2", "B3+C4", true},
+		{"absolute cell", "$A$1+B2", "$A$1+C4", true},
+		{"mixed references", "$A1*A$1", "$A3*B$1", true},
+		{"cell range", "SUM(A1:B10)", "SUM(B3:C12)", true},
+		{"column range", "SUM(A:C)", "SUM(B:D)", true},
+		{"row range", "SUM(1:$5)", "SUM(3:$5)", true},
+		{"source sheet renamed", "Source!A1*2", "'Итог'!B3*2", true},
+		{"quoted source sheet", "'source'!$A$1", "'Итог'!$A$1", true},
+		{"other existing sheet", "Rates!B2", "Rates!C4", true},
+		{"missing sheet", "Missing!A1+A1", "Missing!A1+B3", false},
+		{"string literal untouched", `IF(A1="B2 ""C3""",B2,"")`, `IF(B3="B2 ""C3""",C4,"")`, true},
+		{"function names untouched", "LOG10(A1)+ATAN2(A1,B1)", "LOG10(B3)+ATAN2(B3,C3)", true},
+		{"identifier untouched", "Total2023*A1", "Total2023*B3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, resolved := translateFormula(tt.formula, ctx)
+			if got != tt.want || resolved != tt.resolved {
+				t.Errorf("translateFormula(%q) = %q, %v, want %q, %v", tt.formula, got, resolved, tt.want, tt.resolved)
+			}
+		})
+	}
+}
+
+func TestTranslateFormulaOutOfRange(t *testing.T) {
+	ctx := formulaContext{sourceSheet: "Source", destSheet: "Dest", rowOffset: -2, sheetExists: func(string) bool { return false }}
+
+	tests := []struct {
+		formula string
+		want    string
+	}{
+		{"A1+A5", "#REF!+A3"},
+		{"$A$1", "$A$1"},
+		{"SUM(A2:A4)", "SUM(#REF!)"},
+	}
+	for _, tt := range tests {
+		if got, _ := translateFormula(tt.formula, ctx); got != tt.want {
+			t.Errorf("translateFormula(%q) = %q, want %q", tt.formula, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteSheetName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Data", "Data"},
+		{"Sheet_2", "Sheet_2"},
+		{"2023", "'2023'"},
+		{"My Sheet", "'My Sheet'"},
+		{"O'Brien", "'O''Brien'"},
+		{"Лист", "'Лист'"},
+	}
+	for _, tt := range tests {
+		if got := quoteSheetName(tt.name); got != tt.want {
+			t.Errorf("quoteSheetName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := unquoteSheetName(quoteSheetName(tt.name)); got != tt.name {
+			t.Errorf("unquoteSheetName(%q) = %q, want %q", quoteSheetName(tt.name), got, tt.name)
+		}
+	}
+}
+
+func TestTransformFormulas(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{"Sheet1": {{42, 84}}})
+	if err := source.SetCellFormula("Sheet1", "B1", "A1*2"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		formulas    string
+		wantFormula string
+		wantValue   string
+	}{
+		{"default", "", "A1*2", ""},
+		{"translate", FormulasTranslate, "C3*2", ""},
+		{"verbatim", FormulasVerbatim, "A1*2", ""},
+		{"values", FormulasValues, "", "84"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, _ := testTransform(t, &Config{
+				OutputFilename: "out.xlsx",
+				Mappings:       []Mapping{{Source: "Sheet1!A1:B1", Destination: "Sheet1!C3", Formulas: tt.formulas}},
+			}, source)
+			formula, err := output.GetCellFormula("Sheet1", "D3")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if formula != tt.wantFormula {
+				t.Errorf("formula = %q, want %q", formula, tt.wantFormula)
+			}
+			if tt.wantValue == "" {
+				return
+			}
+			if value, _ := output.GetCellValue("Sheet1", "D3"); value != tt.wantValue {
+				t.Errorf("value = %q, want %q", value, tt.wantValue)
+			}
+		})
+	}
+}
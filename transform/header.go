@@ -0,0 +1,66 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// headerIndex maps the header texts of a source row to column numbers
+type headerIndex struct {
+	sheet string
+	row   int
+	cols  map[string]int
+}
+
+func newHeaderIndex(sheet string, row int, values []string) headerIndex {
+	h := headerIndex{sheet: sheet, row: row, cols: make(map[string]int)}
+	for i, value := range values {
+		key := headerKey(value)
+		if _, exists := h.cols[key]; key != "" && !exists {
+			h.cols[key] = i + 1
+		}
+	}
+	return h
+}
+
+// headerKey normalizes a header text: case, line breaks and repeated spaces do not matter
+func headerKey(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// column returns the column of a header. The first column wins if a header is repeated.
+func (h headerIndex) column(header string) (int, error) {
+	col, ok := h.cols[headerKey(header)]
+	if !ok {
+		return 0, fmt.Errorf("header %q not found in row %d of sheet %s", header, h.row, h.sheet)
+	}
+	return col, nil
+}
+
+// columns returns the columns of the headers in the given order, listing all missing headers on failure
+func (h headerIndex) columns(headers []string) ([]int, error) {
+	cols := make([]int, 0, len(headers))
+	var missing []string
+	for _, header := range headers {
+		col, ok := h.cols[headerKey(header)]
+		if !ok {
+			missing = append(missing, fmt.Sprintf("%q", header))
+			continue
+		}
+		cols = append(cols, col)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("headers %s not found in row %d of sheet %s", strings.Join(missing, ", "), h.row, h.sheet)
+	}
+	return cols, nil
+}
+
+// usesHeaders reports whether a filter list names any column by header
+func usesHeaders(filters []Filter) bool {
+	for _, f := range filters {
+		if f.Header != "" || usesHeaders(f.Any) || usesHeaders(f.All) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package transform
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Input is a named source workbook of a transformation. Mappings read from it with a source
+// prefixed by its alias, such as jan:Sheet1!A2:E50. Sources without an alias read from the
+// default input.
+type Input struct {
+	// File is a file name pattern with * wildcards, the input is matched by its alias if empty
+	File     string `yaml:"file,omitempty" json:"file,omitempty"`
+	Optional bool   `yaml:"optional,omitempty" json:"optional,omitempty"`
+	// CSV replaces the csv options of the configuration for this input
+	CSV *CSVOptions `yaml:"csv,omitempty" json:"csv,omitempty"`
+	// Password replaces input_password for this input
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+// inputAlias is the form of input aliases: letters, digits, '_' and '-'
+var inputAlias = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+
+// splitInput splits the input alias off a reference: jan:Sheet1!A1 reads from input jan.
+// Sheet names cannot contain ':', so a ':' before the '!' ends the alias.
+func splitInput(ref string) (alias, rest string) {
+	bang := strings.IndexByte(ref, '!')
+	if bang < 0 {
+		return "", ref
+	}
+	if colon := strings.IndexByte(ref[:bang], ':'); colon >= 0 {
+		return ref[:colon], ref[colon+1:]
+	}
+	return "", ref
+}
+
+// inputReference prefixes a reference with the alias of its input, if any
+func inputReference(alias, ref string) string {
+	if alias == "" {
+		return ref
+	}
+	return alias + ":" + ref
+}
+
+// input returns the alias of the input the mapping reads from, empty for the default input
+func (m Mapping) input() string {
+	alias, _ := splitInput(m.Source)
+	return alias
+}
+
+// matches reports whether an uploaded file belongs to the input
+func (in Input) matches(alias, filename string) bool {
+	name := strings.ToLower(filepath.Base(filename))
+	if in.File != "" {
+		return matchesMask(name, strings.ToLower(in.File))
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) == strings.ToLower(alias)
+}
+
+// validateInputs checks the declared inputs and the inputs the mappings refer to
+func (c *Config) validateInputs() error {
+	for alias := range c.Inputs {
+		if !inputAlias.MatchString(alias) {
+			return fmt.Errorf("inputs: invalid alias %q", alias)
+		}
+		if err := validateCSV(c.Inputs[alias].CSV); err != nil {
+			return fmt.Errorf("inputs: %s: csv: %w", alias, err)
+		}
+	}
+
+	for i, m := range c.Mappings {
+		if alias := m.input(); alias != "" {
+			if _, ok := c.Inputs[alias]; !ok {
+				return fmt.Errorf("mapping %d: unknown input %q", i, alias)
+			}
+		}
+		if alias, _ := splitInput(m.Destination); alias != "" {
+			return fmt.Errorf("mapping %d: destination cannot refer to an input", i)
+		}
+		if m.Join == nil {
+			continue
+		}
+		if alias, _ := splitInput(m.Join.Source); alias != "" {
+			if m.Join.File != "" {
+				return fmt.Errorf("mapping %d: join: use either file or an input in source", i)
+			}
+			if _, ok := c.Inputs[alias]; !ok {
+				return fmt.Errorf("mapping %d: join: unknown input %q", i, alias)
+			}
+		}
+	}
+	return nil
+}
+
+// csvOptions returns the options CSV files of an input are read with
+func (c *Config) csvOptions(alias string) *CSVOptions {
+	if input, ok := c.Inputs[alias]; ok && input.CSV != nil {
+		return input.CSV
+	}
+	return c.CSV
+}
+
+// readsDefault reports whether any mapping reads from the default input
+func (c *Config) readsDefault() bool {
+	for _, m := range c.Mappings {
+		if m.input() == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// aliases returns the declared input aliases in order
+func (c *Config) aliases() []string {
+	aliases := make([]string, 0, len(c.Inputs))
+	for alias := range c.Inputs {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// MatchInput returns the alias of the input an uploaded file belongs to: the input named
+// like the form field, or else the input whose file pattern matches the file name.
+// Other files are the default input, which has the empty alias.
+func (c *Config) MatchInput(field, filename string) (string, error) {
+	if _, ok := c.Inputs[field]; ok {
+		return field, nil
+	}
+	for _, alias := range c.aliases() {
+		if c.Inputs[alias].matches(alias, filename) {
+			return alias, nil
+		}
+	}
+	if len(c.Inputs) > 0 && !c.readsDefault() {
+		return "", fmt.Errorf("file %s does not match any input", filepath.Base(filename))
+	}
+	return "", nil
+}
+
+// CheckInputs checks the aliases of the provided inputs: every alias must be declared
+// and every required input provided. The empty alias is the default input.
+func (c *Config) CheckInputs(aliases []string) error {
+	provided := make(map[string]bool, len(aliases))
+	for _, alias := range aliases {
+		if _, ok := c.Inputs[alias]; alias != "" && !ok {
+			return fmt.Errorf("unknown input %q", alias)
+		}
+		provided[alias] = true
+	}
+
+	if c.readsDefault() && !provided[""] {
+		return fmt.Errorf("source file is required")
+	}
+	var missing []string
+	for _, alias := range c.aliases() {
+		if !c.Inputs[alias].Optional && !provided[alias] {
+			missing = append(missing, alias)
+		}
+	}
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("missing required input %s", missing[0])
+	default:
+		return fmt.Errorf("missing required inputs: %s", strings.Join(missing, ", "))
+	}
+}
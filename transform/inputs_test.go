@@ -0,0 +1,192 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestSplitInput(t *testing.T) {
+	tests := []struct {
+		ref, alias, rest string
+	}{
+		{"jan:Sheet1!A1", "jan", "Sheet1!A1"},
+		{"Sheet1!A1:B2", "", "Sheet1!A1:B2"},
+		{"январь:Лист 1!A2:E", "январь", "Лист 1!A2:E"},
+		{"A1", "", "A1"},
+	}
+	for _, tt := range tests {
+		if alias, rest := splitInput(tt.ref); alias != tt.alias || rest != tt.rest {
+			t.Errorf("splitInput(%q) = %q, %q, want %q, %q", tt.ref, alias, rest, tt.alias, tt.rest)
+		}
+	}
+}
+
+// testInputsConfig reads the default input and the inputs jan, feb and the optional mar
+func testInputsConfig() *Config {
+	return &Config{
+		OutputFilename: "out.xlsx",
+		Inputs: map[string]Input{
+			"jan": {},
+			"feb": {File: "*февраль*.xlsx"},
+			"mar": {File: "*march*", Optional: true},
+		},
+		Mappings: []Mapping{
+			{Source: "Sheet1!A1", Destination: "Sheet1!A1"},
+			{Source: "jan:Sheet1!A1:A", Destination: "Sheet1!A2", Mode: ModeAppend},
+			{Source: "feb:Sheet1!A1:A", Destination: "Sheet1!A2", Mode: ModeAppend},
+			{Source: "mar:Sheet1!A1:A", Destination: "Sheet1!A2", Mode: ModeAppend},
+		},
+	}
+}
+
+func TestMatchInput(t *testing.T) {
+	config := testInputsConfig()
+	tests := []struct {
+		field, filename string
+		want            string
+	}{
+		{"file", "JAN.xlsx", "jan"},
+		{"file", "/tmp/Продажи февраль 2024.XLSX", "feb"},
+		{"mar", "report.xlsx", "mar"},
+		{"file", "march.csv", "mar"},
+		{"file", "jan.xlsx.bak", ""},
+		{"file", "summary.xlsx", ""},
+	}
+	for _, tt := range tests {
+		got, err := config.MatchInput(tt.field, tt.filename)
+		if err != nil || got != tt.want {
+			t.Errorf("MatchInput(%q, %q) = %q, %v, want %q", tt.field, tt.filename, got, err, tt.want)
+		}
+	}
+
+	// Without mappings reading the default input every file must match an input
+	config.Mappings = config.Mappings[1:]
+	if _, err := config.MatchInput("file", "summary.xlsx"); err == nil || err.Error() != "file summary.xlsx does not match any input" {
+		t.Errorf("MatchInput() error = %v", err)
+	}
+}
+
+func TestCheckInputs(t *testing.T) {
+	tests := []struct {
+		aliases []string
+		wantErr string
+	}{
+		{[]string{"", "jan", "feb"}, ""},
+		{[]string{"", "jan", "feb", "mar"}, ""},
+		{[]string{"", "jan", "apr"}, `unknown input "apr"`},
+		{[]string{"jan", "feb"}, "source file is required"},
+		{[]string{"", "jan"}, "missing required input feb"},
+		{[]string{""}, "missing required inputs: feb, jan"},
+	}
+	config := testInputsConfig()
+	for _, tt := range tests {
+		err := config.CheckInputs(tt.aliases)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("CheckInputs(%q) = %v", tt.aliases, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("CheckInputs(%q) error = %v, want %q", tt.aliases, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateInputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		wantErr string
+	}{
+		{"valid", func(*Config) {}, ""},
+		{"invalid alias", func(c *Config) { c.Inputs["a b"] = Input{} }, `inputs: invalid alias "a b"`},
+		{"input csv", func(c *Config) { c.Inputs["jan"] = Input{CSV: &CSVOptions{Delimiter: ";;"}} }, "inputs: jan: csv:"},
+		{"unknown input", func(c *Config) { c.Mappings[1].Source = "apr:Sheet1!A1:A" }, `mapping 1: unknown input "apr"`},
+		{"destination input", func(c *Config) { c.Mappings[0].Destination = "jan:Sheet1!A1" }, "mapping 0: destination cannot refer to an input"},
+		{"join input", func(c *Config) {
+			c.Mappings[0].Source = "Sheet1!A1:B5"
+			c.Mappings[0].Join = &Join{Source: "apr:Ref!A1:B5", Key: "A", LookupKey: "A", Columns: []string{"B"}}
+		}, `mapping 0: join: unknown input "apr"`},
+		{"join file and input", func(c *Config) {
+			c.Mappings[0].Source = "Sheet1!A1:B5"
+			c.Mappings[0].Join = &Join{File: "ref.xlsx", Source: "jan:Ref!A1:B5", Key: "A", LookupKey: "A", Columns: []string{"B"}}
+		}, "join: use either file or an input in source"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testInputsConfig()
+			tt.change(config)
+			err := config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTransformInputs(t *testing.T) {
+	input := func(values ...interface{}) io.Reader {
+		rows := make([][]interface{}, len(values))
+		for i, value := range values {
+			rows[i] = []interface{}{value}
+		}
+		var buf bytes.Buffer
+		if err := testWorkbook(t, map[string][][]interface{}{"Sheet1": rows}).Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+
+	engine := testEngine(t, testInputsConfig())
+	var logged bytes.Buffer
+	engine.Logger = log.New(&logged, "", 0)
+	var out bytes.Buffer
+	_, err := engine.TransformInputs(context.Background(), map[string]io.Reader{
+		"":    input("total"),
+		"jan": input("j1", "j2"),
+		"feb": input("f1"),
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := excelize.OpenReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+
+	want := [][]string{{"total"}, {"j1"}, {"j2"}, {"f1"}}
+	if got := testRows(t, output, "Sheet1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+	if !strings.Contains(logged.String(), "Mapping mar:Sheet1!A1:A -> Sheet1!A2: skipped, input mar was not provided") {
+		t.Errorf("log = %q, want the skipped optional input", logged.String())
+	}
+
+	_, err = engine.TransformInputs(context.Background(), map[string]io.Reader{"": input("total"), "feb": input("f1")}, io.Discard)
+	if err == nil || err.Error() != "missing required input jan" {
+		t.Errorf("TransformInputs() without jan error = %v", err)
+	}
+	_, err = engine.TransformInputs(context.Background(), map[string]io.Reader{
+		"":    input("total"),
+		"jan": strings.NewReader("\x00\x01"),
+		"feb": input("f1"),
+	}, io.Discard)
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to open input jan: ") {
+		t.Errorf("TransformInputs() with a broken input error = %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Join types of the mapping "join" option
+const (
+	JoinLeft  = "left"
+	JoinInner = "inner"
+)
+
+// Join adds columns of a lookup range to the rows of a range mapping, like VLOOKUP:
+// the first lookup row whose key equals the key of the source row is found and its
+// columns are written after the copied columns. Keys and columns are given by letter
+// or by header; headers are searched in the first row of the lookup range.
+type Join struct {
+	File            string   `yaml:"file,omitempty" json:"file,omitempty"`
+	Source          string   `yaml:"source" json:"source"`
+	Key             string   `yaml:"key,omitempty" json:"key,omitempty"`
+	KeyHeader       string   `yaml:"key_header,omitempty" json:"key_header,omitempty"`
+	LookupKey       string   `yaml:"lookup_key,omitempty" json:"lookup_key,omitempty"`
+	LookupKeyHeader string   `yaml:"lookup_key_header,omitempty" json:"lookup_key_header,omitempty"`
+	Columns         []string `yaml:"columns,omitempty" json:"columns,omitempty"`
+	ColumnHeaders   []string `yaml:"column_headers,omitempty" json:"column_headers,omitempty"`
+	Type            string   `yaml:"type,omitempty" json:"type,omitempty"`
+	IgnoreCase      bool     `yaml:"ignore_case,omitempty" json:"ignore_case,omitempty"`
+}
+
+// width returns the number of columns the join writes
+func (j *Join) width() int {
+	if j == nil {
+		return 0
+	}
+	return len(j.Columns) + len(j.ColumnHeaders)
+}
+
+// lookupHeaders reports whether the first row of the lookup range holds headers
+func (j *Join) lookupHeaders() bool {
+	return j.LookupKeyHeader != "" || len(j.ColumnHeaders) > 0
+}
+
+// validateJoin checks the join of a mapping
+func validateJoin(m Mapping) error {
+	j := m.Join
+	if j == nil {
+		return nil
+	}
+
+	_, sourceRange := parseReference(m.Source)
+	if !isRange(sourceRange) {
+		return fmt.Errorf("join requires a range source")
+	}
+	if _, _, endCol, _, err := parseRangeCoords(sourceRange); err == nil && endCol == 0 && len(m.Columns) == 0 {
+		return fmt.Errorf("join requires a last column in the source range, or columns")
+	}
+
+	if j.Source == "" {
+		return fmt.Errorf("join: source is required")
+	}
+	if _, lookupRange := parseReference(j.Source); !isRange(lookupRange) {
+		return fmt.Errorf("join: source must be a range")
+	}
+	if j.File != "" && !filepath.IsLocal(j.File) {
+		return fmt.Errorf("join: file must be a relative path inside the lookup directory")
+	}
+	if err := validateColumnChoice(j.Key, j.KeyHeader, "key"); err != nil {
+		return fmt.Errorf("join: %w", err)
+	}
+	if err := validateColumnChoice(j.LookupKey, j.LookupKeyHeader, "lookup_key"); err != nil {
+		return fmt.Errorf("join: %w", err)
+	}
+
+	if (len(j.Columns) == 0) == (len(j.ColumnHeaders) == 0) {
+		return fmt.Errorf("join: use either columns or column_headers")
+	}
+	for i, col := range j.Columns {
+		if _, err := excelize.ColumnNameToNumber(col); err != nil {
+			return fmt.Errorf("join: columns[%d]: invalid column %q", i, col)
+		}
+	}
+	for i, header := range j.ColumnHeaders {
+		if headerKey(header) == "" {
+			return fmt.Errorf("join: column_headers[%d]: header cannot be empty", i)
+		}
+	}
+
+	switch j.Type {
+	case "", JoinLeft, JoinInner:
+	default:
+		return fmt.Errorf("join: type must be one of left, inner")
+	}
+	return nil
+}
+
+// validateColumnChoice checks that exactly one of a column letter and a header is given
+func validateColumnChoice(column, header, name string) error {
+	if (column == "") == (header == "") {
+		return fmt.Errorf("use either %s or %s_header", name, name)
+	}
+	if column != "" {
+		if _, err := excelize.ColumnNameToNumber(column); err != nil {
+			return fmt.Errorf("invalid %s column %q", name, column)
+		}
+	}
+	return nil
+}
+
+// lookupTable is the index of a lookup range by key
+type lookupTable struct {
+	join    *Join
+	rows    map[string][]sourceCell
+	headers []string
+	opts    copyOptions
+}
+
+// find returns the cells of the lookup row with the given key
+func (t *lookupTable) find(key string) ([]sourceCell, bool) {
+	cells, ok := t.rows[t.key(key)]
+	return cells, ok
+}
+
+func (t *lookupTable) key(value string) string {
+	value = strings.TrimSpace(value)
+	if t.join.IgnoreCase {
+		value = strings.ToLower(value)
+	}
+	return value
+}
+
+// lookupSource returns the workbook the lookup range of a join is read from: the input
+// named in join.Source, or the workbook of the mapping. It is nil if the input was not provided.
+func lookupSource(sources map[string]*sourceWorkbook, sourceFile *sourceWorkbook, join *Join) *sourceWorkbook {
+	if input, _ := splitInput(join.Source); input != "" {
+		return sources[input]
+	}
+	return sourceFile
+}
+
+// loadLookup reads the lookup range of a join into memory. The lookup range is read
+// from a source workbook, or from join.File in LookupDir.
+func (e *Engine) loadLookup(sourceFile *sourceWorkbook, destFile *outputWorkbook, join *Join, opts copyOptions) (*lookupTable, error) {
+	if sourceFile == nil {
+		input, _ := splitInput(join.Source)
+		return nil, fmt.Errorf("input %s was not provided", input)
+	}
+	lookupFile := sourceFile
+	styles := sourceFile.styles
+	if join.File != "" {
+		if e.LookupDir == "" {
+			return nil, fmt.Errorf("lookup files are not enabled")
+		}
+		data, err := os.ReadFile(filepath.Join(e.LookupDir, join.File))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lookup file: %w", err)
+		}
+		password, passwordErr := e.password("")
+		lookupFile, err = openSource(data, join.File, e.config.CSV, password)
+		if errors.Is(err, ErrPasswordRequired) && passwordErr != nil {
+			err = passwordErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lookup file %s: %w", join.File, err)
+		}
+		defer lookupFile.Close()
+		// Style IDs belong to the workbook they are read from
+		styles = newStyleCache(lookupFile.File, destFile.File)
+	}
+
+	// Only the rows of the lookup range matter, columns are given by their letters or headers
+	sheet, ref := parseReference(join.Source)
+	var startRow, endRow int
+	var err error
+	if isUsedRange(ref) {
+		_, startRow, _, endRow, _, err = scanUsedRange(lookupFile, sheet)
+	} else {
+		_, startRow, _, endRow, err = parseRangeCoords(ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lookup range: %w", err)
+	}
+	if endRow == 0 {
+		endRow = math.MaxInt
+	}
+
+	table := &lookupTable{join: join, rows: make(map[string][]sourceCell)}
+	table.opts = opts
+	table.opts.styles = styles
+	// Lookup formulas refer to the lookup sheet, their values are copied
+	table.opts.Formulas = FormulasValues
+
+	keyCol, columns, err := joinColumns(join)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := lookupFile.Rows(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lookup sheet %s: %w", sheet, err)
+	}
+	defer rows.Close()
+
+	cellsReader, err := openSheetCells(lookupFile, sheet)
+	if err == nil {
+		defer cellsReader.Close()
+	}
+
+	for r := 1; r <= endRow && rows.Next(); r++ {
+		row, err := rows.Columns()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lookup row %d: %w", r, err)
+		}
+		var cells *sheetRow
+		if cellsReader != nil {
+			if cells, err = cellsReader.row(r); err != nil {
+				return nil, fmt.Errorf("failed to read lookup row %d: %w", r, err)
+			}
+		}
+		if r < startRow {
+			continue
+		}
+
+		// Headers are searched in the first row of the lookup range
+		if r == startRow && join.lookupHeaders() {
+			headers := newHeaderIndex(sheet, r, row)
+			if join.LookupKeyHeader != "" {
+				if keyCol, err = headers.column(join.LookupKeyHeader); err != nil {
+					return nil, err
+				}
+			}
+			if len(join.ColumnHeaders) > 0 {
+				if columns, err = headers.columns(join.ColumnHeaders); err != nil {
+					return nil, err
+				}
+				table.headers = join.ColumnHeaders
+			}
+			continue
+		}
+
+		if keyCol > len(row) {
+			continue
+		}
+		key := table.key(row[keyCol-1])
+		if _, exists := table.rows[key]; key == "" || exists {
+			continue
+		}
+
+		found := make([]sourceCell, len(columns))
+		for i, c := range columns {
+			if c > len(row) {
+				continue
+			}
+			cellName, _ := excelize.CoordinatesToCellName(c, r)
+			if cells != nil {
+				found[i] = cells.sourceCell(sheet, c, row[c-1])
+			} else if found[i], err = readSourceCell(lookupFile.File, sheet, cellName); err != nil {
+				return nil, err
+			}
+		}
+		table.rows[key] = found
+	}
+	if err := rows.Error(); err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+// joinColumns returns the lookup key column and the lookup columns given by letter
+func joinColumns(join *Join) (int, []int, error) {
+	keyCol := 0
+	if join.LookupKey != "" {
+		col, err := excelize.ColumnNameToNumber(join.LookupKey)
+		if err != nil {
+			return 0, nil, err
+		}
+		keyCol = col
+	}
+	var columns []int
+	for _, name := range join.Columns {
+		col, err := excelize.ColumnNameToNumber(name)
+		if err != nil {
+			return 0, nil, err
+		}
+		columns = append(columns, col)
+	}
+	return keyCol, columns, nil
+}
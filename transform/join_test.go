@@ -0,0 +1,132 @@
+package transform
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestTransformJoin(t *testing.T) {
+	lookupRows := [][]interface{}{{"Key", "Region"}, {"k1", "North"}, {"k2", "South"}, {"k1", "Duplicate"}}
+	source := testWorkbook(t, map[string][][]interface{}{
+		"Sheet1": {{"ID", "Name"}, {"k1", "a"}, {"K2", "b"}, {"k3", "c"}, {"k1", "d"}},
+		"Ref":    lookupRows,
+	})
+
+	// Lookup files are read from the lookup directory
+	dir := t.TempDir()
+	lookup := testWorkbook(t, map[string][][]interface{}{"Ref": lookupRows})
+	if err := lookup.SaveAs(filepath.Join(dir, "ref.xlsx")); err != nil {
+		t.Fatal(err)
+	}
+
+	left := [][]string{{"ID", "Name"}, {"k1", "a", "North"}, {"K2", "b"}, {"k3", "c"}, {"k1", "d", "North"}}
+	tests := []struct {
+		name          string
+		join          Join
+		want          [][]string
+		wantUnmatched []string
+	}{
+		{
+			name:          "left, the first duplicate key wins",
+			join:          Join{Source: "Ref!A1:B4", Key: "A", LookupKey: "A", Columns: []string{"B"}},
+			want:          left,
+			wantUnmatched: []string{"K2", "k3"},
+		},
+		{
+			name:          "inner",
+			join:          Join{Source: "Ref!A1:B4", Key: "A", LookupKey: "A", Columns: []string{"B"}, Type: JoinInner},
+			want:          [][]string{{"ID", "Name"}, {"k1", "a", "North"}, {"k1", "d", "North"}},
+			wantUnmatched: []string{"K2", "k3"},
+		},
+		{
+			name:          "ignore case",
+			join:          Join{Source: "Ref!A1:B4", Key: "A", LookupKey: "A", Columns: []string{"B"}, IgnoreCase: true},
+			want:          [][]string{{"ID", "Name"}, {"k1", "a", "North"}, {"K2", "b", "South"}, {"k3", "c"}, {"k1", "d", "North"}},
+			wantUnmatched: []string{"k3"},
+		},
+		{
+			name:          "headers",
+			join:          Join{Source: "Ref!A1:B4", KeyHeader: "id", LookupKeyHeader: "KEY", ColumnHeaders: []string{"Region"}},
+			want:          [][]string{{"ID", "Name", "Region"}, {"k1", "a", "North"}, {"K2", "b"}, {"k3", "c"}, {"k1", "d", "North"}},
+			wantUnmatched: []string{"K2", "k3"},
+		},
+		{
+			name:          "lookup file",
+			join:          Join{File: "ref.xlsx", Source: "Ref!A:B", Key: "A", LookupKey: "A", Columns: []string{"B"}},
+			want:          left,
+			wantUnmatched: []string{"K2", "k3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := testEngine(t, &Config{
+				OutputFilename: "out.xlsx",
+				Mappings: []Mapping{{
+					Source:      "Sheet1!A1:B5",
+					Destination: "Sheet1!A1",
+					HeaderRow:   1,
+					Join:        &tt.join,
+				}},
+			})
+			engine.LookupDir = dir
+			output, report := testRun(t, engine, source)
+
+			if got := testRows(t, output, "Sheet1"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+			mapping := report.Mappings[0]
+			if mapping.ErrorCount != 0 {
+				t.Errorf("errors = %q", mapping.Errors)
+			}
+			if !reflect.DeepEqual(mapping.UnmatchedKeys, tt.wantUnmatched) || mapping.Unmatched != len(tt.wantUnmatched) {
+				t.Errorf("unmatched = %d %q, want %q", mapping.Unmatched, mapping.UnmatchedKeys, tt.wantUnmatched)
+			}
+		})
+	}
+}
+
+func TestTransformJoinErrors(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{"Sheet1": {{"ID"}, {"k1"}}})
+	dir := t.TempDir()
+	lookup := testWorkbook(t, map[string][][]interface{}{"Ref": {{"k1", "North"}}})
+	if err := lookup.SaveAs(filepath.Join(dir, "secret.xlsx"), excelize.Options{Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EX2EX_TEST_LOOKUP_PASSWORD", "")
+
+	tests := []struct {
+		name      string
+		file      string
+		password  string
+		lookupDir string
+		wantErr   string
+	}{
+		{"lookup files disabled", "secret.xlsx", "pass", "", "join: lookup files are not enabled"},
+		{"missing file", "other.xlsx", "pass", dir, "failed to read lookup file"},
+		{"no password", "secret.xlsx", "", dir, ErrPasswordRequired.Error()},
+		{"wrong password", "secret.xlsx", "other", dir, ErrWrongPassword.Error()},
+		{"unset password variable", "secret.xlsx", "${EX2EX_TEST_LOOKUP_PASSWORD}", dir, "environment variable EX2EX_TEST_LOOKUP_PASSWORD is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := testEngine(t, &Config{
+				OutputFilename: "out.xlsx",
+				InputPassword:  tt.password,
+				Mappings: []Mapping{{
+					Source:      "Sheet1!A1:A2",
+					Destination: "Sheet1!A1",
+					Join:        &Join{File: tt.file, Source: "Ref!A1:B1", Key: "A", LookupKey: "A", Columns: []string{"B"}},
+				}},
+			})
+			engine.LookupDir = tt.lookupDir
+			_, report := testRun(t, engine, source)
+			if errs := report.Mappings[0].Errors; len(errs) != 1 || !strings.Contains(errs[0], tt.wantErr) {
+				t.Errorf("errors = %q, want %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,622 @@
+package transform
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// odsMimetype is the media type of OpenDocument spreadsheets, stored in the mimetype entry of the package
+const odsMimetype = "application/vnd.oasis.opendocument.spreadsheet"
+
+// OpenDocument XML namespaces used by the .ods reader
+const (
+	odsOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odsTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsTextNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// Built-in number formats given to typed .ods values
+const (
+	odsDateFmt     = 14 // m/d/yyyy
+	odsDateTimeFmt = 22 // m/d/yy h:mm
+	odsTimeFmt     = 21 // h:mm:ss
+	odsPercentFmt  = 10 // 0.00%
+)
+
+// odsDateLayouts are the forms of office:date-value
+var odsDateLayouts = []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04:05.999999999Z07:00", "2006-01-02"}
+
+// odsDuration matches office:time-value durations such as PT10H30M00S
+var odsDuration = regexp.MustCompile(`^(-)?P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// isODS reports whether data is an OpenDocument spreadsheet package
+func isODS(data []byte) bool {
+	if !bytes.HasPrefix(data, zipSignature) {
+		return false
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	for _, entry := range archive.File {
+		if entry.Name != "mimetype" {
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return false
+		}
+		defer r.Close()
+		mimetype, _ := io.ReadAll(io.LimitReader(r, 128))
+		return strings.HasPrefix(string(bytes.TrimSpace(mimetype)), odsMimetype)
+	}
+	return false
+}
+
+// readODS reads the sheets of an .ods package into a workbook. Cells keep their types:
+// numbers, dates, times and percentages become numbers with a matching number format.
+// Formulas are read as their calculated values.
+func readODS(data []byte) (*sourceWorkbook, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var content *zip.File
+	for _, entry := range archive.File {
+		switch entry.Name {
+		case "content.xml":
+			content = entry
+		case "META-INF/manifest.xml":
+			if manifest, err := readZipEntry(entry); err == nil && bytes.Contains(manifest, []byte("encryption-data")) {
+				return nil, fmt.Errorf("password-protected .ods files are not supported")
+			}
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("content.xml not found, file is not an OpenDocument spreadsheet")
+	}
+
+	r, err := content.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	file := excelize.NewFile()
+	defer file.Close()
+	reader := &odsReader{file: file, styles: make(map[int]int)}
+	if err := reader.read(xml.NewDecoder(bufio.NewReader(r))); err != nil {
+		return nil, err
+	}
+
+	// The package is read back so that sheets are streamed like those of .xlsx files
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	workbook, err := excelize.OpenReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	return &sourceWorkbook{File: workbook, data: buf.Bytes()}, nil
+}
+
+// readZipEntry reads an entry of a zip archive
+func readZipEntry(entry *zip.File) ([]byte, error) {
+	r, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// odsReader writes the tables of content.xml to the sheets of a workbook
+type odsReader struct {
+	file *excelize.File
+	// styles are the styles of the number formats by format index
+	styles map[int]int
+	// stream is the writer of the current sheet
+	stream *excelize.StreamWriter
+	sheet  string
+	// row is the number of the next row, cells the values of the current row
+	row   int
+	cells []interface{}
+	// blanks is the number of empty cells since the last value of the row
+	blanks int
+	// keepDefault is set when a table is named like the default sheet of new workbooks
+	keepDefault bool
+}
+
+// read decodes the document and writes every table to a sheet of the same name
+func (r *odsReader) read(decoder *xml.Decoder) error {
+	rowRepeat := 1
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read content.xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space != odsTableNS {
+				continue
+			}
+			switch t.Name.Local {
+			case "table":
+				if err := r.startSheet(odsAttr(t, odsTableNS, "name")); err != nil {
+					return err
+				}
+			case "table-row":
+				rowRepeat = odsRepeat(t, "number-rows-repeated")
+				r.cells, r.blanks = r.cells[:0], 0
+			case "table-cell", "covered-table-cell":
+				if r.stream == nil {
+					continue
+				}
+				text, err := odsCellText(decoder)
+				if err != nil {
+					return fmt.Errorf("sheet %s: %w", r.sheet, err)
+				}
+				if err := r.addCell(t, text); err != nil {
+					return fmt.Errorf("sheet %s: %w", r.sheet, err)
+				}
+			}
+
+		case xml.EndElement:
+			if t.Name.Space != odsTableNS || r.stream == nil {
+				continue
+			}
+			switch t.Name.Local {
+			case "table-row":
+				if err := r.endRow(rowRepeat); err != nil {
+					return fmt.Errorf("sheet %s: %w", r.sheet, err)
+				}
+			case "table":
+				if err := r.stream.Flush(); err != nil {
+					return fmt.Errorf("sheet %s: %w", r.sheet, err)
+				}
+				r.stream = nil
+			}
+		}
+	}
+
+	if r.sheet == "" {
+		return fmt.Errorf("no sheets found")
+	}
+	if !r.keepDefault && len(r.file.GetSheetList()) > 1 {
+		return r.file.DeleteSheet("Sheet1")
+	}
+	return nil
+}
+
+// startSheet creates the sheet of a table and its stream writer
+func (r *odsReader) startSheet(name string) error {
+	if name == "Sheet1" {
+		r.keepDefault = true
+	} else if _, err := r.file.NewSheet(name); err != nil {
+		return fmt.Errorf("failed to create sheet %s: %w", name, err)
+	}
+	stream, err := r.file.NewStreamWriter(name)
+	if err != nil {
+		return fmt.Errorf("failed to create sheet %s: %w", name, err)
+	}
+	r.stream, r.sheet, r.row = stream, name, 1
+	return nil
+}
+
+// addCell adds a cell, repeated as many times as the table says, to the current row.
+// Empty cells are only counted, so that long runs of trailing empty cells cost nothing.
+func (r *odsReader) addCell(e xml.StartElement, text string) error {
+	repeat := odsRepeat(e, "number-columns-repeated")
+	value, err := r.cellValue(e, text)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		r.blanks += repeat
+		return nil
+	}
+	if len(r.cells)+r.blanks+repeat > excelize.MaxColumns {
+		return fmt.Errorf("row %d has more than %d columns", r.row, excelize.MaxColumns)
+	}
+	r.cells = append(r.cells, make([]interface{}, r.blanks)...)
+	for i := 0; i < repeat; i++ {
+		r.cells = append(r.cells, value)
+	}
+	r.blanks = 0
+	return nil
+}
+
+// endRow writes the current row as many times as the table says
+func (r *odsReader) endRow(repeat int) error {
+	if len(r.cells) == 0 {
+		r.row += repeat
+		return nil
+	}
+	if r.row+repeat-1 > excelize.TotalRows {
+		return fmt.Errorf("sheet has more than %d rows", excelize.TotalRows)
+	}
+	for i := 0; i < repeat; i++ {
+		cell, _ := excelize.CoordinatesToCellName(1, r.row)
+		if err := r.stream.SetRow(cell, r.cells); err != nil {
+			return fmt.Errorf("row %d: %w", r.row, err)
+		}
+		r.row++
+	}
+	return nil
+}
+
+// cellValue converts a cell to the value written to the sheet, nil for empty cells
+func (r *odsReader) cellValue(e xml.StartElement, text string) (interface{}, error) {
+	value := odsAttr(e, odsOfficeNS, "value")
+	switch odsAttr(e, odsOfficeNS, "value-type") {
+	case "float", "currency":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n, nil
+		}
+	case "percentage":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return r.styled(n, odsPercentFmt)
+		}
+	case "date":
+		if d, ok := parseODSDate(odsAttr(e, odsOfficeNS, "date-value")); ok {
+			if d.Hour() == 0 && d.Minute() == 0 && d.Second() == 0 && d.Nanosecond() == 0 {
+				return r.styled(excelSerial(d), odsDateFmt)
+			}
+			return r.styled(excelSerial(d), odsDateTimeFmt)
+		}
+	case "time":
+		if n, ok := parseODSDuration(odsAttr(e, odsOfficeNS, "time-value")); ok {
+			return r.styled(n, odsTimeFmt)
+		}
+	case "boolean":
+		switch odsAttr(e, odsOfficeNS, "boolean-value") {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	case "string":
+		if s := odsAttr(e, odsOfficeNS, "string-value"); s != "" {
+			return s, nil
+		}
+	}
+	if text == "" {
+		return nil, nil
+	}
+	return text, nil
+}
+
+// styled returns a number cell with a built-in number format
+func (r *odsReader) styled(n float64, numFmt int) (interface{}, error) {
+	styleID, ok := r.styles[numFmt]
+	if !ok {
+		var err error
+		if styleID, err = r.file.NewStyle(&excelize.Style{NumFmt: numFmt}); err != nil {
+			return nil, fmt.Errorf("failed to create number format: %w", err)
+		}
+		r.styles[numFmt] = styleID
+	}
+	return excelize.Cell{StyleID: styleID, Value: n}, nil
+}
+
+// odsCellText reads the paragraphs of a cell up to its end element. Comments and drawings
+// anchored to the cell are skipped.
+func odsCellText(decoder *xml.Decoder) (string, error) {
+	var text strings.Builder
+	paragraphs, depth, skip := 0, 0, 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case skip > 0:
+				skip++
+			case depth == 1 && (t.Name.Space != odsTextNS || t.Name.Local != "p"):
+				skip = 1
+			case depth == 1:
+				if paragraphs > 0 {
+					text.WriteByte('\n')
+				}
+				paragraphs++
+			case t.Name.Space == odsTextNS:
+				switch t.Name.Local {
+				case "s":
+					n, err := strconv.Atoi(odsAttr(t, odsTextNS, "c"))
+					if err != nil || n < 1 {
+						n = 1
+					}
+					text.WriteString(strings.Repeat(" ", min(n, 1000)))
+				case "tab":
+					text.WriteByte('\t')
+				case "line-break":
+					text.WriteByte('\n')
+				}
+			}
+		case xml.EndElement:
+			if depth == 0 {
+				return text.String(), nil
+			}
+			depth--
+			if skip > 0 {
+				skip--
+			}
+		case xml.CharData:
+			if depth > 0 && skip == 0 {
+				text.Write(t)
+			}
+		}
+	}
+}
+
+// odsAttr returns the value of an attribute of an element
+func odsAttr(e xml.StartElement, space, local string) string {
+	for _, attr := range e.Attr {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// odsRepeat returns the repeat count of a row or cell, at least 1
+func odsRepeat(e xml.StartElement, name string) int {
+	n, err := strconv.Atoi(odsAttr(e, odsTableNS, name))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// parseODSDate parses an office:date-value
+func parseODSDate(value string) (time.Time, bool) {
+	for _, layout := range odsDateLayouts {
+		if d, err := time.Parse(layout, value); err == nil {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseODSDuration converts an office:time-value such as PT10H30M00S to a fraction of days
+func parseODSDuration(value string) (float64, bool) {
+	m := odsDuration.FindStringSubmatch(value)
+	if m == nil {
+		return 0, false
+	}
+	var days float64
+	for i, unit := range []float64{1, 24, 24 * 60, 24 * 60 * 60} {
+		if m[i+2] != "" {
+			n, _ := strconv.ParseFloat(m[i+2], 64)
+			days += n / unit
+		}
+	}
+	if m[1] != "" {
+		days = -days
+	}
+	return days, true
+}
+
+// excelSerial converts a date to an Excel serial of the 1900 date system
+func excelSerial(d time.Time) float64 {
+	y, m, day := d.Date()
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	date := time.Date(y, m, day, d.Hour(), d.Minute(), d.Second(), d.Nanosecond(), time.UTC)
+	serial := date.Sub(epoch).Hours() / 24
+	// Excel counts the nonexistent 29 February 1900
+	if serial < 61 {
+		serial--
+	}
+	return serial
+}
+
+// odsContentStyles are the cell styles of the exported content.xml: dates as DD.MM.YYYY,
+// times as hh:mm:ss and percentages with two decimals
+const odsContentStyles = `<office:automatic-styles>` +
+	`<number:date-style style:name="N1"><number:day number:style="long"/><number:text>.</number:text><number:month number:style="long"/><number:text>.</number:text><number:year number:style="long"/></number:date-style>` +
+	`<number:date-style style:name="N2"><number:day number:style="long"/><number:text>.</number:text><number:month number:style="long"/><number:text>.</number:text><number:year number:style="long"/><number:text> </number:text><number:hours number:style="long"/><number:text>:</number:text><number:minutes number:style="long"/><number:text>:</number:text><number:seconds number:style="long"/></number:date-style>` +
+	`<number:time-style style:name="N3"><number:hours number:style="long"/><number:text>:</number:text><number:minutes number:style="long"/><number:text>:</number:text><number:seconds number:style="long"/></number:time-style>` +
+	`<number:percentage-style style:name="N4"><number:number number:decimal-places="2" number:min-integer-digits="1"/><number:text>%</number:text></number:percentage-style>` +
+	`<style:style style:name="ce1" style:family="table-cell" style:parent-style-name="Default" style:data-style-name="N1"/>` +
+	`<style:style style:name="ce2" style:family="table-cell" style:parent-style-name="Default" style:data-style-name="N2"/>` +
+	`<style:style style:name="ce3" style:family="table-cell" style:parent-style-name="Default" style:data-style-name="N3"/>` +
+	`<style:style style:name="ce4" style:family="table-cell" style:parent-style-name="Default" style:data-style-name="N4"/>` +
+	`</office:automatic-styles>`
+
+// odsNamespaces are the namespace declarations of the exported documents
+const odsNamespaces = `xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" ` +
+	`xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0" ` +
+	`xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" ` +
+	`xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" ` +
+	`xmlns:number="urn:oasis:names:tc:opendocument:xmlns:datastyle:1.0" ` +
+	`office:version="1.2"`
+
+const odsStyles = xml.Header + `<office:document-styles ` + odsNamespaces + `>` +
+	`<office:styles><style:style style:name="Default" style:family="table-cell"/></office:styles>` +
+	`</office:document-styles>`
+
+const odsManifest = xml.Header + `<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">` +
+	`<manifest:file-entry manifest:full-path="/" manifest:version="1.2" manifest:media-type="` + odsMimetype + `"/>` +
+	`<manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>` +
+	`<manifest:file-entry manifest:full-path="styles.xml" manifest:media-type="text/xml"/>` +
+	`</manifest:manifest>`
+
+// writeODS writes the sheets as an .ods package. Cells keep their types, formulas are saved as values.
+func (ex *exporter) writeODS(w io.Writer, sheets []string) error {
+	archive := zip.NewWriter(w)
+
+	// The mimetype comes first and uncompressed, so that the format is recognized by its header
+	mimetype, err := archive.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE([]byte(odsMimetype)),
+		CompressedSize64:   uint64(len(odsMimetype)),
+		UncompressedSize64: uint64(len(odsMimetype)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, odsMimetype); err != nil {
+		return err
+	}
+
+	for _, entry := range []struct{ name, data string }{
+		{"META-INF/manifest.xml", odsManifest},
+		{"styles.xml", odsStyles},
+	} {
+		f, err := archive.Create(entry.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, entry.data); err != nil {
+			return err
+		}
+	}
+
+	content, err := archive.Create("content.xml")
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(content)
+	out.WriteString(xml.Header + `<office:document-content ` + odsNamespaces + `>` + odsContentStyles + `<office:body><office:spreadsheet>`)
+	for _, sheet := range sheets {
+		if err := ex.writeODSTable(out, sheet); err != nil {
+			return err
+		}
+	}
+	out.WriteString(`</office:spreadsheet></office:body></office:document-content>`)
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// writeODSTable writes a sheet as a table. Runs of empty rows and cells are written once, repeated.
+func (ex *exporter) writeODSTable(out *bufio.Writer, sheet string) error {
+	width := sheetWidth(ex.workbook, sheet)
+	fmt.Fprintf(out, `<table:table table:name="%s"><table:table-column table:number-columns-repeated="%d"/>`, odsEscape(sheet), max(width, 1))
+
+	blankRows := 0
+	err := eachRow(ex.workbook, sheet, func(values *rowValues) error {
+		if isBlankRow(values.values) {
+			blankRows++
+			return nil
+		}
+		if blankRows > 0 {
+			fmt.Fprintf(out, `<table:table-row table:number-rows-repeated="%d"><table:table-cell/></table:table-row>`, blankRows)
+			blankRows = 0
+		}
+
+		out.WriteString(`<table:table-row>`)
+		blanks := 0
+		for col := 1; col <= len(values.values); col++ {
+			cell := ex.cell(values, col)
+			if cell.kind == cellEmpty {
+				blanks++
+				continue
+			}
+			if blanks > 0 {
+				fmt.Fprintf(out, `<table:table-cell table:number-columns-repeated="%d"/>`, blanks)
+				blanks = 0
+			}
+			writeODSCell(out, cell)
+		}
+		if blanks > 0 || len(values.values) == 0 {
+			out.WriteString(`<table:table-cell/>`)
+		}
+		_, err := out.WriteString(`</table:table-row>`)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = out.WriteString(`</table:table>`)
+	return err
+}
+
+// writeODSCell writes a typed cell with its displayed value as text
+func writeODSCell(out *bufio.Writer, cell exportCell) {
+	number := strconv.FormatFloat(cell.number, 'f', -1, 64)
+	switch cell.kind {
+	case cellFloat:
+		fmt.Fprintf(out, `<table:table-cell office:value-type="float" office:value="%s">`, number)
+	case cellPercentage:
+		fmt.Fprintf(out, `<table:table-cell table:style-name="ce4" office:value-type="percentage" office:value="%s">`, number)
+	case cellDate:
+		if value := isoDate(cell.date); len(value) > len("2006-01-02") {
+			fmt.Fprintf(out, `<table:table-cell table:style-name="ce2" office:value-type="date" office:date-value="%s">`, value)
+		} else {
+			fmt.Fprintf(out, `<table:table-cell table:style-name="ce1" office:value-type="date" office:date-value="%s">`, value)
+		}
+	case cellTime:
+		seconds := int(math.Round(cell.number * 24 * 60 * 60))
+		fmt.Fprintf(out, `<table:table-cell table:style-name="ce3" office:value-type="time" office:time-value="PT%02dH%02dM%02dS">`,
+			seconds/3600, seconds/60%60, seconds%60)
+	case cellBoolean:
+		fmt.Fprintf(out, `<table:table-cell office:value-type="boolean" office:boolean-value="%t">`, cell.flag)
+	default:
+		out.WriteString(`<table:table-cell office:value-type="string">`)
+	}
+	for _, line := range strings.Split(cell.text, "\n") {
+		out.WriteString(`<text:p>` + odsParagraph(line) + `</text:p>`)
+	}
+	out.WriteString(`</table:table-cell>`)
+}
+
+// odsParagraph escapes the text of a paragraph. Leading and repeated spaces and tabs are written
+// as elements, since whitespace in paragraphs is collapsed.
+func odsParagraph(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case '\t':
+			b.WriteString(`<text:tab/>`)
+			i++
+		case ' ':
+			n := len(line[i:]) - len(strings.TrimLeft(line[i:], " "))
+			if i > 0 {
+				b.WriteByte(' ')
+				n--
+			}
+			if n > 0 {
+				fmt.Fprintf(&b, `<text:s text:c="%d"/>`, n)
+			}
+			i += len(line[i:]) - len(strings.TrimLeft(line[i:], " "))
+		default:
+			n := strings.IndexAny(line[i:], " \t")
+			if n < 0 {
+				n = len(line) - i
+			}
+			b.WriteString(odsEscape(line[i : i+n]))
+			i += n
+		}
+	}
+	return b.String()
+}
+
+// odsEscape escapes text for XML content and attributes
+func odsEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
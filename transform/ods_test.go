@@ -0,0 +1,247 @@
+package transform
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// testODS builds an .ods package with the tables as the body of content.xml
+func testODS(t *testing.T, tables string, extra map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	entries := map[string]string{
+		"mimetype": odsMimetype,
+		"content.xml": `<?xml version="1.0" encoding="UTF-8"?>` +
+			`<office:document-content ` + odsNamespaces + `><office:body><office:spreadsheet>` +
+			tables + `</office:spreadsheet></office:body></office:document-content>`,
+	}
+	for name, content := range extra {
+		entries[name] = content
+	}
+	for _, name := range []string{"mimetype", "content.xml", "META-INF/manifest.xml"} {
+		content, ok := entries[name]
+		if !ok {
+			continue
+		}
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadODS(t *testing.T) {
+	data := testODS(t, `<table:table table:name="Данные">`+
+		`<table:table-row>`+
+		`<table:table-cell office:value-type="string"><text:p>Имя</text:p></table:table-cell>`+
+		`<table:table-cell office:value-type="float" office:value="1234.5"><text:p>1 234,50</text:p></table:table-cell>`+
+		`<table:table-cell office:value-type="percentage" office:value="0.25"><text:p>25%</text:p></table:table-cell>`+
+		`<table:table-cell office:value-type="date" office:date-value="2023-03-15"><text:p>15.03.2023</text:p></table:table-cell>`+
+		`<table:table-cell office:value-type="date" office:date-value="2023-03-15T12:00:00"><text:p>15.03.2023 12:00</text:p></table:table-cell>`+
+		`<table:table-cell office:value-type="time" office:time-value="PT06H00M00S"><text:p>06:00</text:p></table:table-cell>`+
+		`<table:table-cell office:value-type="boolean" office:boolean-value="true"><text:p>ИСТИНА</text:p></table:table-cell>`+
+		`</table:table-row>`+
+		`<table:table-row table:number-rows-repeated="2">`+
+		`<table:table-cell table:number-columns-repeated="2"/>`+
+		`<table:table-cell office:value-type="string" table:number-columns-repeated="2"><text:p>a<text:s text:c="2"/>b</text:p><text:p>c</text:p></table:table-cell>`+
+		`<table:table-cell table:number-columns-repeated="16000"/>`+
+		`</table:table-row>`+
+		`<table:table-row table:number-rows-repeated="1048000"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>`+
+		`<table:table-row>`+
+		`<table:table-cell><office:annotation><text:p>comment</text:p></office:annotation><text:p>note</text:p></table:table-cell>`+
+		`<table:covered-table-cell/>`+
+		`<table:table-cell office:value-type="float" office:value="7" table:formula="of:=3+4"><text:p>7</text:p></table:table-cell>`+
+		`</table:table-row>`+
+		`</table:table>`+
+		`<table:table table:name="Sheet1"><table:table-row><table:table-cell><text:p>x</text:p></table:table-cell></table:table-row></table:table>`,
+		nil)
+
+	src, err := openSource(data, "data.ods", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	if got, want := src.GetSheetList(), []string{"Sheet1", "Данные"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("sheets = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		cell   string
+		want   string
+		numFmt int
+	}{
+		{"A1", "Имя", 0},
+		{"B1", "1234.5", 0},
+		{"C1", "0.25", odsPercentFmt},
+		{"D1", "45000", odsDateFmt},
+		{"E1", "45000.5", odsDateTimeFmt},
+		{"F1", "0.25", odsTimeFmt},
+		{"G1", "1", 0},
+		{"A2", "", 0},
+		{"C2", "a  b\nc", 0},
+		{"D3", "a  b\nc", 0},
+		{"E3", "", 0},
+		{"A1048004", "note", 0},
+		{"B1048004", "", 0},
+		{"C1048004", "7", 0},
+	}
+	for _, tt := range tests {
+		got, err := src.GetCellValue("Данные", tt.cell, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.cell, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cell, got, tt.want)
+		}
+		if tt.numFmt == 0 {
+			continue
+		}
+		styleID, _ := src.GetCellStyle("Данные", tt.cell)
+		if style, err := src.GetStyle(styleID); err != nil || style.NumFmt != tt.numFmt {
+			t.Errorf("%s number format = %v, %v, want %d", tt.cell, style, err, tt.numFmt)
+		}
+	}
+}
+
+func TestReadODSErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"no tables", testODS(t, "", nil), "no sheets found"},
+		{
+			"encrypted",
+			testODS(t, "", map[string]string{"META-INF/manifest.xml": `<manifest:encryption-data/>`}),
+			"password-protected",
+		},
+		{
+			"too many columns",
+			testODS(t, `<table:table table:name="T"><table:table-row>`+
+				`<table:table-cell office:value-type="float" office:value="1" table:number-columns-repeated="16385"/>`+
+				`</table:table-row></table:table>`, nil),
+			"more than 16384 columns",
+		},
+		{
+			"too many rows",
+			testODS(t, `<table:table table:name="T"><table:table-row table:number-rows-repeated="1048577">`+
+				`<table:table-cell><text:p>x</text:p></table:table-cell>`+
+				`</table:table-row></table:table>`, nil),
+			"more than 1048576 rows",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !isODS(tt.data) {
+				t.Fatal("isODS() = false")
+			}
+			_, err := readODS(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readODS() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestODSRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	filename, err := exportData(testExportWorkbook(t, true), FormatODS, "out.xlsx", &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filename != "out.ods" {
+		t.Errorf("filename = %q, want out.ods", filename)
+	}
+	if !isODS(out.Bytes()) {
+		t.Fatal("isODS() = false for the exported package")
+	}
+
+	src, err := readODS(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	// The hidden report sheet is not exported
+	if got := strings.Join(src.GetSheetList(), ","); got != "Data,Notes" {
+		t.Errorf("sheets = %q, want Data,Notes", got)
+	}
+	tests := []struct {
+		sheet, cell string
+		want        string
+	}{
+		{"Data", "A1", "Name"},
+		{"Data", "A2", `"A" & <B>`},
+		{"Data", "B2", "1234.5"},
+		{"Data", "C2", "44999"},
+		{"Data", "D2", "1"},
+		{"Data", "E2", "007"},
+		{"Data", "F2", "0.25"},
+		{"Data", "G2", "0.5"},
+		{"Data", "A3", ""},
+		{"Data", "B4", "-1"},
+		{"Notes", "A2", "ok"},
+	}
+	for _, tt := range tests {
+		got, err := src.GetCellValue(tt.sheet, tt.cell, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Fatalf("%s!%s: %v", tt.sheet, tt.cell, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s!%s = %q, want %q", tt.sheet, tt.cell, got, tt.want)
+		}
+	}
+}
+
+func TestParseODSDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{"PT12H00M00S", 0.5, true},
+		{"PT06H", 0.25, true},
+		{"PT1H30M", 0.0625, true},
+		{"P1DT12H", 1.5, true},
+		{"-PT12H", -0.5, true},
+		{"PT0.5S", 0.5 / 86400, true},
+		{"12:00", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseODSDuration(tt.value); got != tt.want || ok != tt.ok {
+			t.Errorf("parseODSDuration(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExcelSerial(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		want float64
+	}{
+		{time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), 1},
+		{time.Date(1900, 2, 28, 0, 0, 0, 0, time.UTC), 59},
+		{time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC), 61},
+		{time.Date(2023, 3, 15, 18, 0, 0, 0, time.UTC), 45000.75},
+		{time.Date(2023, 3, 15, 0, 0, 0, 0, time.FixedZone("MSK", 3*60*60)), 45000},
+	}
+	for _, tt := range tests {
+		if got := excelSerial(tt.date); got != tt.want {
+			t.Errorf("excelSerial(%v) = %v, want %v", tt.date, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Write modes for the mapping "mode" option
+const (
+	ModeOverwrite = "overwrite"
+	ModeAppend    = "append"
+)
+
+// outputWorkbook is the workbook the mappings write to.
+// Sheets created from output_sheets in a new workbook are written with a StreamWriter:
+// cell writes are buffered by row and flushed in row order as soon as no pending mapping
+// can write above them, so large outputs are generated with bounded memory.
+// All other sheets (template sheets, the report sheet) are written to the workbook directly.
+type outputWorkbook struct {
+	*excelize.File
+	streams map[string]*streamSheet
+	cursors []*destCursor
+	err     error
+
+	// used holds the last row with a value of every column by sheet, tracked for append mappings
+	used      map[string]map[int]int
+	trackUsed bool
+}
+
+// streamSheet buffers the cells of a streamed sheet that have not been written yet
+type streamSheet struct {
+	writer      *excelize.StreamWriter
+	rows        map[int]map[int]*excelize.Cell
+	minBuffered int
+	flushed     int
+}
+
+// destCursor marks the lowest output row a mapping may still write to.
+// The row of an append mapping that has not started yet follows the last used row
+// of its columns minCol..maxCol, as it will write below it.
+type destCursor struct {
+	sheet          string
+	row            int
+	minCol, maxCol int
+	pending        bool
+	done           bool
+}
+
+func newOutputWorkbook(file *excelize.File) *outputWorkbook {
+	return &outputWorkbook{
+		File:    file,
+		streams: make(map[string]*streamSheet),
+	}
+}
+
+// sheetKey normalizes a sheet name, sheet names are case-insensitive in Excel
+func sheetKey(sheet string) string {
+	return strings.ToLower(sheet)
+}
+
+// streamSheet switches the sheet to streaming mode. The sheet must be empty.
+func (w *outputWorkbook) streamSheet(sheet string) error {
+	if _, ok := w.streams[sheetKey(sheet)]; ok {
+		return nil
+	}
+
+	writer, err := w.File.NewStreamWriter(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to create stream writer for sheet %s: %w", sheet, err)
+	}
+	w.streams[sheetKey(sheet)] = &streamSheet{
+		writer:      writer,
+		rows:        make(map[int]map[int]*excelize.Cell),
+		minBuffered: math.MaxInt,
+	}
+	return nil
+}
+
+// streamCell returns the buffered cell of a streamed sheet, or nil if the sheet is not streamed
+func (w *outputWorkbook) streamCell(sheet, cell string) (*excelize.Cell, error) {
+	s, ok := w.streams[sheetKey(sheet)]
+	if !ok {
+		return nil, nil
+	}
+
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return nil, err
+	}
+	if row <= s.flushed {
+		return nil, fmt.Errorf("row %d of sheet %s has already been written", row, sheet)
+	}
+
+	cells, ok := s.rows[row]
+	if !ok {
+		cells = make(map[int]*excelize.Cell)
+		s.rows[row] = cells
+		if row < s.minBuffered {
+			s.minBuffered = row
+		}
+	}
+	c, ok := cells[col]
+	if !ok {
+		c = &excelize.Cell{}
+		cells[col] = c
+	}
+	return c, nil
+}
+
+func (w *outputWorkbook) SetCellValue(sheet, cell string, value interface{}) error {
+	if value != nil && value != "" {
+		w.markUsed(sheet, cell)
+	}
+	c, err := w.streamCell(sheet, cell)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return w.File.SetCellValue(sheet, cell, value)
+	}
+	c.Value = value
+	return nil
+}
+
+func (w *outputWorkbook) SetCellFloat(sheet, cell string, value float64, precision, bitSize int) error {
+	w.markUsed(sheet, cell)
+	c, err := w.streamCell(sheet, cell)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return w.File.SetCellFloat(sheet, cell, value, precision, bitSize)
+	}
+	c.Value = value
+	return nil
+}
+
+func (w *outputWorkbook) SetCellFormula(sheet, cell, formula string, opts ...excelize.FormulaOpts) error {
+	if formula != "" {
+		w.markUsed(sheet, cell)
+	}
+	c, err := w.streamCell(sheet, cell)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return w.File.SetCellFormula(sheet, cell, formula, opts...)
+	}
+	c.Formula = formula
+	return nil
+}
+
+func (w *outputWorkbook) SetCellStyle(sheet, hCell, vCell string, styleID int) error {
+	if _, ok := w.streams[sheetKey(sheet)]; !ok {
+		return w.File.SetCellStyle(sheet, hCell, vCell, styleID)
+	}
+
+	hCol, hRow, err := excelize.CellNameToCoordinates(hCell)
+	if err != nil {
+		return err
+	}
+	vCol, vRow, err := excelize.CellNameToCoordinates(vCell)
+	if err != nil {
+		return err
+	}
+	for row := hRow; row <= vRow; row++ {
+		for col := hCol; col <= vCol; col++ {
+			name, _ := excelize.CoordinatesToCellName(col, row)
+			c, err := w.streamCell(sheet, name)
+			if err != nil {
+				return err
+			}
+			c.StyleID = styleID
+		}
+	}
+	return nil
+}
+
+// reserve registers a mapping that will write to the sheet starting at the given row
+func (w *outputWorkbook) reserve(sheet string, row int) *destCursor {
+	c := &destCursor{sheet: sheetKey(sheet), row: row}
+	w.cursors = append(w.cursors, c)
+	return c
+}
+
+// reserveAppend registers an append mapping that will write to columns minCol..maxCol of the sheet,
+// below their last used row and not above the given row
+func (w *outputWorkbook) reserveAppend(sheet string, row, minCol, maxCol int) *destCursor {
+	c := w.reserve(sheet, row)
+	c.minCol, c.maxCol, c.pending = minCol, maxCol, true
+	w.trackUsed = true
+	return c
+}
+
+// appendRow fixes the first row of an append mapping: the row after the last used row
+// of its columns, or the reserved row if that is lower
+func (w *outputWorkbook) appendRow(c *destCursor) int {
+	c.row = max(c.row, w.lastUsedRow(c.sheet, c.minCol, c.maxCol)+1)
+	c.pending = false
+	return c.row
+}
+
+// markUsed records a cell with a value when append mappings need the used rows
+func (w *outputWorkbook) markUsed(sheet, cell string) {
+	if !w.trackUsed {
+		return
+	}
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return
+	}
+	used := w.usedRows(sheet)
+	if row > used[col] {
+		used[col] = row
+	}
+}
+
+// lastUsedRow returns the last row with a value in columns minCol..maxCol of the sheet, or 0
+func (w *outputWorkbook) lastUsedRow(sheet string, minCol, maxCol int) int {
+	last := 0
+	for col, row := range w.usedRows(sheet) {
+		if col >= minCol && col <= maxCol && row > last {
+			last = row
+		}
+	}
+	return last
+}
+
+// usedRows returns the used rows of a sheet by column. Values already in the sheet,
+// such as template content, are read when the sheet is first used.
+func (w *outputWorkbook) usedRows(sheet string) map[int]int {
+	key := sheetKey(sheet)
+	if used, ok := w.used[key]; ok {
+		return used
+	}
+
+	used := make(map[int]int)
+	if w.used == nil {
+		w.used = make(map[string]map[int]int)
+	}
+	w.used[key] = used
+
+	// Streamed sheets are created empty
+	if _, ok := w.streams[key]; ok {
+		return used
+	}
+	rows, err := w.File.Rows(sheet)
+	if err != nil {
+		return used
+	}
+	defer rows.Close()
+	for r := 1; rows.Next(); r++ {
+		values, err := rows.Columns()
+		if err != nil {
+			break
+		}
+		for i, value := range values {
+			if value != "" {
+				used[i+1] = r
+			}
+		}
+	}
+	return used
+}
+
+// moveTo records that the mapping will not write above the given row any more
+func (c *destCursor) moveTo(row int) {
+	c.row = row
+}
+
+// release records that the mapping has finished writing
+func (c *destCursor) release() {
+	c.done = true
+}
+
+// flush writes the buffered rows no pending mapping can write above any more.
+// Write errors are kept and returned by finish.
+func (w *outputWorkbook) flush() {
+	if len(w.streams) == 0 {
+		return
+	}
+
+	live := w.cursors[:0]
+	for _, c := range w.cursors {
+		if !c.done {
+			live = append(live, c)
+		}
+	}
+	w.cursors = live
+
+	for key, s := range w.streams {
+		limit := math.MaxInt
+		for _, c := range w.cursors {
+			if c.sheet != key {
+				continue
+			}
+			row := c.row
+			if c.pending {
+				row = max(row, w.lastUsedRow(c.sheet, c.minCol, c.maxCol)+1)
+			}
+			if row < limit {
+				limit = row
+			}
+		}
+		w.flushRows(s, limit)
+	}
+}
+
+// flushRows writes the buffered rows of the sheet above limit in row order
+func (w *outputWorkbook) flushRows(s *streamSheet, limit int) {
+	if s.minBuffered >= limit {
+		return
+	}
+
+	rowNums := make([]int, 0, len(s.rows))
+	for row := range s.rows {
+		if row < limit {
+			rowNums = append(rowNums, row)
+		}
+	}
+	sort.Ints(rowNums)
+
+	for _, row := range rowNums {
+		if err := writeStreamRow(s.writer, row, s.rows[row]); err != nil && w.err == nil {
+			w.err = err
+		}
+		delete(s.rows, row)
+	}
+
+	if limit-1 > s.flushed {
+		s.flushed = limit - 1
+	}
+	s.minBuffered = math.MaxInt
+	for row := range s.rows {
+		if row < s.minBuffered {
+			s.minBuffered = row
+		}
+	}
+}
+
+func writeStreamRow(writer *excelize.StreamWriter, row int, cells map[int]*excelize.Cell) error {
+	minCol, maxCol := math.MaxInt, 0
+	for col := range cells {
+		if col < minCol {
+			minCol = col
+		}
+		if col > maxCol {
+			maxCol = col
+		}
+	}
+
+	values := make([]interface{}, maxCol-minCol+1)
+	for col, c := range cells {
+		values[col-minCol] = *c
+	}
+
+	cell, err := excelize.CoordinatesToCellName(minCol, row)
+	if err != nil {
+		return err
+	}
+	return writer.SetRow(cell, values)
+}
+
+// finish writes all remaining rows and completes the streamed sheets
+func (w *outputWorkbook) finish() error {
+	for _, s := range w.streams {
+		w.flushRows(s, math.MaxInt)
+		if err := s.writer.Flush(); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+	w.streams = make(map[string]*streamSheet)
+	return w.err
+}
@@ -0,0 +1,109 @@
+package transform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestTransformOutputOrder(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{
+		"Sheet1": {{"a1", "b1", "c1", "d1"}, {"a2", "b2", "c2", "d2"}, {"a3", "b3", "c3", "d3"}},
+		"Other":  {{"x1", "y1"}, {"x2", "y2"}},
+	})
+
+	tests := []struct {
+		name     string
+		mappings []Mapping
+		want     [][]string
+	}{
+		{
+			// The second mapping reads rows of the same sheet above those of the first one,
+			// it still overwrites B1:B2 after the first one
+			name: "overlapping mappings",
+			mappings: []Mapping{
+				{Source: "Sheet1!A2:B3", Destination: "Out!A1"},
+				{Source: "Sheet1!C1:C2", Destination: "Out!B1"},
+				{Source: "Other!A1:B1", Destination: "Out!B3"},
+			},
+			want: [][]string{{"a2", "c1"}, {"a3", "c2"}, {"", "x1", "y1"}},
+		},
+		{
+			name: "destination rows out of order",
+			mappings: []Mapping{
+				{Source: "Sheet1!A2:B3", Destination: "Out!A4"},
+				{Source: "Other!A1:B2", Destination: "Out!C2"},
+				{Source: "Sheet1!D1", Destination: "Out!A1"},
+				{Source: "Sheet1!C3:D3", Destination: "Out!A6"},
+			},
+			want: [][]string{{"d1"}, {"", "", "x1", "y1"}, {"", "", "x2", "y2"}, {"a2", "b2"}, {"a3", "b3"}, {"c3", "d3"}},
+		},
+		{
+			name: "transpose",
+			mappings: []Mapping{
+				{Source: "Sheet1!A1:C2", Destination: "Out!B2", Transpose: true},
+				{Source: "Other!A2", Destination: "Out!A1"},
+				{Source: "Other!B2", Destination: "Out!A5"},
+			},
+			want: [][]string{{"x2"}, {"", "a1", "a2"}, {"", "b1", "b2"}, {"", "c1", "c2"}, {"y2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, report := testTransform(t, &Config{
+				OutputFilename: "out.xlsx",
+				OutputSheets:   []OutputSheet{{Name: "Out", CreateIfNotExists: true}},
+				Mappings:       tt.mappings,
+			}, source)
+			if report.ErrorCount > 0 {
+				t.Errorf("error count = %d", report.ErrorCount)
+			}
+			if got := testRows(t, output, "Out"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputWorkbookFlush(t *testing.T) {
+	file := excelize.NewFile()
+	defer file.Close()
+	if _, err := file.NewSheet("Out"); err != nil {
+		t.Fatal(err)
+	}
+	output := newOutputWorkbook(file)
+	if err := output.streamSheet("Out"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows below a pending mapping stay buffered, rows above it are written
+	cursor := output.reserve("out", 3)
+	for _, cell := range []string{"B4", "A2", "A1"} {
+		if err := output.SetCellValue("Out", cell, cell); err != nil {
+			t.Fatal(err)
+		}
+	}
+	output.flush()
+	if s := output.streams["out"]; s.flushed != 2 || len(s.rows) != 1 {
+		t.Errorf("flushed = %d with %d buffered rows, want 2 with 1", s.flushed, len(s.rows))
+	}
+	if err := output.SetCellValue("Out", "C2", "late"); err == nil || !strings.Contains(err.Error(), "already been written") {
+		t.Errorf("SetCellValue() on a written row error = %v", err)
+	}
+
+	cursor.moveTo(5)
+	if err := output.SetCellValue("Out", "A3", "A3"); err != nil {
+		t.Fatal(err)
+	}
+	cursor.release()
+	output.flush()
+	if err := output.finish(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"A1"}, {"A2"}, {"A3"}, {"", "B4"}}
+	if got := testRows(t, file, "Out"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
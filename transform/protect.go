@@ -0,0 +1,195 @@
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Errors of encrypted source workbooks
+var (
+	ErrPasswordRequired = errors.New("workbook is encrypted, a password is required")
+	ErrWrongPassword    = errors.New("the workbook password is not correct")
+)
+
+// maxPasswordLength is the longest password Excel accepts
+const maxPasswordLength = 255
+
+// secretReference matches passwords given as ${NAME}, read from the environment variable NAME
+var secretReference = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// Protection protects the output workbook. Passwords may be written as ${NAME} to read them
+// from the environment variable NAME instead of storing them in the profile.
+type Protection struct {
+	// Password encrypts the output file, it cannot be opened without the password
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+	// Sheets are the names or * masks of the output sheets protected from editing
+	Sheets        []string `yaml:"sheets,omitempty" json:"sheets,omitempty"`
+	SheetPassword string   `yaml:"sheet_password,omitempty" json:"sheet_password,omitempty"`
+	// LockStructure prevents adding, deleting, renaming and unhiding sheets
+	LockStructure    bool   `yaml:"lock_structure,omitempty" json:"lock_structure,omitempty"`
+	WorkbookPassword string `yaml:"workbook_password,omitempty" json:"workbook_password,omitempty"`
+}
+
+// secret returns a password, reading ${NAME} references from the environment
+func secret(value string) (string, error) {
+	m := secretReference.FindStringSubmatch(value)
+	if m == nil {
+		return value, nil
+	}
+	password, ok := os.LookupEnv(m[1])
+	if !ok || password == "" {
+		return "", fmt.Errorf("environment variable %s is not set", m[1])
+	}
+	return password, nil
+}
+
+// validatePassword checks the length of a password that is not read from the environment
+func validatePassword(name, value string) error {
+	if !secretReference.MatchString(value) && len([]rune(value)) > maxPasswordLength {
+		return fmt.Errorf("%s must be at most %d characters", name, maxPasswordLength)
+	}
+	return nil
+}
+
+// validateProtection checks the protection of the output workbook
+func (c *Config) validateProtection() error {
+	if err := validatePassword("input_password", c.InputPassword); err != nil {
+		return err
+	}
+	for _, alias := range c.aliases() {
+		if err := validatePassword("password", c.Inputs[alias].Password); err != nil {
+			return fmt.Errorf("inputs: %s: %w", alias, err)
+		}
+	}
+
+	p := c.Protection
+	if p == nil {
+		return nil
+	}
+	if c.outputFormat() != FormatXLSX {
+		return fmt.Errorf("protection: output_format must be xlsx")
+	}
+	for _, password := range []struct{ name, value string }{
+		{"password", p.Password},
+		{"sheet_password", p.SheetPassword},
+		{"workbook_password", p.WorkbookPassword},
+	} {
+		if err := validatePassword(password.name, password.value); err != nil {
+			return fmt.Errorf("protection: %w", err)
+		}
+	}
+	if p.SheetPassword != "" && len(p.Sheets) == 0 {
+		return fmt.Errorf("protection: sheet_password requires sheets")
+	}
+	if p.WorkbookPassword != "" && !p.LockStructure {
+		return fmt.Errorf("protection: workbook_password requires lock_structure")
+	}
+	return nil
+}
+
+// inputPassword returns the password encrypted files of an input are opened with
+func (c *Config) inputPassword(alias string) (string, error) {
+	if input, ok := c.Inputs[alias]; ok && input.Password != "" {
+		return secret(input.Password)
+	}
+	return secret(c.InputPassword)
+}
+
+// password returns the password an input is opened with: the password given to the engine,
+// or else the password of the configuration
+func (e *Engine) password(alias string) (string, error) {
+	if e.Password != "" {
+		return e.Password, nil
+	}
+	return e.config.inputPassword(alias)
+}
+
+// decryptWorkbook decrypts an encrypted .xlsx package
+func decryptWorkbook(data []byte, password string) ([]byte, error) {
+	if password == "" {
+		return nil, ErrPasswordRequired
+	}
+	decrypted, err := excelize.Decrypt(data, &excelize.Options{Password: password})
+	if err != nil || !bytes.HasPrefix(decrypted, zipSignature) {
+		return nil, ErrWrongPassword
+	}
+	return decrypted, nil
+}
+
+// protect applies sheet and workbook protection to the output workbook and returns the workbook
+// to write and the options to write it with. Streamed sheets are only complete once written,
+// so to protect sheets the workbook is read back; the returned workbook must then be closed too.
+func (p *Protection) protect(destFile *excelize.File) (*excelize.File, excelize.Options, error) {
+	var opts excelize.Options
+	password, err := secret(p.Password)
+	if err != nil {
+		return nil, opts, err
+	}
+	opts.Password = password
+
+	file := destFile
+	if len(p.Sheets) > 0 {
+		buf, err := destFile.WriteToBuffer()
+		if err != nil {
+			return nil, opts, err
+		}
+		if file, err = excelize.OpenReader(bytes.NewReader(buf.Bytes())); err != nil {
+			return nil, opts, err
+		}
+		if err := p.protectSheets(file); err != nil {
+			file.Close()
+			return nil, opts, err
+		}
+	}
+
+	if p.LockStructure {
+		password, err := secret(p.WorkbookPassword)
+		if err == nil {
+			err = file.ProtectWorkbook(&excelize.WorkbookProtectionOptions{Password: password, LockStructure: true})
+		}
+		if err != nil {
+			if file != destFile {
+				file.Close()
+			}
+			return nil, opts, fmt.Errorf("failed to protect workbook: %w", err)
+		}
+	}
+	return file, opts, nil
+}
+
+// protectSheets protects the sheets matching the configured names from editing.
+// Selecting cells stays allowed, so that values can be copied.
+func (p *Protection) protectSheets(destFile *excelize.File) error {
+	password, err := secret(p.SheetPassword)
+	if err != nil {
+		return err
+	}
+	sheets := destFile.GetSheetList()
+	for _, mask := range p.Sheets {
+		found := false
+		for _, sheet := range sheets {
+			if !matchesMask(strings.ToLower(sheet), strings.ToLower(mask)) {
+				continue
+			}
+			found = true
+			err := destFile.ProtectSheet(sheet, &excelize.SheetProtectionOptions{
+				Password:            password,
+				SelectLockedCells:   true,
+				SelectUnlockedCells: true,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to protect sheet %s: %w", sheet, err)
+			}
+		}
+		if !found && !strings.Contains(mask, "*") {
+			return fmt.Errorf("protection: sheet %s not found", mask)
+		}
+	}
+	return nil
+}
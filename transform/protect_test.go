@@ -0,0 +1,185 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestTransformEncryptedInput(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{"Sheet1": {{"secret", 42}}})
+	var encrypted bytes.Buffer
+	if err := source.Write(&encrypted, excelize.Options{Password: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EX2EX_TEST_INPUT_PASSWORD", "pass")
+	t.Setenv("EX2EX_TEST_EMPTY_PASSWORD", "")
+
+	tests := []struct {
+		name          string
+		enginePass    string
+		inputPassword string
+		wantErr       error
+		wantText      string
+	}{
+		{name: "engine password", enginePass: "pass"},
+		{name: "configured password", inputPassword: "pass"},
+		{name: "password from the environment", inputPassword: "${EX2EX_TEST_INPUT_PASSWORD}"},
+		{name: "engine password wins", enginePass: "pass", inputPassword: "other"},
+		{name: "no password", wantErr: ErrPasswordRequired},
+		{name: "wrong password", inputPassword: "other", wantErr: ErrWrongPassword},
+		{name: "unset variable", inputPassword: "${EX2EX_TEST_EMPTY_PASSWORD}", wantText: "environment variable EX2EX_TEST_EMPTY_PASSWORD is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := testEngine(t, &Config{
+				OutputFilename: "out.xlsx",
+				InputPassword:  tt.inputPassword,
+				Mappings:       []Mapping{{Source: "Sheet1!A1:B1", Destination: "Sheet1!A1"}},
+			})
+			engine.Password = tt.enginePass
+			var out bytes.Buffer
+			_, err := engine.Transform(context.Background(), bytes.NewReader(encrypted.Bytes()), &out)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Transform() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case tt.wantText != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantText) {
+					t.Errorf("Transform() error = %v, want %q", err, tt.wantText)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			output, err := excelize.OpenReader(&out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer output.Close()
+			if got := testRows(t, output, "Sheet1"); len(got) != 1 || strings.Join(got[0], ",") != "secret,42" {
+				t.Errorf("rows = %q, want [[secret 42]]", got)
+			}
+		})
+	}
+}
+
+func TestTransformProtection(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{"Sheet1": {{"a", 1}, {"b", 2}}})
+	var in bytes.Buffer
+	if err := source.Write(&in); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EX2EX_TEST_SHEET_PASSWORD", "sheet")
+
+	engine := testEngine(t, &Config{
+		OutputFilename: "out.xlsx",
+		OutputSheets:   []OutputSheet{{Name: "Data", CreateIfNotExists: true}, {Name: "Notes", CreateIfNotExists: true}},
+		Mappings:       []Mapping{{Source: "Sheet1!A1:B2", Destination: "Data!A1"}, {Source: "Sheet1!A1", Destination: "Notes!A1"}},
+		Protection: &Protection{
+			Password:         "open",
+			Sheets:           []string{"dat*"},
+			SheetPassword:    "${EX2EX_TEST_SHEET_PASSWORD}",
+			LockStructure:    true,
+			WorkbookPassword: "book",
+		},
+	})
+	var out bytes.Buffer
+	if _, err := engine.Transform(context.Background(), &in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := excelize.OpenReader(bytes.NewReader(out.Bytes())); err == nil {
+		t.Fatal("the output workbook opened without a password")
+	}
+	output, err := excelize.OpenReader(&out, excelize.Options{Password: "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+
+	// The streamed data sheet is complete and protected, the other sheet is not
+	if got := testRows(t, output, "Data"); len(got) != 2 || strings.Join(got[1], ",") != "b,2" {
+		t.Errorf("rows = %q, want two rows", got)
+	}
+	if err := output.UnprotectSheet("Data", "other"); !errors.Is(err, excelize.ErrUnprotectSheetPassword) {
+		t.Errorf("UnprotectSheet(Data) with a wrong password = %v", err)
+	}
+	if err := output.UnprotectSheet("Data", "sheet"); err != nil {
+		t.Errorf("UnprotectSheet(Data) = %v", err)
+	}
+	if err := output.UnprotectSheet("Notes", "sheet"); !errors.Is(err, excelize.ErrUnprotectSheet) {
+		t.Errorf("UnprotectSheet(Notes) = %v, want the sheet unprotected", err)
+	}
+	if err := output.UnprotectWorkbook("book"); err != nil {
+		t.Errorf("UnprotectWorkbook() = %v", err)
+	}
+}
+
+func TestTransformProtectionErrors(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{"Sheet1": {{"a"}}})
+	tests := []struct {
+		name       string
+		protection *Protection
+		wantErr    string
+	}{
+		{"missing sheet", &Protection{Sheets: []string{"Missing"}}, "protection: sheet Missing not found"},
+		{"unset variable", &Protection{Password: "${EX2EX_TEST_MISSING_PASSWORD}"}, "environment variable EX2EX_TEST_MISSING_PASSWORD is not set"},
+		{"unset workbook variable", &Protection{LockStructure: true, WorkbookPassword: "${EX2EX_TEST_MISSING_PASSWORD}"}, "failed to protect workbook: environment variable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var in bytes.Buffer
+			if err := source.Write(&in); err != nil {
+				t.Fatal(err)
+			}
+			engine := testEngine(t, &Config{
+				OutputFilename: "out.xlsx",
+				Mappings:       []Mapping{{Source: "Sheet1!A1", Destination: "Sheet1!A1"}},
+				Protection:     tt.protection,
+			})
+			_, err := engine.Transform(context.Background(), &in, &bytes.Buffer{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Transform() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateProtection(t *testing.T) {
+	long := strings.Repeat("я", maxPasswordLength+1)
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{"passwords", Config{InputPassword: "${IN}", Protection: &Protection{Password: strings.Repeat("я", maxPasswordLength)}}, ""},
+		{"long input password", Config{InputPassword: long}, "input_password must be at most 255 characters"},
+		{"long input password of an input", Config{Inputs: map[string]Input{"jan": {Password: long}}}, "inputs: jan: password must be"},
+		{"export", Config{OutputFormat: FormatCSV, Protection: &Protection{Password: "x"}}, "protection: output_format must be xlsx"},
+		{"long sheet password", Config{Protection: &Protection{Sheets: []string{"A"}, SheetPassword: long}}, "protection: sheet_password must be"},
+		{"sheet password without sheets", Config{Protection: &Protection{SheetPassword: "x"}}, "sheet_password requires sheets"},
+		{"workbook password without lock", Config{Protection: &Protection{WorkbookPassword: "x"}}, "workbook_password requires lock_structure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateProtection()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateProtection() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateProtection() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseRangeCoords(t *testing.T) {
+	tests := []struct {
+		ref                                string
+		startCol, startRow, endCol, endRow int
+		wantErr                            bool
+	}{
+		{"A1:C10", 1, 1, 3, 10, false},
+		{"B2:D", 2, 2, 4, 0, false},
+		{"A:H", 1, 1, 8, 0, false},
+		{"c3:*", 3, 3, 0, 0, false},
+		{"A1", 0, 0, 0, 0, true},
+		{"A1:10", 0, 0, 0, 0, true},
+		{"1:C3", 0, 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		startCol, startRow, endCol, endRow, err := parseRangeCoords(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRangeCoords(%q) error = %v, want error %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if got := []int{startCol, startRow, endCol, endRow}; !tt.wantErr && !reflect.DeepEqual(got, []int{tt.startCol, tt.startRow, tt.endCol, tt.endRow}) {
+			t.Errorf("parseRangeCoords(%q) = %v, want %v", tt.ref, got, []int{tt.startCol, tt.startRow, tt.endCol, tt.endRow})
+		}
+	}
+}
+
+func TestScanUsedRange(t *testing.T) {
+	// Styled cells without values are not used, formulas and inline strings are
+	src, err := openSource(testPackage(t), "data.xlsx", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if _, err := src.NewSheet("Empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	startCol, startRow, endCol, endRow, ok, err := scanUsedRange(src, "Sheet1")
+	if err != nil || !ok || startCol != 1 || startRow != 1 || endCol != 4 || endRow != 4 {
+		t.Errorf("scanUsedRange(Sheet1) = %d, %d, %d, %d, %v, %v, want A1:D4", startCol, startRow, endCol, endRow, ok, err)
+	}
+
+	// The added sheet is not in the package that was read, the workbook is serialized instead
+	src.data = nil
+	startCol, startRow, endCol, endRow, ok, err = scanUsedRange(src, "Empty")
+	if err != nil || ok || startCol+startRow+endCol+endRow != 0 {
+		t.Errorf("scanUsedRange(Empty) = %d, %d, %d, %d, %v, %v, want no used range", startCol, startRow, endCol, endRow, ok, err)
+	}
+	if _, _, _, _, _, err := scanUsedRange(src, "Missing"); err == nil {
+		t.Error("scanUsedRange(Missing) succeeded")
+	}
+}
+
+func TestTransformOpenRanges(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{
+		"Sheet1": {{"ID", "Name"}, {1, "a"}, {2, "b", "x"}, {}, {4, "d"}},
+		"Table":  {{}, {nil, "h1", "h2"}, {nil, 1, 2, nil}},
+		"Empty":  {},
+	})
+	styled, _ := source.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	source.SetCellStyle("Table", "F10", "F10", styled)
+
+	tests := []struct {
+		name      string
+		mapping   Mapping
+		want      [][]string
+		wantRange string
+	}{
+		{"open rows", Mapping{Source: "Sheet1!A2:B"}, [][]string{{"1", "a"}, {"2", "b"}, nil, {"4", "d"}}, "Sheet1!A2:B5"},
+		{"whole columns", Mapping{Source: "Sheet1!B:B"}, [][]string{{"Name"}, {"a"}, {"b"}, nil, {"d"}}, "Sheet1!B1:B5"},
+		{"open rows and columns", Mapping{Source: "Sheet1!B3:*"}, [][]string{{"b", "x"}, nil, {"d"}}, "Sheet1!B3:C5"},
+		{"stop at blank", Mapping{Source: "Sheet1!A1:B", StopAtBlank: true}, [][]string{{"ID", "Name"}, {"1", "a"}, {"2", "b"}}, "Sheet1!A1:B3"},
+		{"used range", Mapping{Source: "Table!used_range"}, [][]string{{"h1", "h2"}, {"1", "2"}}, "Table!B2:C3"},
+		{"used range of an empty sheet", Mapping{Source: "Empty!used_range"}, [][]string{}, "Empty!A1:A1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping := tt.mapping
+			mapping.Destination = "Out!A1"
+			output, report := testTransform(t, &Config{
+				OutputFilename: "out.xlsx",
+				OutputSheets:   []OutputSheet{{Name: "Out", CreateIfNotExists: true}},
+				Mappings:       []Mapping{mapping},
+			}, source)
+			if report.ErrorCount > 0 {
+				t.Errorf("error count = %d", report.ErrorCount)
+			}
+			if got := testRows(t, output, "Out"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+			if got := report.Mappings[0].Range; got != tt.wantRange {
+				t.Errorf("range = %q, want %q", got, tt.wantRange)
+			}
+		})
+	}
+}
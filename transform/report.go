@@ -0,0 +1,111 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// reportSheetName is the hidden sheet the processing report is written to when report_sheet is enabled
+const reportSheetName = "ex2ex_report"
+
+// maxReportErrors limits the number of error messages kept per mapping
+const maxReportErrors = 50
+
+// MappingReport describes the result of applying a single mapping
+type MappingReport struct {
+	Source       string   `json:"source"`
+	Destination  string   `json:"destination"`
+	Range        string   `json:"range,omitempty"`
+	RowsScanned  int      `json:"rows_scanned"`
+	RowsMatched  int      `json:"rows_matched"`
+	CellsWritten int      `json:"cells_written"`
+	ErrorCount   int      `json:"error_count"`
+	Errors       []string `json:"errors,omitempty"`
+	// Duplicates counts the rows dropped by distinct_on
+	Duplicates int `json:"duplicates,omitempty"`
+	// Unmatched counts the rows whose join key is missing from the lookup range
+	Unmatched     int      `json:"unmatched,omitempty"`
+	UnmatchedKeys []string `json:"unmatched_keys,omitempty"`
+}
+
+// ProcessingReport is the result of a transformation, one report per mapping
+type ProcessingReport struct {
+	Mappings     []*MappingReport `json:"mappings"`
+	CellsWritten int              `json:"cells_written"`
+	ErrorCount   int              `json:"error_count"`
+	// OutputFilename is output_filename with the extension of the output format
+	OutputFilename string `json:"output_filename,omitempty"`
+}
+
+func newMappingReport(mapping Mapping) *MappingReport {
+	return &MappingReport{
+		Source:      mapping.Source,
+		Destination: mapping.Destination,
+	}
+}
+
+// addError records an error, keeping at most maxReportErrors messages
+func (r *MappingReport) addError(format string, args ...interface{}) {
+	r.ErrorCount++
+	if len(r.Errors) < maxReportErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+	}
+}
+
+// addUnmatched records a row whose join key was not found, keeping at most maxReportErrors distinct keys
+func (r *MappingReport) addUnmatched(key string) {
+	r.Unmatched++
+	if len(r.UnmatchedKeys) >= maxReportErrors {
+		return
+	}
+	for _, k := range r.UnmatchedKeys {
+		if k == key {
+			return
+		}
+	}
+	r.UnmatchedKeys = append(r.UnmatchedKeys, key)
+}
+
+// add appends a mapping report and updates the totals
+func (r *ProcessingReport) add(m *MappingReport) {
+	r.Mappings = append(r.Mappings, m)
+	r.CellsWritten += m.CellsWritten
+	r.ErrorCount += m.ErrorCount
+}
+
+// writeReportSheet stores the processing report in a hidden sheet of the output workbook
+func writeReportSheet(destFile *excelize.File, report *ProcessingReport) error {
+	if index, _ := destFile.GetSheetIndex(reportSheetName); index != -1 {
+		if err := destFile.DeleteSheet(reportSheetName); err != nil {
+			return err
+		}
+	}
+	if _, err := destFile.NewSheet(reportSheetName); err != nil {
+		return fmt.Errorf("failed to create report sheet: %w", err)
+	}
+
+	header := []interface{}{"Source", "Destination", "Range", "Rows scanned", "Rows matched", "Cells written", "Errors", "Messages", "Duplicates", "Unmatched", "Unmatched keys"}
+	if err := destFile.SetSheetRow(reportSheetName, "A1", &header); err != nil {
+		return err
+	}
+
+	for i, m := range report.Mappings {
+		messages := ""
+		for j, e := range m.Errors {
+			if j > 0 {
+				messages += "\n"
+			}
+			messages += e
+		}
+
+		row := []interface{}{m.Source, m.Destination, m.Range, m.RowsScanned, m.RowsMatched, m.CellsWritten, m.ErrorCount, messages, m.Duplicates, m.Unmatched, strings.Join(m.UnmatchedKeys, "\n")}
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := destFile.SetSheetRow(reportSheetName, cell, &row); err != nil {
+			return err
+		}
+	}
+
+	return destFile.SetSheetVisible(reportSheetName, false)
+}
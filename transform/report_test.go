@@ -0,0 +1,96 @@
+package transform
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTransformReport(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{
+		"Sheet1": {{"Name", "Status"}, {"a", "paid"}, {"b", "open"}, {"c", "paid"}},
+	})
+
+	tests := []struct {
+		name    string
+		mapping Mapping
+		want    MappingReport
+	}{
+		{
+			name:    "header row is not a matched row",
+			mapping: Mapping{Source: "Sheet1!A1:B4", HeaderRow: 1, Filters: []Filter{{Header: "status", Value: "paid"}}},
+			want:    MappingReport{Range: "Sheet1!A1:B4", RowsScanned: 4, RowsMatched: 2, CellsWritten: 6},
+		},
+		{
+			name:    "first row without header_row is data",
+			mapping: Mapping{Source: "Sheet1!A1:B4", FilterColumn: "B", FilterMask: "p*"},
+			want:    MappingReport{Range: "Sheet1!A1:B4", RowsScanned: 4, RowsMatched: 2, CellsWritten: 4},
+		},
+		{
+			name:    "open range",
+			mapping: Mapping{Source: "Sheet1!A2:B"},
+			want:    MappingReport{Range: "Sheet1!A2:B4", RowsScanned: 3, RowsMatched: 3, CellsWritten: 6},
+		},
+		{
+			name:    "single cell",
+			mapping: Mapping{Source: "Sheet1!B2"},
+			want:    MappingReport{Range: "Sheet1!B2", RowsScanned: 1, RowsMatched: 1, CellsWritten: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping := tt.mapping
+			mapping.Destination = "Sheet1!A1"
+			_, report := testTransform(t, &Config{OutputFilename: "out.xlsx", Mappings: []Mapping{mapping}}, source)
+			want := tt.want
+			want.Source, want.Destination = mapping.Source, mapping.Destination
+			if got := *report.Mappings[0]; !reflect.DeepEqual(got, want) {
+				t.Errorf("report = %+v, want %+v", got, want)
+			}
+			if report.CellsWritten != want.CellsWritten || report.ErrorCount != 0 {
+				t.Errorf("totals = %d cells, %d errors, want %d cells", report.CellsWritten, report.ErrorCount, want.CellsWritten)
+			}
+		})
+	}
+}
+
+func TestReportSheet(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{"Sheet1": {{"a"}, {"b"}}})
+	output, _ := testTransform(t, &Config{
+		OutputFilename: "out.xlsx",
+		ReportSheet:    true,
+		Mappings: []Mapping{
+			{Source: "Sheet1!A1:A2", Destination: "Sheet1!B1"},
+			{Source: "Missing!A1", Destination: "Sheet1!C1"},
+		},
+	}, source)
+
+	if visible, err := output.GetSheetVisible(reportSheetName); err != nil || visible {
+		t.Errorf("report sheet visible = %v, %v, want hidden", visible, err)
+	}
+	rows := testRows(t, output, reportSheetName)
+	if len(rows) != 3 {
+		t.Fatalf("report rows = %q, want a header and 2 mappings", rows)
+	}
+	if want := []string{"Sheet1!A1:A2", "Sheet1!B1", "Sheet1!A1:A2", "2", "2", "2", "0", "", "0", "0"}; !reflect.DeepEqual(rows[1], want) {
+		t.Errorf("report row = %q, want %q", rows[1], want)
+	}
+	if len(rows[2]) < 8 || rows[2][6] != "1" || rows[2][7] == "" {
+		t.Errorf("report row of the failed mapping = %q, want 1 error with its message", rows[2])
+	}
+}
+
+func TestMappingReportLimits(t *testing.T) {
+	report := &MappingReport{}
+	for i := 0; i < maxReportErrors+10; i++ {
+		report.addError("error %d", i)
+		report.addUnmatched(fmt.Sprint(i))
+		report.addUnmatched(fmt.Sprint(i))
+	}
+	if report.ErrorCount != maxReportErrors+10 || len(report.Errors) != maxReportErrors {
+		t.Errorf("errors = %d with %d messages, want %d with %d", report.ErrorCount, len(report.Errors), maxReportErrors+10, maxReportErrors)
+	}
+	if report.Unmatched != 2*(maxReportErrors+10) || len(report.UnmatchedKeys) != maxReportErrors {
+		t.Errorf("unmatched = %d with %d keys, want %d with %d", report.Unmatched, len(report.UnmatchedKeys), 2*(maxReportErrors+10), maxReportErrors)
+	}
+}
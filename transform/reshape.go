@@ -0,0 +1,382 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Default titles of the unpivot result columns
+const (
+	defaultUnpivotName  = "name"
+	defaultUnpivotValue = "value"
+)
+
+// Unpivot turns a wide table into a long one: every value column of a source row
+// becomes an output row with the id columns, the title of the value column and its value.
+// Without value_columns all columns of the range except the id columns are unpivoted.
+type Unpivot struct {
+	IDColumns    []string `yaml:"id_columns,omitempty" json:"id_columns,omitempty"`
+	IDHeaders    []string `yaml:"id_headers,omitempty" json:"id_headers,omitempty"`
+	ValueColumns []string `yaml:"value_columns,omitempty" json:"value_columns,omitempty"`
+	ValueHeaders []string `yaml:"value_headers,omitempty" json:"value_headers,omitempty"`
+	NameTitle    string   `yaml:"name_title,omitempty" json:"name_title,omitempty"`
+	ValueTitle   string   `yaml:"value_title,omitempty" json:"value_title,omitempty"`
+	SkipEmpty    bool     `yaml:"skip_empty,omitempty" json:"skip_empty,omitempty"`
+}
+
+// Pivot turns a long table into a wide one: source rows with the same row columns
+// become one output row, the values of the pivot column become output columns and
+// the value column fills the cells. Without function the first value is copied.
+type Pivot struct {
+	RowColumns   []string `yaml:"row_columns,omitempty" json:"row_columns,omitempty"`
+	RowHeaders   []string `yaml:"row_headers,omitempty" json:"row_headers,omitempty"`
+	Column       string   `yaml:"column,omitempty" json:"column,omitempty"`
+	ColumnHeader string   `yaml:"column_header,omitempty" json:"column_header,omitempty"`
+	Value        string   `yaml:"value,omitempty" json:"value,omitempty"`
+	ValueHeader  string   `yaml:"value_header,omitempty" json:"value_header,omitempty"`
+	Function     string   `yaml:"function,omitempty" json:"function,omitempty"`
+}
+
+// width returns the number of columns of the unpivoted table
+func (u *Unpivot) width() int {
+	return len(u.IDColumns) + len(u.IDHeaders) + 2
+}
+
+// reshapes reports whether the mapping writes its cells away from their row layout
+func (m Mapping) reshapes() bool {
+	return m.Transpose || m.Unpivot != nil || m.Pivot != nil
+}
+
+// validateReshape checks the transpose, unpivot and pivot options of a mapping
+func validateReshape(m Mapping) error {
+	if !m.reshapes() {
+		return nil
+	}
+
+	_, sourceRange := parseReference(m.Source)
+	if !isRange(sourceRange) {
+		return fmt.Errorf("transpose, unpivot and pivot require a range source")
+	}
+	if m.Formulas == FormulasTranslate {
+		return fmt.Errorf("formulas: translate cannot be used with transpose, unpivot or pivot")
+	}
+	if m.Unpivot == nil && m.Pivot == nil {
+		return nil
+	}
+
+	if m.Unpivot != nil && m.Pivot != nil {
+		return fmt.Errorf("use either unpivot or pivot")
+	}
+	if len(m.Columns) > 0 || len(m.Transforms) > 0 || len(m.Computed) > 0 || m.Join != nil || m.Aggregate != nil {
+		return fmt.Errorf("unpivot and pivot cannot be combined with columns, transforms, computed, join or aggregate")
+	}
+
+	if u := m.Unpivot; u != nil {
+		if err := validateColumnList(u.IDColumns, u.IDHeaders, "unpivot: id_columns", "unpivot: id_headers"); err != nil {
+			return err
+		}
+		return validateColumnList(u.ValueColumns, u.ValueHeaders, "unpivot: value_columns", "unpivot: value_headers")
+	}
+
+	p := m.Pivot
+	if len(m.SortBy) > 0 || len(m.DistinctOn) > 0 || len(m.DistinctOnHeaders) > 0 || m.Skip > 0 || m.Limit > 0 {
+		return fmt.Errorf("sort_by, distinct_on, skip and limit cannot be used with pivot")
+	}
+	if err := validateColumnList(p.RowColumns, p.RowHeaders, "pivot: row_columns", "pivot: row_headers"); err != nil {
+		return err
+	}
+	if err := validateColumnChoice(p.Column, p.ColumnHeader, "column"); err != nil {
+		return fmt.Errorf("pivot: %w", err)
+	}
+	if err := validateColumnChoice(p.Value, p.ValueHeader, "value"); err != nil {
+		return fmt.Errorf("pivot: %w", err)
+	}
+	switch strings.ToLower(p.Function) {
+	case "", AggregateSum, AggregateCount, AggregateAvg, AggregateMin, AggregateMax, AggregateCountDistinct:
+	default:
+		return fmt.Errorf("pivot: unknown function %q", p.Function)
+	}
+	return nil
+}
+
+// validateColumnList checks a list of columns given either by letter or by header
+func validateColumnList(columns, headers []string, columnsName, headersName string) error {
+	if len(columns) > 0 && len(headers) > 0 {
+		return fmt.Errorf("use either %s or %s", columnsName, headersName)
+	}
+	for i, col := range columns {
+		if _, err := excelize.ColumnNameToNumber(col); err != nil {
+			return fmt.Errorf("%s[%d]: invalid column %q", columnsName, i, col)
+		}
+	}
+	for i, header := range headers {
+		if headerKey(header) == "" {
+			return fmt.Errorf("%s[%d]: header cannot be empty", headersName, i)
+		}
+	}
+	return nil
+}
+
+// columnNumbers converts column letters to numbers, the letters are validated by Validate
+func columnNumbers(columns []string) []int {
+	var numbers []int
+	for _, name := range columns {
+		col, _ := excelize.ColumnNameToNumber(name)
+		numbers = append(numbers, col)
+	}
+	return numbers
+}
+
+// headerTitles returns the titles of columns in the header row, or their letters
+func headerTitles(row []string, columns []int) []string {
+	titles := make([]string, len(columns))
+	for i, col := range columns {
+		if col <= len(row) && strings.TrimSpace(row[col-1]) != "" {
+			titles[i] = row[col-1]
+		} else {
+			titles[i], _ = excelize.ColumnNumberToName(col)
+		}
+	}
+	return titles
+}
+
+// unpivotCopy is the state of an unpivot mapping
+type unpivotCopy struct {
+	spec      *Unpivot
+	idCols    []int
+	valueCols []int
+	header    []string
+}
+
+func newUnpivotCopy(spec *Unpivot) *unpivotCopy {
+	return &unpivotCopy{spec: spec, idCols: columnNumbers(spec.IDColumns), valueCols: columnNumbers(spec.ValueColumns)}
+}
+
+// bind resolves the columns given by header and keeps the header row for the column titles
+func (u *unpivotCopy) bind(headers headerIndex, row []string) error {
+	var err error
+	if len(u.spec.IDHeaders) > 0 {
+		if u.idCols, err = headers.columns(u.spec.IDHeaders); err != nil {
+			return err
+		}
+	}
+	if len(u.spec.ValueHeaders) > 0 {
+		if u.valueCols, err = headers.columns(u.spec.ValueHeaders); err != nil {
+			return err
+		}
+	}
+	u.header = row
+	return nil
+}
+
+// columns returns the unpivoted columns: value_columns, or the range columns except the id columns
+func (u *unpivotCopy) columns(rangeCols []int) []int {
+	if len(u.valueCols) > 0 {
+		return u.valueCols
+	}
+	var cols []int
+	for _, c := range rangeCols {
+		id := false
+		for _, idCol := range u.idCols {
+			id = id || c == idCol
+		}
+		if !id {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// writeUnpivot writes the output rows of a source row, or the titles for the header row
+func (rc *rangeCopy) writeUnpivot(destFile *outputWorkbook, values *rowValues, title bool) {
+	u := rc.unpivot
+	if title {
+		titles := headerTitles(u.header, u.idCols)
+		titles = append(titles, defaultString(u.spec.NameTitle, defaultUnpivotName), defaultString(u.spec.ValueTitle, defaultUnpivotValue))
+		for i, t := range titles {
+			rc.writeCell(destFile, i, sourceCell{Type: excelize.CellTypeInlineString, Value: t}, nil)
+		}
+		rc.nextRow()
+		return
+	}
+
+	for _, col := range u.columns(rc.columns) {
+		value, err := values.sourceCell(col)
+		if err != nil {
+			rc.report.addError("row %d: %v", values.row, err)
+			continue
+		}
+		if u.spec.SkipEmpty && value.Value == "" {
+			continue
+		}
+		for i, idCol := range u.idCols {
+			src, err := values.sourceCell(idCol)
+			if err != nil {
+				rc.report.addError("row %d: %v", values.row, err)
+				continue
+			}
+			if src.Value != "" {
+				rc.writeCell(destFile, i, src, &rc.opts)
+			}
+		}
+		name := headerTitles(u.header, []int{col})[0]
+		rc.writeCell(destFile, len(u.idCols), sourceCell{Type: excelize.CellTypeInlineString, Value: name}, nil)
+		if value.Value != "" {
+			rc.writeCell(destFile, len(u.idCols)+1, value, &rc.opts)
+		}
+		rc.nextRow()
+	}
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// pivotTable collects the rows and columns of a pivot mapping while the source rows are read
+type pivotTable struct {
+	spec    *Pivot
+	rowCols []int
+	column  int
+	value   int
+	titles  []string
+	rows    map[string]*pivotRow
+	order   []*pivotRow
+	columns map[string]int
+	names   []sourceCell
+}
+
+// pivotRow holds the row columns of the first source row of an output row and its values by output column
+type pivotRow struct {
+	cells  []sourceCell
+	values map[int]*pivotValue
+}
+
+type pivotValue struct {
+	first sourceCell
+	state aggregateState
+}
+
+func newPivotTable(spec *Pivot) *pivotTable {
+	p := &pivotTable{
+		spec:    spec,
+		rowCols: columnNumbers(spec.RowColumns),
+		rows:    make(map[string]*pivotRow),
+		columns: make(map[string]int),
+	}
+	if spec.Column != "" {
+		p.column, _ = excelize.ColumnNameToNumber(spec.Column)
+	}
+	if spec.Value != "" {
+		p.value, _ = excelize.ColumnNameToNumber(spec.Value)
+	}
+	return p
+}
+
+func (p *pivotTable) bind(headers headerIndex, row []string) error {
+	var err error
+	if len(p.spec.RowHeaders) > 0 {
+		if p.rowCols, err = headers.columns(p.spec.RowHeaders); err != nil {
+			return err
+		}
+	}
+	if p.spec.ColumnHeader != "" {
+		if p.column, err = headers.column(p.spec.ColumnHeader); err != nil {
+			return err
+		}
+	}
+	if p.spec.ValueHeader != "" {
+		if p.value, err = headers.column(p.spec.ValueHeader); err != nil {
+			return err
+		}
+	}
+	p.titles = headerTitles(row, p.rowCols)
+	return nil
+}
+
+// add adds a source row to its output row. Rows without a pivot column value are skipped.
+func (p *pivotTable) add(values *rowValues) error {
+	name, _ := values.text(p.column)
+	if name == "" {
+		return nil
+	}
+	col, ok := p.columns[name]
+	if !ok {
+		src, err := values.sourceCell(p.column)
+		if err != nil {
+			return err
+		}
+		col = len(p.names)
+		p.columns[name] = col
+		p.names = append(p.names, src)
+	}
+
+	keys := make([]string, len(p.rowCols))
+	for i, c := range p.rowCols {
+		keys[i], _ = values.text(c)
+	}
+	key := strings.Join(keys, "\x00")
+	row, ok := p.rows[key]
+	if !ok {
+		row = &pivotRow{values: make(map[int]*pivotValue)}
+		for _, c := range p.rowCols {
+			src, err := values.sourceCell(c)
+			if err != nil {
+				return err
+			}
+			row.cells = append(row.cells, src)
+		}
+		p.rows[key] = row
+		p.order = append(p.order, row)
+	}
+
+	value, ok := row.values[col]
+	if !ok {
+		value = &pivotValue{}
+		row.values[col] = value
+	}
+	if p.spec.Function != "" {
+		value.state.add(p.spec.Function, values, p.value)
+	} else if value.first.Value == "" {
+		first, err := values.sourceCell(p.value)
+		if err != nil {
+			return err
+		}
+		value.first = first
+	}
+	return nil
+}
+
+// write writes the pivot table at the destination of the mapping.
+// Rows and columns keep the order they first appear in.
+func (p *pivotTable) write(destFile *outputWorkbook, rc *rangeCopy) {
+	for i, title := range p.titles {
+		rc.writeCell(destFile, i, sourceCell{Type: excelize.CellTypeInlineString, Value: title}, nil)
+	}
+	for i, name := range p.names {
+		rc.writeCell(destFile, len(p.rowCols)+i, name, &rc.opts)
+	}
+	rc.nextRow()
+
+	for _, row := range p.order {
+		for i, src := range row.cells {
+			if src.Value != "" {
+				rc.writeCell(destFile, i, src, &rc.opts)
+			}
+		}
+		for col, value := range row.values {
+			if p.spec.Function == "" {
+				if value.first.Value != "" {
+					rc.writeCell(destFile, len(p.rowCols)+col, value.first, &rc.opts)
+				}
+			} else if n, ok := value.state.result(p.spec.Function); ok {
+				rc.writeCell(destFile, len(p.rowCols)+col, numberCell(n), nil)
+			}
+		}
+		rc.nextRow()
+	}
+}
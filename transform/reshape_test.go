@@ -0,0 +1,165 @@
+package transform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTransformReshape(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{
+		"Plan": {
+			{"Product", "Unit", "Jan", "Feb", "Mar"},
+			{"tea", "kg", 100, 120, nil},
+			{"coffee", "kg", 80, nil, 90},
+		},
+		"Sales": {
+			{"Product", "Month", "Amount"},
+			{"tea", "Jan", 10},
+			{"coffee", "Feb", 5},
+			{"tea", "Jan", 7},
+			{"tea", "", 1},
+			{"tea", "Feb", 3},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		mapping Mapping
+		want    [][]string
+	}{
+		{
+			// The filtered table with the chosen columns is transposed
+			name: "transpose",
+			mapping: Mapping{
+				Source:    "Plan!A1:E3",
+				Transpose: true,
+				Columns:   []string{"Product", "Feb"},
+				Filters:   []Filter{{Column: "A", Operator: "not_equals", Value: "coffee"}},
+			},
+			want: [][]string{{"Product", "tea"}, {"Feb", "120"}},
+		},
+		{
+			name: "unpivot by header",
+			mapping: Mapping{Source: "Plan!A1:E3", Unpivot: &Unpivot{
+				IDHeaders:  []string{"product"},
+				NameTitle:  "Month",
+				ValueTitle: "Plan",
+				SkipEmpty:  true,
+			}},
+			want: [][]string{
+				{"Product", "Month", "Plan"},
+				{"tea", "Unit", "kg"}, {"tea", "Jan", "100"}, {"tea", "Feb", "120"},
+				{"coffee", "Unit", "kg"}, {"coffee", "Jan", "80"}, {"coffee", "Mar", "90"},
+			},
+		},
+		{
+			name: "unpivot by column",
+			mapping: Mapping{Source: "Plan!A1:E3", Unpivot: &Unpivot{
+				IDColumns:    []string{"A", "B"},
+				ValueColumns: []string{"C", "E"},
+			}},
+			want: [][]string{
+				{"Product", "Unit", "name", "value"},
+				{"tea", "kg", "Jan", "100"}, {"tea", "kg", "Mar"},
+				{"coffee", "kg", "Jan", "80"}, {"coffee", "kg", "Mar", "90"},
+			},
+		},
+		{
+			// Rows without a month are skipped
+			name: "pivot of the first values",
+			mapping: Mapping{Source: "Sales!A1:C", Pivot: &Pivot{
+				RowHeaders:   []string{"Product"},
+				ColumnHeader: "Month",
+				ValueHeader:  "Amount",
+			}},
+			want: [][]string{{"Product", "Jan", "Feb"}, {"tea", "10", "3"}, {"coffee", "", "5"}},
+		},
+		{
+			name: "pivot with a function",
+			mapping: Mapping{Source: "Sales!A1:C", Pivot: &Pivot{
+				RowColumns: []string{"A"},
+				Column:     "B",
+				Value:      "C",
+				Function:   AggregateSum,
+			}},
+			want: [][]string{{"Product", "Jan", "Feb"}, {"tea", "17", "3"}, {"coffee", "", "5"}},
+		},
+		{
+			name: "transposed pivot",
+			mapping: Mapping{Source: "Sales!A1:C", Transpose: true, Pivot: &Pivot{
+				RowHeaders:   []string{"Product"},
+				ColumnHeader: "Month",
+				ValueHeader:  "Amount",
+				Function:     AggregateCount,
+			}},
+			want: [][]string{{"Product", "tea", "coffee"}, {"Jan", "2"}, {"Feb", "1", "1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping := tt.mapping
+			mapping.Destination = "Out!A1"
+			output, report := testTransform(t, &Config{
+				OutputFilename: "out.xlsx",
+				OutputSheets:   []OutputSheet{{Name: "Out", CreateIfNotExists: true}},
+				Mappings:       []Mapping{mapping},
+			}, source)
+			if report.ErrorCount > 0 {
+				t.Errorf("error count = %d", report.ErrorCount)
+			}
+			if got := testRows(t, output, "Out"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReshape(t *testing.T) {
+	unpivot := &Unpivot{IDColumns: []string{"A"}}
+	pivot := &Pivot{RowColumns: []string{"A"}, Column: "B", Value: "C"}
+
+	tests := []struct {
+		name    string
+		mapping Mapping
+		wantErr string
+	}{
+		{"transpose", Mapping{Transpose: true, Columns: []string{"A"}, Formulas: FormulasVerbatim}, ""},
+		{"unpivot", Mapping{Unpivot: unpivot}, ""},
+		{"pivot", Mapping{Pivot: pivot, Transpose: true}, ""},
+		{"single cell", Mapping{Source: "S!A1", Transpose: true}, "require a range source"},
+		{"translated formulas", Mapping{Pivot: pivot, Formulas: FormulasTranslate}, "formulas: translate cannot be used"},
+		{"unpivot and pivot", Mapping{Unpivot: unpivot, Pivot: pivot}, "use either unpivot or pivot"},
+		{"columns", Mapping{Unpivot: unpivot, Columns: []string{"A"}}, "cannot be combined with columns"},
+		{"transforms", Mapping{Pivot: pivot, Transforms: []Transform{{Column: "A", Function: TransformTrim}}}, "cannot be combined with columns"},
+		{"computed", Mapping{Unpivot: unpivot, Computed: []ComputedColumn{{Expression: "1"}}}, "cannot be combined with columns"},
+		{"join", Mapping{Unpivot: unpivot, Join: &Join{Source: "R!A1:B2", Key: "A", LookupKey: "A", Columns: []string{"B"}}}, "cannot be combined with columns"},
+		{"aggregate", Mapping{Pivot: pivot, Aggregate: &Aggregate{GroupBy: []string{"A"}}}, "cannot be combined"},
+		{"pivot with sort_by", Mapping{Pivot: pivot, SortBy: []SortKey{{Column: "A"}}}, "cannot be used with pivot"},
+		{"pivot with limit", Mapping{Pivot: pivot, Limit: 5}, "cannot be used with pivot"},
+		{"unpivot ids", Mapping{Unpivot: &Unpivot{IDColumns: []string{"A"}, IDHeaders: []string{"x"}}}, "use either unpivot: id_columns or unpivot: id_headers"},
+		{"unpivot value header", Mapping{Unpivot: &Unpivot{ValueHeaders: []string{""}}}, "unpivot: value_headers[0]: header cannot be empty"},
+		{"pivot without column", Mapping{Pivot: &Pivot{RowColumns: []string{"A"}, Value: "C"}}, "pivot: use either column or column_header"},
+		{"pivot value", Mapping{Pivot: &Pivot{RowColumns: []string{"A"}, Column: "B", Value: "3"}}, `pivot: invalid value column "3"`},
+		{"pivot function", Mapping{Pivot: &Pivot{RowColumns: []string{"A"}, Column: "B", Value: "C", Function: "median"}}, `pivot: unknown function "median"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping := tt.mapping
+			if mapping.Source == "" {
+				mapping.Source = "S!A1:E"
+			}
+			mapping.Destination = "Out!A1"
+			err := (&Config{OutputFilename: "out.xlsx", Mappings: []Mapping{mapping}}).Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
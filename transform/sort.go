@@ -0,0 +1,228 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Sort orders of a sort key
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// SortKey is a column to sort by, given by its letter or by its header
+type SortKey struct {
+	Column string `yaml:"column,omitempty" json:"column,omitempty"`
+	Header string `yaml:"header,omitempty" json:"header,omitempty"`
+	Order  string `yaml:"order,omitempty" json:"order,omitempty"`
+}
+
+// descending reports whether the key sorts from the largest value
+func (k SortKey) descending() bool {
+	return strings.ToLower(k.Order) == SortDesc
+}
+
+// validateSortKeys checks the column, header and order of sort keys
+func validateSortKeys(keys []SortKey, name string) error {
+	for i, key := range keys {
+		if (key.Column == "") == (key.Header == "") {
+			return fmt.Errorf("%s[%d]: use either column or header", name, i)
+		}
+		switch strings.ToLower(key.Order) {
+		case "", SortAsc, SortDesc:
+		default:
+			return fmt.Errorf("%s[%d]: order must be one of asc, desc", name, i)
+		}
+	}
+	return nil
+}
+
+// Kinds of sort values, in the order they are sorted
+const (
+	sortNumber = iota
+	sortDate
+	sortText
+	sortEmpty
+)
+
+// sortValue is a cell value compared as a number, a date or text
+type sortValue struct {
+	kind   int
+	number float64
+	date   time.Time
+	text   string
+}
+
+func numberSortValue(n float64) sortValue {
+	return sortValue{kind: sortNumber, number: n}
+}
+
+// rowSortValue returns the value of a row column for sorting. Number and date cells
+// are compared by their stored values, text is parsed as a number or a date if possible.
+func rowSortValue(row *rowValues, col int) sortValue {
+	if n, ok := row.rawNumber(col); ok {
+		return numberSortValue(n)
+	}
+	text, _ := row.text(col)
+	return textSortValue(text)
+}
+
+func textSortValue(text string) sortValue {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return sortValue{kind: sortEmpty}
+	}
+	if n, ok := parseNumber(text); ok {
+		return numberSortValue(n)
+	}
+	if d, ok := parseDate(text); ok {
+		return sortValue{kind: sortDate, date: d}
+	}
+	return sortValue{kind: sortText, text: strings.ToLower(text)}
+}
+
+// compareSortValues returns -1, 0 or 1. Numbers go before dates, dates before text,
+// blank values are last.
+func compareSortValues(a, b sortValue) int {
+	if a.kind != b.kind {
+		if a.kind < b.kind {
+			return -1
+		}
+		return 1
+	}
+	switch a.kind {
+	case sortNumber:
+		switch {
+		case a.number < b.number:
+			return -1
+		case a.number > b.number:
+			return 1
+		}
+	case sortDate:
+		return a.date.Compare(b.date)
+	case sortText:
+		return strings.Compare(a.text, b.text)
+	}
+	return 0
+}
+
+// compareOrdered compares values in the order of a sort key, blank values stay last
+func compareOrdered(a, b sortValue, descending bool) int {
+	c := compareSortValues(a, b)
+	if descending && a.kind != sortEmpty && b.kind != sortEmpty {
+		c = -c
+	}
+	return c
+}
+
+// validateRowOrder checks the sort_by, distinct_on, skip and limit options of a mapping
+func validateRowOrder(m Mapping) error {
+	if len(m.SortBy) == 0 && len(m.DistinctOn) == 0 && len(m.DistinctOnHeaders) == 0 && m.Skip == 0 && m.Limit == 0 {
+		return nil
+	}
+
+	_, sourceRange := parseReference(m.Source)
+	if !isRange(sourceRange) {
+		return fmt.Errorf("sort_by, distinct_on, skip and limit require a range source")
+	}
+	if m.Aggregate != nil && (len(m.SortBy) > 0 || len(m.DistinctOn) > 0 || len(m.DistinctOnHeaders) > 0) {
+		return fmt.Errorf("aggregate groups are sorted by aggregate sort_by, distinct_on cannot be used")
+	}
+	if err := validateSortKeys(m.SortBy, "sort_by"); err != nil {
+		return err
+	}
+	for i, key := range m.SortBy {
+		if key.Column == "" {
+			continue
+		}
+		if _, err := excelize.ColumnNameToNumber(key.Column); err != nil {
+			return fmt.Errorf("sort_by[%d]: invalid column %q", i, key.Column)
+		}
+	}
+
+	if len(m.DistinctOn) > 0 && len(m.DistinctOnHeaders) > 0 {
+		return fmt.Errorf("use either distinct_on or distinct_on_headers")
+	}
+	for i, col := range m.DistinctOn {
+		if _, err := excelize.ColumnNameToNumber(col); err != nil {
+			return fmt.Errorf("distinct_on[%d]: invalid column %q", i, col)
+		}
+	}
+	for i, header := range m.DistinctOnHeaders {
+		if headerKey(header) == "" {
+			return fmt.Errorf("distinct_on_headers[%d]: header cannot be empty", i)
+		}
+	}
+
+	if m.Skip < 0 || m.Limit < 0 {
+		return fmt.Errorf("skip and limit cannot be negative")
+	}
+	return nil
+}
+
+// duplicate reports whether a row with the same distinct_on values has been seen already
+func (rc *rangeCopy) duplicate(values *rowValues) bool {
+	if rc.seen == nil {
+		return false
+	}
+	keys := make([]string, len(rc.distinct))
+	for i, col := range rc.distinct {
+		keys[i], _ = values.text(col)
+	}
+	key := strings.Join(keys, "\x00")
+	if rc.seen[key] {
+		return true
+	}
+	rc.seen[key] = true
+	return false
+}
+
+// limitReached reports whether a copy in source order has written limit rows
+func (rc *rangeCopy) limitReached() bool {
+	return rc.mapping.Limit > 0 && rc.summary == nil && len(rc.sortCols) == 0 && rc.dataRows >= rc.mapping.Limit
+}
+
+// bufferRow keeps a row of a sorted copy until all rows are read
+func (rc *rangeCopy) bufferRow(values *rowValues) {
+	rc.sorted = append(rc.sorted, values)
+}
+
+// writeSorted writes the kept rows of a sorted copy in the order of sort_by.
+// Rows with equal keys keep their source order.
+func (rc *rangeCopy) writeSorted(destFile *outputWorkbook) {
+	keys := make([][]sortValue, len(rc.sorted))
+	for i, values := range rc.sorted {
+		keys[i] = make([]sortValue, len(rc.sortCols))
+		for k, col := range rc.sortCols {
+			keys[i][k] = rowSortValue(values, col)
+		}
+	}
+
+	order := make([]int, len(rc.sorted))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := keys[order[i]], keys[order[j]]
+		for k, key := range rc.mapping.SortBy {
+			if c := compareOrdered(a[k], b[k], key.descending()); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	for _, i := range order {
+		if rc.mapping.Limit > 0 && rc.dataRows >= rc.mapping.Limit {
+			break
+		}
+		values := rc.sorted[i]
+		rc.writeRow(values.file, destFile, values, false)
+	}
+	rc.sorted = nil
+}
@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransformSort(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{
+		"Sheet1": {
+			{"Name", "Amount", "Date"},
+			{"b", 30, "02.01.2024"},
+			{"A", "", "01.01.2024"},
+			{"c", 10, "текст"},
+			{"a", 30, "01.03.2023"},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		mapping Mapping
+		want    [][]string
+	}{
+		{
+			name:    "header_row stays first",
+			mapping: Mapping{HeaderRow: 1, SortBy: []SortKey{{Column: "C"}}},
+			want: [][]string{
+				{"Name", "Amount", "Date"},
+				{"a", "30", "01.03.2023"},
+				{"A", "", "01.01.2024"},
+				{"b", "30", "02.01.2024"},
+				{"c", "10", "текст"},
+			},
+		},
+		{
+			name:    "descending with blanks last and stable ties",
+			mapping: Mapping{SortBy: []SortKey{{Header: "Amount", Order: "DESC"}}},
+			want: [][]string{
+				{"Name", "Amount", "Date"},
+				{"b", "30", "02.01.2024"},
+				{"a", "30", "01.03.2023"},
+				{"c", "10", "текст"},
+				{"A", "", "01.01.2024"},
+			},
+		},
+		{
+			name:    "several keys and limit",
+			mapping: Mapping{HeaderRow: 1, SortBy: []SortKey{{Column: "B", Order: SortDesc}, {Column: "A"}}, Limit: 2},
+			want: [][]string{
+				{"Name", "Amount", "Date"},
+				{"a", "30", "01.03.2023"},
+				{"b", "30", "02.01.2024"},
+			},
+		},
+		{
+			// Without a header row the first row is data, text sorts after numbers
+			name:    "no header row",
+			mapping: Mapping{SortBy: []SortKey{{Column: "B"}}},
+			want: [][]string{
+				{"c", "10", "текст"},
+				{"b", "30", "02.01.2024"},
+				{"a", "30", "01.03.2023"},
+				{"Name", "Amount", "Date"},
+				{"A", "", "01.01.2024"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping := tt.mapping
+			mapping.Source, mapping.Destination = "Sheet1!A1:C5", "Sheet1!A1"
+			output, _ := testTransform(t, &Config{OutputFilename: "out.xlsx", Mappings: []Mapping{mapping}}, source)
+			if got := testRows(t, output, "Sheet1"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRowOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping Mapping
+		wantErr bool
+	}{
+		{"sort by column", Mapping{Source: "S!A1:C5", SortBy: []SortKey{{Column: "B", Order: "desc"}}}, false},
+		{"single cell", Mapping{Source: "S!A1", SortBy: []SortKey{{Column: "A"}}}, true},
+		{"column and header", Mapping{Source: "S!A1:C5", SortBy: []SortKey{{Column: "A", Header: "x"}}}, true},
+		{"unknown order", Mapping{Source: "S!A1:C5", SortBy: []SortKey{{Column: "A", Order: "up"}}}, true},
+		{"invalid column", Mapping{Source: "S!A1:C5", SortBy: []SortKey{{Column: "1"}}}, true},
+		{"both distinct options", Mapping{Source: "S!A1:C5", DistinctOn: []string{"A"}, DistinctOnHeaders: []string{"x"}}, true},
+		{"negative limit", Mapping{Source: "S!A1:C5", Limit: -1}, true},
+		{"sorted aggregate", Mapping{Source: "S!A1:C5", Aggregate: &Aggregate{}, SortBy: []SortKey{{Column: "A"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRowOrder(tt.mapping); (err != nil) != tt.wantErr {
+				t.Errorf("validateRowOrder() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
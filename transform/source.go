@@ -0,0 +1,579 @@
+package transform
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// sourceCell is a source cell as copied by copyCellValue
+type sourceCell struct {
+	Sheet   string
+	Name    string
+	Type    excelize.CellType
+	StyleID int
+	Formula string
+	Value   string
+	// Raw is the stored value of number and boolean cells, Value is the formatted text
+	Raw string
+}
+
+// cellTypes maps the "t" attribute of a worksheet cell to its excelize cell type
+var cellTypes = map[string]excelize.CellType{
+	"b":         excelize.CellTypeBool,
+	"d":         excelize.CellTypeDate,
+	"n":         excelize.CellTypeNumber,
+	"e":         excelize.CellTypeError,
+	"s":         excelize.CellTypeSharedString,
+	"str":       excelize.CellTypeFormula,
+	"inlineStr": excelize.CellTypeInlineString,
+}
+
+// readSourceCell looks up a single source cell. Every excelize getter scans the rows
+// of the sheet, so range mappings read cells with sheetCells instead.
+func readSourceCell(sourceFile *excelize.File, sheet, cell string) (sourceCell, error) {
+	src := sourceCell{Sheet: sheet, Name: cell}
+
+	cellType, err := sourceFile.GetCellType(sheet, cell)
+	if err != nil {
+		return src, fmt.Errorf("failed to get cell type: %w", err)
+	}
+	src.Type = cellType
+
+	if src.Value, err = sourceFile.GetCellValue(sheet, cell); err != nil {
+		return src, fmt.Errorf("failed to get cell value: %w", err)
+	}
+	switch cellType {
+	case excelize.CellTypeUnset, excelize.CellTypeNumber, excelize.CellTypeBool:
+		src.Raw, _ = sourceFile.GetCellValue(sheet, cell, excelize.Options{RawCellValue: true})
+	}
+
+	// Formulas and styles are optional, a cell is still copied without them
+	src.Formula, _ = sourceFile.GetCellFormula(sheet, cell)
+	src.StyleID, _ = sourceFile.GetCellStyle(sheet, cell)
+
+	return src, nil
+}
+
+// sheetCells streams the cell types, styles and formulas of a worksheet straight from
+// the workbook package. excelize streams cell values only, so range mappings read the
+// values with excelize's row iterator and everything else from sheetCells, row by row.
+type sheetCells struct {
+	closer    io.Closer
+	xmlFile   io.ReadCloser
+	decoder   *xml.Decoder
+	colStyles []colStyle
+	shared    map[string]sharedFormula
+	lookahead *sheetRow
+	lastRow   int
+	done      bool
+}
+
+// sheetRow holds the cells of one worksheet row by column number
+type sheetRow struct {
+	num       int
+	style     int
+	cells     map[int]cellInfo
+	colStyles []colStyle
+}
+
+type cellInfo struct {
+	cellType string
+	style    int
+	formula  string
+	value    string
+}
+
+type colStyle struct {
+	min, max, style int
+}
+
+// sharedFormula is the master cell of a shared formula
+type sharedFormula struct {
+	formula  string
+	col, row int
+}
+
+// openSheetCells opens the worksheet XML of sheet. Workbooks read from memory or disk are
+// read from their package, workbooks built in memory (converted .xls files) are serialized first.
+func openSheetCells(file *sourceWorkbook, sheet string) (*sheetCells, error) {
+	var reader *zip.Reader
+	var closer io.Closer
+	if file.data != nil {
+		var err error
+		if reader, err = zip.NewReader(bytes.NewReader(file.data), int64(len(file.data))); err != nil {
+			return nil, err
+		}
+	} else if file.Path != "" {
+		rc, err := zip.OpenReader(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		reader, closer = &rc.Reader, rc
+	} else {
+		buf, err := file.WriteToBuffer()
+		if err != nil {
+			return nil, err
+		}
+		if reader, err = zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+			return nil, err
+		}
+	}
+
+	sheetPath, err := findSheetPath(reader, sheet)
+	if err == nil {
+		var xmlFile io.ReadCloser
+		if xmlFile, err = reader.Open(sheetPath); err == nil {
+			return &sheetCells{
+				closer:  closer,
+				xmlFile: xmlFile,
+				decoder: xml.NewDecoder(xmlFile),
+				shared:  make(map[string]sharedFormula),
+			}, nil
+		}
+	}
+
+	if closer != nil {
+		closer.Close()
+	}
+	return nil, err
+}
+
+// findSheetPath resolves the package path of a worksheet through the workbook relationships
+func findSheetPath(reader *zip.Reader, sheet string) (string, error) {
+	relID := ""
+	err := scanXML(reader, "xl/workbook.xml", func(e xml.StartElement) {
+		if e.Name.Local != "sheet" || relID != "" {
+			return
+		}
+		var name, id string
+		for _, attr := range e.Attr {
+			switch {
+			case attr.Name.Local == "name":
+				name = attr.Value
+			case attr.Name.Local == "id" && attr.Name.Space != "":
+				id = attr.Value
+			}
+		}
+		if strings.EqualFold(name, sheet) {
+			relID = id
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if relID == "" {
+		return "", fmt.Errorf("sheet %s does not exist", sheet)
+	}
+
+	target := ""
+	err = scanXML(reader, "xl/_rels/workbook.xml.rels", func(e xml.StartElement) {
+		if e.Name.Local != "Relationship" {
+			return
+		}
+		var id, t string
+		for _, attr := range e.Attr {
+			switch attr.Name.Local {
+			case "Id":
+				id = attr.Value
+			case "Target":
+				t = attr.Value
+			}
+		}
+		if id == relID {
+			target = t
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if target == "" {
+		return "", fmt.Errorf("sheet %s has no worksheet part", sheet)
+	}
+
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/"), nil
+	}
+	return path.Join("xl", target), nil
+}
+
+// scanXML calls fn for every start element of a package part
+func scanXML(reader *zip.Reader, name string, fn func(xml.StartElement)) error {
+	f, err := reader.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if e, ok := token.(xml.StartElement); ok {
+			fn(e)
+		}
+	}
+}
+
+// row returns the cells of the given row. Rows must be requested in ascending order.
+func (sc *sheetCells) row(num int) (*sheetRow, error) {
+	for {
+		if sc.lookahead == nil && !sc.done {
+			next, err := sc.readRow()
+			if err != nil {
+				return nil, err
+			}
+			sc.lookahead = next
+		}
+		if sc.lookahead == nil || sc.lookahead.num > num {
+			return &sheetRow{num: num, colStyles: sc.colStyles}, nil
+		}
+
+		current := sc.lookahead
+		sc.lookahead = nil
+		if current.num == num {
+			return current, nil
+		}
+	}
+}
+
+// readRow decodes the next <row> element, or returns nil at the end of the sheet data.
+// Raw tokens are used throughout: worksheets are large and namespaces do not matter here.
+func (sc *sheetCells) readRow() (*sheetRow, error) {
+	for {
+		token, err := sc.decoder.RawToken()
+		if err == io.EOF {
+			sc.done = true
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch e := token.(type) {
+		case xml.StartElement:
+			switch e.Name.Local {
+			case "col":
+				sc.readCol(e)
+			case "row":
+				return sc.readRowElement(e)
+			}
+		case xml.EndElement:
+			if e.Name.Local == "sheetData" {
+				sc.done = true
+				return nil, nil
+			}
+		}
+	}
+}
+
+func (sc *sheetCells) readCol(e xml.StartElement) {
+	var col colStyle
+	for _, attr := range e.Attr {
+		switch attr.Name.Local {
+		case "min":
+			col.min, _ = strconv.Atoi(attr.Value)
+		case "max":
+			col.max, _ = strconv.Atoi(attr.Value)
+		case "style":
+			col.style, _ = strconv.Atoi(attr.Value)
+		}
+	}
+	if col.style != 0 {
+		sc.colStyles = append(sc.colStyles, col)
+	}
+}
+
+func (sc *sheetCells) readRowElement(e xml.StartElement) (*sheetRow, error) {
+	row := &sheetRow{num: sc.lastRow + 1, cells: make(map[int]cellInfo), colStyles: sc.colStyles}
+	for _, attr := range e.Attr {
+		switch attr.Name.Local {
+		case "r":
+			if n, err := strconv.Atoi(attr.Value); err == nil {
+				row.num = n
+			}
+		case "s":
+			row.style, _ = strconv.Atoi(attr.Value)
+		}
+	}
+	sc.lastRow = row.num
+
+	col := 0
+	for {
+		token, err := sc.decoder.RawToken()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				if err := sc.skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			info, cellCol, err := sc.readCell(t, col+1, row.num)
+			if err != nil {
+				return nil, err
+			}
+			col = cellCol
+			row.cells[col] = info
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				return row, nil
+			}
+		}
+	}
+}
+
+func (sc *sheetCells) readCell(e xml.StartElement, col, rowNum int) (cellInfo, int, error) {
+	var info cellInfo
+	for _, attr := range e.Attr {
+		switch attr.Name.Local {
+		case "r":
+			if c, _, err := excelize.CellNameToCoordinates(attr.Value); err == nil {
+				col = c
+			}
+		case "s":
+			info.style, _ = strconv.Atoi(attr.Value)
+		case "t":
+			info.cellType = attr.Value
+		}
+	}
+
+	for {
+		token, err := sc.decoder.RawToken()
+		if err != nil {
+			return info, col, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "v" {
+				// Raw value, used by the filters
+				if info.value, err = sc.text(); err != nil {
+					return info, col, err
+				}
+				continue
+			}
+			if t.Name.Local != "f" {
+				if err := sc.skip(); err != nil {
+					return info, col, err
+				}
+				continue
+			}
+			var formulaType, si string
+			for _, attr := range t.Attr {
+				switch attr.Name.Local {
+				case "t":
+					formulaType = attr.Value
+				case "si":
+					si = attr.Value
+				}
+			}
+			content, err := sc.text()
+			if err != nil {
+				return info, col, err
+			}
+			info.formula = sc.resolveFormula(content, formulaType, si, col, rowNum)
+		case xml.EndElement:
+			if t.Name.Local == "c" {
+				return info, col, nil
+			}
+		}
+	}
+}
+
+// skip skips the rest of the current element
+func (sc *sheetCells) skip() error {
+	for depth := 1; depth > 0; {
+		token, err := sc.decoder.RawToken()
+		if err != nil {
+			return err
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return nil
+}
+
+// text returns the character data of the current element and consumes its end
+func (sc *sheetCells) text() (string, error) {
+	var b strings.Builder
+	for {
+		token, err := sc.decoder.RawToken()
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			b.Write(t)
+		case xml.StartElement:
+			if err := sc.skip(); err != nil {
+				return "", err
+			}
+		case xml.EndElement:
+			return b.String(), nil
+		}
+	}
+}
+
+// resolveFormula returns the formula text of a cell, expanding shared formulas
+func (sc *sheetCells) resolveFormula(content, formulaType, si string, col, row int) string {
+	if formulaType != "shared" || si == "" {
+		return content
+	}
+	if content != "" {
+		sc.shared[si] = sharedFormula{formula: content, col: col, row: row}
+		return content
+	}
+
+	master, ok := sc.shared[si]
+	if !ok {
+		return ""
+	}
+	formula, _ := translateFormula(master.formula, formulaContext{
+		rowOffset:   row - master.row,
+		colOffset:   col - master.col,
+		sheetExists: func(string) bool { return true },
+	})
+	return formula
+}
+
+// dimension returns the used range recorded at the top of the worksheet, such as A1:H100,
+// or an empty string if the worksheet has none. It must be called before any row is read.
+func (sc *sheetCells) dimension() (string, error) {
+	for {
+		token, err := sc.decoder.RawToken()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if e, ok := token.(xml.StartElement); ok {
+			switch e.Name.Local {
+			case "dimension":
+				for _, attr := range e.Attr {
+					if attr.Name.Local == "ref" {
+						return attr.Value, nil
+					}
+				}
+				return "", nil
+			case "sheetData":
+				return "", nil
+			}
+		}
+	}
+}
+
+// sheetDimension returns the used range of a sheet as recorded in the workbook.
+// Only the top of the worksheet part is read, so large sheets are not loaded.
+// The recorded range may be stale: ok is false if the workbook records none,
+// or a single cell, which is what many writers record for any sheet.
+func sheetDimension(file *sourceWorkbook, sheet string) (startCol, startRow, endCol, endRow int, ok bool) {
+	var ref string
+	if file.data == nil && file.Path == "" {
+		// Worksheets of workbooks built in memory are loaded already
+		ref, _ = file.GetSheetDimension(sheet)
+	} else if sc, err := openSheetCells(file, sheet); err == nil {
+		ref, _ = sc.dimension()
+		sc.Close()
+	}
+	if ref == "" {
+		return 0, 0, 0, 0, false
+	}
+
+	startCol, startRow, endCol, endRow, err := parseRangeCoords(ref)
+	return startCol, startRow, endCol, endRow, err == nil && endRow > 0
+}
+
+// scanUsedRange reads the whole worksheet part and returns the first and last
+// rows and columns holding a value. ok is false if the sheet has no values.
+func scanUsedRange(file *sourceWorkbook, sheet string) (startCol, startRow, endCol, endRow int, ok bool, err error) {
+	sc, err := openSheetCells(file, sheet)
+	if err != nil {
+		return 0, 0, 0, 0, false, err
+	}
+	defer sc.Close()
+
+	for {
+		row, err := sc.readRow()
+		if err != nil {
+			return 0, 0, 0, 0, false, err
+		}
+		if row == nil {
+			return startCol, startRow, endCol, endRow, ok, nil
+		}
+		for col, info := range row.cells {
+			if info.value == "" && info.formula == "" && info.cellType != "inlineStr" {
+				continue
+			}
+			if !ok {
+				startCol, startRow, endCol, ok = col, row.num, col, true
+			}
+			startCol, endCol, endRow = min(startCol, col), max(endCol, col), row.num
+		}
+	}
+}
+
+// Close releases the worksheet XML and the workbook package
+func (sc *sheetCells) Close() error {
+	sc.xmlFile.Close()
+	if sc.closer != nil {
+		return sc.closer.Close()
+	}
+	return nil
+}
+
+// sourceCell describes the cell in column col of the row, with its formatted value
+func (r *sheetRow) sourceCell(sheet string, col int, value string) sourceCell {
+	name, _ := excelize.CoordinatesToCellName(col, r.num)
+	info := r.cells[col]
+
+	// Unstyled cells inherit the row style, then the column style
+	style := info.style
+	if style == 0 {
+		style = r.style
+	}
+	if style == 0 {
+		for _, c := range r.colStyles {
+			if c.min <= col && col <= c.max {
+				style = c.style
+				break
+			}
+		}
+	}
+
+	src := sourceCell{
+		Sheet:   sheet,
+		Name:    name,
+		Type:    cellTypes[info.cellType],
+		StyleID: style,
+		Formula: info.formula,
+		Value:   value,
+	}
+	// Shared strings store an index, only numbers and booleans keep their stored value
+	switch info.cellType {
+	case "", "n", "b":
+		src.Raw = info.value
+	}
+	return src
+}
@@ -0,0 +1,181 @@
+package transform
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// testSheetXML is a sparse worksheet: row 2 is missing, B1 is a gap, the cells of
+// row 3 have no references, and D3:D4 share a formula
+const testSheetXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+	`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<dimension ref="A1:E4"/><cols><col min="5" max="5" width="9" style="1"/></cols><sheetData>` +
+	`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>inline</t></is></c></row>` +
+	`<row r="3" s="2" customFormat="1"><c><v>1.5</v></c><c t="b"><v>1</v></c>` +
+	`<c r="D3"><f t="shared" ref="D3:D4" si="0">A3*2</f><v>3</v></c></row>` +
+	`<row r="4"><c r="A4"><v>2</v></c><c r="D4"><f t="shared" si="0"/><v>4</v></c><c r="E4"/></row>` +
+	`</sheetData></worksheet>`
+
+// testPackage builds a workbook package with testSheetXML as Sheet1 and "shared" as shared string 0
+func testPackage(t *testing.T) []byte {
+	t.Helper()
+	file := excelize.NewFile()
+	defer file.Close()
+	bold, err := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	italic, err := file.NewStyle(&excelize.Style{Font: &excelize.Font{Italic: true}})
+	if err != nil || bold != 1 || italic != 2 {
+		t.Fatalf("styles = %d, %d, %v, want 1 and 2", bold, italic, err)
+	}
+	if err := file.SetCellValue("Sheet1", "A1", "shared"); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	archive := zip.NewWriter(&out)
+	for _, entry := range reader.File {
+		w, err := archive.Create(entry.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Name == "xl/worksheets/sheet1.xml" {
+			_, err = w.Write([]byte(testSheetXML))
+		} else {
+			var rc io.ReadCloser
+			if rc, err = entry.Open(); err == nil {
+				_, err = io.Copy(w, rc)
+				rc.Close()
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestSheetCells(t *testing.T) {
+	src, err := openSource(testPackage(t), "data.xlsx", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	sc, err := openSheetCells(src, "Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	tests := []struct {
+		row, col int
+		want     sourceCell
+	}{
+		{1, 1, sourceCell{Name: "A1", Type: excelize.CellTypeSharedString}},
+		{1, 2, sourceCell{Name: "B1"}},
+		{1, 3, sourceCell{Name: "C1", Type: excelize.CellTypeInlineString}},
+		{1, 5, sourceCell{Name: "E1", StyleID: 1, Raw: ""}},
+		{2, 1, sourceCell{Name: "A2"}},
+		{2, 5, sourceCell{Name: "E2", StyleID: 1}},
+		{3, 1, sourceCell{Name: "A3", StyleID: 2, Raw: "1.5"}},
+		{3, 2, sourceCell{Name: "B3", Type: excelize.CellTypeBool, StyleID: 2, Raw: "1"}},
+		{3, 4, sourceCell{Name: "D3", StyleID: 2, Formula: "A3*2", Raw: "3"}},
+		{3, 5, sourceCell{Name: "E3", StyleID: 2}},
+		{4, 4, sourceCell{Name: "D4", Formula: "A4*2", Raw: "4"}},
+		{4, 5, sourceCell{Name: "E4", StyleID: 1}},
+		{6, 1, sourceCell{Name: "A6"}},
+	}
+	var row *sheetRow
+	for _, tt := range tests {
+		if row == nil || row.num != tt.row {
+			if row, err = sc.row(tt.row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tt.want.Sheet = "Sheet1"
+		if got := row.sourceCell("Sheet1", tt.col, ""); got != tt.want {
+			t.Errorf("%s = %+v, want %+v", tt.want.Name, got, tt.want)
+		}
+	}
+}
+
+func TestTransformSparseRows(t *testing.T) {
+	data := testPackage(t)
+	config := &Config{
+		OutputFilename: "out.xlsx",
+		Mappings:       []Mapping{{Source: "Sheet1!A1:E4", Destination: "Sheet1!B2", CopyStyles: CopyStylesNone}},
+	}
+	want := [][]string{
+		nil,
+		{"", "shared", "", "inline"},
+		nil,
+		{"", "1.5", "TRUE", "", ""},
+		{"", "2", "", "", ""},
+	}
+	// Formulas are copied as they are by default
+	wantFormulas := map[string]string{"B4": "", "E4": "A3*2", "E5": "A4*2"}
+
+	// The workbook package is streamed, a file name that cannot be opened falls back
+	// to looking up every cell in the loaded workbook
+	var logged bytes.Buffer
+	for _, streamed := range []bool{true, false} {
+		engine := testEngine(t, config)
+		var out bytes.Buffer
+		if streamed {
+			if _, err := engine.Transform(context.Background(), bytes.NewReader(data), &out); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			source, err := excelize.OpenReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer source.Close()
+			source.Path = "missing.xlsx"
+			engine.Logger = log.New(&logged, "", 0)
+			if _, err := engine.TransformFile(context.Background(), source, &out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		output, err := excelize.OpenReader(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer output.Close()
+
+		if got := testRows(t, output, "Sheet1"); !reflect.DeepEqual(got, want) {
+			t.Errorf("streamed %v: rows = %q, want %q", streamed, got, want)
+		}
+		for cell, formula := range wantFormulas {
+			if got, _ := output.GetCellFormula("Sheet1", cell); got != formula {
+				t.Errorf("streamed %v: %s formula = %q, want %q", streamed, cell, got, formula)
+			}
+		}
+		if cellType, _ := output.GetCellType("Sheet1", "C4"); cellType != excelize.CellTypeBool {
+			t.Errorf("streamed %v: C4 type = %d, want a boolean", streamed, cellType)
+		}
+	}
+	if !strings.Contains(logged.String(), "cannot stream cells of sheet Sheet1") {
+		t.Errorf("log = %q, want the fallback warning", logged.String())
+	}
+}
@@ -0,0 +1,87 @@
+package transform
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Style copying modes for the mapping "copy_styles" option
+const (
+	CopyStylesNone   = "none"
+	CopyStylesValues = "values"
+	CopyStylesFull   = "full"
+)
+
+// styleCache clones cell styles from the source workbook into the output workbook.
+// Style IDs are indexes into the styles table of each workbook, so a source ID
+// cannot be used in the output directly. Every source style is created in the
+// output once and reused for all cells that share it.
+type styleCache struct {
+	sourceFile *excelize.File
+	destFile   *excelize.File
+	ids        map[styleCacheKey]int
+}
+
+type styleCacheKey struct {
+	sourceID int
+	mode     string
+}
+
+func newStyleCache(sourceFile, destFile *excelize.File) *styleCache {
+	return &styleCache{
+		sourceFile: sourceFile,
+		destFile:   destFile,
+		ids:        make(map[styleCacheKey]int),
+	}
+}
+
+// resolve returns the output style ID equivalent to the source style ID
+func (c *styleCache) resolve(sourceID int, mode string) (int, error) {
+	key := styleCacheKey{sourceID: sourceID, mode: mode}
+	if id, ok := c.ids[key]; ok {
+		return id, nil
+	}
+
+	style, err := c.sourceFile.GetStyle(sourceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get source style %d: %w", sourceID, err)
+	}
+
+	if mode == CopyStylesValues {
+		// Keep only the number format so that numbers and dates are displayed as in the source
+		style = &excelize.Style{
+			NumFmt:        style.NumFmt,
+			DecimalPlaces: style.DecimalPlaces,
+			CustomNumFmt:  style.CustomNumFmt,
+			NegRed:        style.NegRed,
+		}
+	}
+
+	id, err := c.destFile.NewStyle(style)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create style: %w", err)
+	}
+	c.ids[key] = id
+
+	return id, nil
+}
+
+// copyCellStyle applies the style of the source cell to the destination cell
+func copyCellStyle(destFile *outputWorkbook, src sourceCell, destSheet, destCell string, opts copyOptions) error {
+	if opts.CopyStyles == CopyStylesNone || opts.styles == nil || src.StyleID == 0 {
+		return nil
+	}
+
+	mode := opts.CopyStyles
+	if mode == "" {
+		mode = CopyStylesFull
+	}
+
+	destID, err := opts.styles.resolve(src.StyleID, mode)
+	if err != nil {
+		return err
+	}
+
+	return destFile.SetCellStyle(destSheet, destCell, destCell, destID)
+}
@@ -0,0 +1,122 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestStyleCacheResolve(t *testing.T) {
+	source := excelize.NewFile()
+	defer source.Close()
+	dest := excelize.NewFile()
+	defer dest.Close()
+
+	sourceID, err := source.NewStyle(&excelize.Style{
+		Font:   &excelize.Font{Bold: true},
+		Fill:   excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"FFFF00"}},
+		NumFmt: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The output workbook has styles of its own, source IDs cannot be reused
+	if _, err := dest.NewStyle(&excelize.Style{Font: &excelize.Font{Italic: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newStyleCache(source, dest)
+	full, err := cache.resolve(sourceID, CopyStylesFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := cache.resolve(sourceID, CopyStylesValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := cache.resolve(sourceID, CopyStylesFull); again != full {
+		t.Errorf("second resolve() = %d, want the cached style %d", again, full)
+	}
+	if full == values || len(cache.ids) != 2 {
+		t.Errorf("styles full = %d, values = %d, cached = %d, want two different styles", full, values, len(cache.ids))
+	}
+
+	style, err := dest.GetStyle(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if style.Font == nil || !style.Font.Bold || style.Font.Italic || style.Fill.Pattern != 1 || style.NumFmt != 4 {
+		t.Errorf("full style = %+v, want the bold filled source style", style)
+	}
+	if style, err = dest.GetStyle(values); err != nil {
+		t.Fatal(err)
+	}
+	if (style.Font != nil && style.Font.Bold) || style.Fill.Pattern != 0 || style.NumFmt != 4 {
+		t.Errorf("values style = %+v, want the number format only", style)
+	}
+
+	if _, err := cache.resolve(1000, CopyStylesFull); err == nil {
+		t.Error("resolve() of a missing style succeeded")
+	}
+}
+
+func TestTransformCopyStyles(t *testing.T) {
+	source := testWorkbook(t, map[string][][]interface{}{"Sheet1": {{1.5, 2.5}, {3.5, "text"}}})
+	styleID, err := source.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}, NumFmt: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.SetCellStyle("Sheet1", "A1", "B2", styleID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mode     string
+		wantBold bool
+		numFmt   int
+	}{
+		{"", true, 4},
+		{CopyStylesFull, true, 4},
+		{CopyStylesValues, false, 4},
+		{CopyStylesNone, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			output, _ := testTransform(t, &Config{
+				OutputFilename: "out.xlsx",
+				Mappings: []Mapping{
+					{Source: "Sheet1!A1:B2", Destination: "Sheet1!A1", CopyStyles: tt.mode},
+					{Source: "Sheet1!A1", Destination: "Sheet1!D1", CopyStyles: tt.mode},
+				},
+			}, source)
+
+			// Cells sharing a source style share the output style
+			var first int
+			for i, cell := range []string{"A1", "B1", "A2", "B2", "D1"} {
+				id, err := output.GetCellStyle("Sheet1", cell)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i == 0 {
+					first = id
+				} else if id != first {
+					t.Errorf("%s style = %d, want %d like A1", cell, id, first)
+				}
+			}
+			if tt.mode == CopyStylesNone {
+				if first != 0 {
+					t.Errorf("style = %d, want no style", first)
+				}
+				return
+			}
+			style, err := output.GetStyle(first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bold := style.Font != nil && style.Font.Bold
+			if bold != tt.wantBold || style.NumFmt != tt.numFmt {
+				t.Errorf("style = bold %v, number format %d, want bold %v, number format %d", bold, style.NumFmt, tt.wantBold, tt.numFmt)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Functions of the mapping "transforms" pipeline
+const (
+	TransformTrim         = "trim"
+	TransformUpper        = "upper"
+	TransformLower        = "lower"
+	TransformTitle        = "title"
+	TransformReplace      = "replace"
+	TransformRegexReplace = "regex_replace"
+	TransformSplit        = "split"
+	TransformNumber       = "number"
+	TransformDate         = "date"
+)
+
+// Locales of the number and date transforms
+const (
+	LocaleRU = "ru"
+	LocaleEN = "en"
+)
+
+// defaultDateFormat is the output format of the date transform
+const defaultDateFormat = "DD.MM.YYYY"
+
+// dateFormatTokens converts Excel-like date formats such as DD.MM.YYYY to Go layouts
+var dateFormatTokens = strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "DD", "02", "hh", "15", "mm", "04", "ss", "05")
+
+// localeDateLayouts are tried before the common layouts when parsing dates of a locale
+var localeDateLayouts = map[string][]string{
+	LocaleRU: {"02.01.2006", "02.01.2006 15:04:05", "02.01.2006 15:04", "02.01.06", "2.1.2006"},
+	LocaleEN: {"01/02/2006", "1/2/2006", "01/02/2006 15:04:05", "1/2/06", "Jan 2, 2006", "January 2, 2006"},
+}
+
+// Transform is a step of the transforms pipeline of a mapping. It changes the values
+// of a source column, given by its letter or by its header, or of all columns if none is given.
+type Transform struct {
+	Column      string `yaml:"column,omitempty" json:"column,omitempty"`
+	Header      string `yaml:"header,omitempty" json:"header,omitempty"`
+	Function    string `yaml:"function" json:"function"`
+	Find        string `yaml:"find,omitempty" json:"find,omitempty"`
+	Replace     string `yaml:"replace,omitempty" json:"replace,omitempty"`
+	Separator   string `yaml:"separator,omitempty" json:"separator,omitempty"`
+	Part        int    `yaml:"part,omitempty" json:"part,omitempty"`
+	Locale      string `yaml:"locale,omitempty" json:"locale,omitempty"`
+	InputFormat string `yaml:"input_format,omitempty" json:"input_format,omitempty"`
+	Format      string `yaml:"format,omitempty" json:"format,omitempty"`
+}
+
+// transformStep is a compiled transform
+type transformStep struct {
+	column int
+	header string
+	fn     func(v *cellValue, row *rowValues) error
+}
+
+// cellValue is a cell value passing through the transforms pipeline.
+// original is true until a step changes the value read from the source cell.
+type cellValue struct {
+	col      int
+	text     string
+	number   float64
+	isNumber bool
+	original bool
+}
+
+func (v *cellValue) setText(s string) {
+	v.text, v.isNumber, v.original = s, false, false
+}
+
+func (v *cellValue) setNumber(n float64) {
+	v.text, v.number, v.isNumber, v.original = formatNumber(n), n, true, false
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// compileTransforms compiles the transforms pipeline of a mapping
+func compileTransforms(m Mapping) ([]*transformStep, error) {
+	var steps []*transformStep
+	for i, t := range m.Transforms {
+		step, err := compileTransform(t)
+		if err != nil {
+			return nil, fmt.Errorf("transforms[%d]: %w", i, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func compileTransform(t Transform) (*transformStep, error) {
+	step := &transformStep{header: t.Header}
+	if t.Column != "" {
+		if t.Header != "" {
+			return nil, fmt.Errorf("use either column or header")
+		}
+		col, err := excelize.ColumnNameToNumber(t.Column)
+		if err != nil {
+			return nil, fmt.Errorf("invalid column %q", t.Column)
+		}
+		step.column = col
+	}
+	switch t.Locale {
+	case "", LocaleRU, LocaleEN:
+	default:
+		return nil, fmt.Errorf("locale must be one of ru, en")
+	}
+
+	switch strings.ToLower(t.Function) {
+	case TransformTrim:
+		step.fn = textStep(func(s string) string { return strings.Join(strings.Fields(s), " ") })
+	case TransformUpper:
+		step.fn = textStep(strings.ToUpper)
+	case TransformLower:
+		step.fn = textStep(strings.ToLower)
+	case TransformTitle:
+		step.fn = textStep(titleCase)
+	case TransformReplace:
+		if t.Find == "" {
+			return nil, fmt.Errorf("replace requires find")
+		}
+		step.fn = textStep(func(s string) string { return strings.ReplaceAll(s, t.Find, t.Replace) })
+	case TransformRegexReplace:
+		re, err := regexp.Compile(t.Find)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", t.Find, err)
+		}
+		step.fn = textStep(func(s string) string { return re.ReplaceAllString(s, t.Replace) })
+	case TransformSplit:
+		if t.Part == 0 {
+			return nil, fmt.Errorf("split requires part, 1 for the first part or -1 for the last")
+		}
+		step.fn = textStep(func(s string) string { return splitPart(s, t.Separator, t.Part) })
+	case TransformNumber:
+		step.fn = numberStep(t.Locale)
+	case TransformDate:
+		format := t.Format
+		if format == "" {
+			format = defaultDateFormat
+		}
+		step.fn = dateStep(t.Locale, t.InputFormat, format)
+	case "":
+		return nil, fmt.Errorf("function is required")
+	default:
+		return nil, fmt.Errorf("unknown function %q", t.Function)
+	}
+
+	return step, nil
+}
+
+func (s *transformStep) bind(headers headerIndex) error {
+	if s.header == "" {
+		return nil
+	}
+	col, err := headers.column(s.header)
+	if err != nil {
+		return err
+	}
+	s.column = col
+	return nil
+}
+
+func textStep(fn func(string) string) func(*cellValue, *rowValues) error {
+	return func(v *cellValue, _ *rowValues) error {
+		v.setText(fn(v.text))
+		return nil
+	}
+}
+
+func numberStep(locale string) func(*cellValue, *rowValues) error {
+	return func(v *cellValue, row *rowValues) error {
+		if v.isNumber {
+			return nil
+		}
+		if v.original {
+			if n, ok := row.rawNumber(v.col); ok {
+				v.setNumber(n)
+				return nil
+			}
+		}
+		if strings.TrimSpace(v.text) == "" {
+			return nil
+		}
+		n, ok := parseLocaleNumber(v.text, locale)
+		if !ok {
+			return fmt.Errorf("%q is not a number", v.text)
+		}
+		v.setNumber(n)
+		return nil
+	}
+}
+
+func dateStep(locale, inputFormat, format string) func(*cellValue, *rowValues) error {
+	layout := dateFormatTokens.Replace(format)
+	inputLayout := dateFormatTokens.Replace(inputFormat)
+	return func(v *cellValue, row *rowValues) error {
+		var d time.Time
+		var ok bool
+		switch {
+		case v.original && inputFormat == "":
+			// Date cells are stored as numbers
+			d, ok = row.date(v.col)
+			if !ok {
+				d, ok = parseLocaleDate(v.text, locale)
+			}
+		case inputFormat != "":
+			var err error
+			d, err = time.Parse(inputLayout, strings.TrimSpace(v.text))
+			ok = err == nil
+		default:
+			d, ok = parseLocaleDate(v.text, locale)
+		}
+		if !ok {
+			if strings.TrimSpace(v.text) == "" {
+				return nil
+			}
+			return fmt.Errorf("%q is not a date", v.text)
+		}
+		v.setText(d.Format(layout))
+		return nil
+	}
+}
+
+// parseLocaleNumber parses a number written in the given locale, or guesses the separators
+func parseLocaleNumber(s, locale string) (float64, bool) {
+	switch locale {
+	case LocaleRU:
+		s = strings.NewReplacer(" ", "", "\u00a0", "", ".", "", ",", ".").Replace(s)
+	case LocaleEN:
+		s = strings.NewReplacer(" ", "", "\u00a0", "", ",", "").Replace(s)
+	default:
+		return parseNumber(s)
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	return n, err == nil
+}
+
+// parseLocaleDate parses a date written in the given locale, or in one of the common formats
+func parseLocaleDate(s, locale string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range localeDateLayouts[locale] {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d, true
+		}
+	}
+	return parseDate(s)
+}
+
+// splitPart returns a 1-based part of s, counted from the end if negative.
+// Without a separator s is split at whitespace.
+func splitPart(s, separator string, part int) string {
+	var parts []string
+	if separator == "" {
+		parts = strings.Fields(s)
+	} else {
+		parts = strings.Split(s, separator)
+	}
+	if part < 0 {
+		part += len(parts) + 1
+	}
+	if part < 1 || part > len(parts) {
+		return ""
+	}
+	return strings.TrimSpace(parts[part-1])
+}
+
+// titleCase capitalizes the first letter of every word and lowercases the others
+func titleCase(s string) string {
+	var b strings.Builder
+	start := true
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		if start {
+			b.WriteRune(unicode.ToUpper(r))
+		} else {
+			b.WriteRune(unicode.ToLower(r))
+		}
+		start = unicode.IsSpace(r) || r == '-'
+	}
+	return b.String()
+}
+
+// applyTransforms runs the steps of the column on a source cell.
+// The value of a transformed cell replaces the source value and formula.
+func applyTransforms(steps []*transformStep, src sourceCell, col int, row *rowValues) (sourceCell, error) {
+	v := &cellValue{col: col, text: src.Value, original: true}
+	for _, step := range steps {
+		if step.column != 0 && step.column != col {
+			continue
+		}
+		if err := step.fn(v, row); err != nil {
+			return src, err
+		}
+	}
+	if v.original {
+		return src, nil
+	}
+
+	src.Formula, src.Raw = "", ""
+	src.Value = v.text
+	if v.isNumber {
+		src.Type = excelize.CellTypeNumber
+	} else {
+		src.Type = excelize.CellTypeInlineString
+	}
+	return src, nil
+}
@@ -0,0 +1,718 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+	"github.com/xuri/excelize/v2"
+)
+
+// BIFF8 record types used by the .xls reader
+const (
+	biffFormula    = 0x0006
+	biffEOF        = 0x000A
+	biffDateMode   = 0x0022
+	biffFilePass   = 0x002F
+	biffContinue   = 0x003C
+	biffBoundSheet = 0x0085
+	biffMulRK      = 0x00BD
+	biffXF         = 0x00E0
+	biffSST        = 0x00FC
+	biffLabelSST   = 0x00FD
+	biffNumber     = 0x0203
+	biffLabel      = 0x0204
+	biffBoolErr    = 0x0205
+	biffString     = 0x0207
+	biffArray      = 0x0221
+	biffTable      = 0x0236
+	biffRK         = 0x027E
+	biffFormat     = 0x041E
+	biffShrFmla    = 0x04BC
+	biffBOF        = 0x0809
+)
+
+// cfbSignature is the magic number of Compound File Binary containers (.xls, .doc, encrypted .xlsx)
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// zipSignature is the magic number of zip packages (.xlsx)
+var zipSignature = []byte{'P', 'K', 0x03, 0x04}
+
+type xlsRecord struct {
+	typ  uint16
+	data []byte
+}
+
+type xlsSheet struct {
+	name   string
+	offset uint32
+	kind   byte
+}
+
+// xlsWorkbook holds the workbook globals needed to decode sheet cells
+type xlsWorkbook struct {
+	stream    []byte
+	sheets    []xlsSheet
+	sst       []string
+	xfFormats []uint16
+	formats   map[uint16]string
+	date1904  bool
+}
+
+// errNoWorkbookStream reports a compound file without a BIFF8 workbook stream
+var errNoWorkbookStream = errors.New("workbook stream not found, file is not an Excel 97-2003 workbook")
+
+// openSource opens a workbook package read into memory. Legacy .xls (BIFF8), OpenDocument (.ods)
+// and CSV files are converted into an in-memory excelize workbook so that mappings work the same way as for .xlsx.
+// The file extension is not trusted: some systems save .xlsx content with the .xls extension.
+// It only selects the tab delimiter of .tsv files; filename may be empty.
+func openSource(data []byte, filename string, csv *CSVOptions, password string) (*sourceWorkbook, error) {
+	if bytes.HasPrefix(data, cfbSignature) {
+		file, err := readXLS(bytes.NewReader(data))
+		if err == nil {
+			return &sourceWorkbook{File: file}, nil
+		}
+		// Encrypted .xlsx files are compound files too
+		if !errors.Is(err, errNoWorkbookStream) {
+			return nil, err
+		}
+		// The decrypted package is kept, so that sheets are streamed like those of other .xlsx files
+		if data, err = decryptWorkbook(data, password); err != nil {
+			return nil, err
+		}
+	}
+
+	if !bytes.HasPrefix(data, zipSignature) && isText(data) {
+		return readCSV(data, csv.forFile(filename))
+	}
+	if isODS(data) {
+		return readODS(data)
+	}
+
+	file, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &sourceWorkbook{File: file, data: data}, nil
+}
+
+// readXLS reads a BIFF8 workbook and converts it to an excelize workbook
+func readXLS(r io.ReaderAt) (*excelize.File, error) {
+	doc, err := mscfb.New(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compound file: %w", err)
+	}
+
+	var stream []byte
+	for entry, err := doc.Next(); err == nil && stream == nil; entry, err = doc.Next() {
+		switch entry.Name {
+		case "Workbook":
+			if stream, err = io.ReadAll(entry); err != nil {
+				return nil, fmt.Errorf("failed to read workbook stream: %w", err)
+			}
+		case "Book":
+			return nil, errors.New("excel 5.0/95 workbooks are not supported, save the file as Excel 97-2003 or .xlsx")
+		}
+	}
+	if stream == nil {
+		return nil, errNoWorkbookStream
+	}
+
+	wb := &xlsWorkbook{stream: stream, formats: make(map[uint16]string)}
+	if err := wb.readGlobals(); err != nil {
+		return nil, err
+	}
+
+	return wb.toExcelize()
+}
+
+// readRecord reads a BIFF record at the given stream offset
+func (wb *xlsWorkbook) readRecord(offset int) (xlsRecord, int, error) {
+	if offset+4 > len(wb.stream) {
+		return xlsRecord{}, 0, io.ErrUnexpectedEOF
+	}
+	typ := binary.LittleEndian.Uint16(wb.stream[offset:])
+	size := int(binary.LittleEndian.Uint16(wb.stream[offset+2:]))
+	if offset+4+size > len(wb.stream) {
+		return xlsRecord{}, 0, fmt.Errorf("record 0x%04X at offset %d is truncated", typ, offset)
+	}
+	return xlsRecord{typ: typ, data: wb.stream[offset+4 : offset+4+size]}, offset + 4 + size, nil
+}
+
+// readGlobals parses the workbook globals substream: sheets, shared strings and number formats
+func (wb *xlsWorkbook) readGlobals() error {
+	rec, offset, err := wb.readRecord(0)
+	if err != nil {
+		return fmt.Errorf("failed to read BOF record: %w", err)
+	}
+	if rec.typ != biffBOF || len(rec.data) < 4 {
+		return fmt.Errorf("invalid workbook stream: BOF record expected")
+	}
+	if version := binary.LittleEndian.Uint16(rec.data); version != 0x0600 {
+		return fmt.Errorf("unsupported BIFF version 0x%04X, only Excel 97-2003 (BIFF8) is supported", version)
+	}
+
+	for offset < len(wb.stream) {
+		rec, next, err := wb.readRecord(offset)
+		if err != nil {
+			return err
+		}
+
+		switch rec.typ {
+		case biffEOF:
+			return nil
+
+		case biffFilePass:
+			return fmt.Errorf("password-protected .xls files are not supported")
+
+		case biffDateMode:
+			wb.date1904 = len(rec.data) >= 2 && binary.LittleEndian.Uint16(rec.data) == 1
+
+		case biffBoundSheet:
+			if len(rec.data) < 8 {
+				return fmt.Errorf("invalid BOUNDSHEET record")
+			}
+			r := &xlsSegmentReader{segs: [][]byte{rec.data[6:]}}
+			name, err := r.shortString()
+			if err != nil {
+				return fmt.Errorf("invalid sheet name: %w", err)
+			}
+			wb.sheets = append(wb.sheets, xlsSheet{
+				name:   name,
+				offset: binary.LittleEndian.Uint32(rec.data),
+				kind:   rec.data[5],
+			})
+
+		case biffFormat:
+			if len(rec.data) < 2 {
+				continue
+			}
+			r := &xlsSegmentReader{segs: [][]byte{rec.data[2:]}}
+			if format, err := r.longString(); err == nil {
+				wb.formats[binary.LittleEndian.Uint16(rec.data)] = format
+			}
+
+		case biffXF:
+			if len(rec.data) >= 4 {
+				wb.xfFormats = append(wb.xfFormats, binary.LittleEndian.Uint16(rec.data[2:]))
+			}
+
+		case biffSST:
+			segs := [][]byte{rec.data}
+			for {
+				cont, after, err := wb.readRecord(next)
+				if err != nil || cont.typ != biffContinue {
+					break
+				}
+				segs = append(segs, cont.data)
+				next = after
+			}
+			if err := wb.readSST(segs); err != nil {
+				return fmt.Errorf("failed to read shared strings: %w", err)
+			}
+		}
+
+		offset = next
+	}
+
+	return nil
+}
+
+// readSST decodes the shared string table, which may be split across CONTINUE records
+func (wb *xlsWorkbook) readSST(segs [][]byte) error {
+	r := &xlsSegmentReader{segs: segs}
+	header, err := r.bytes(8)
+	if err != nil {
+		return err
+	}
+	// The count comes from the file: every string takes at least 3 bytes,
+	// so a larger count cannot be satisfied by the remaining data
+	count := int(binary.LittleEndian.Uint32(header[4:]))
+	wb.sst = make([]string, 0, min(count, r.left()/3))
+
+	for i := 0; i < count; i++ {
+		s, err := r.richString()
+		if err != nil {
+			return fmt.Errorf("string %d: %w", i, err)
+		}
+		wb.sst = append(wb.sst, s)
+	}
+
+	return nil
+}
+
+// toExcelize converts all worksheets into a new in-memory excelize workbook
+func (wb *xlsWorkbook) toExcelize() (*excelize.File, error) {
+	file := excelize.NewFile()
+	dateStyles := make(map[uint16]int)
+	keepDefaultSheet := false
+
+	for _, sheet := range wb.sheets {
+		// Skip chart sheets, macro sheets and VB modules
+		if sheet.kind != 0 {
+			continue
+		}
+		if _, err := file.NewSheet(sheet.name); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to create sheet %s: %w", sheet.name, err)
+		}
+		if sheet.name == "Sheet1" {
+			keepDefaultSheet = true
+		}
+		if err := wb.readSheet(file, sheet, dateStyles); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("sheet %s: %w", sheet.name, err)
+		}
+	}
+
+	if !keepDefaultSheet && len(file.GetSheetList()) > 1 {
+		file.DeleteSheet("Sheet1")
+	}
+
+	return file, nil
+}
+
+// readSheet decodes the cell records of one worksheet substream
+func (wb *xlsWorkbook) readSheet(file *excelize.File, sheet xlsSheet, dateStyles map[uint16]int) error {
+	offset := int(sheet.offset)
+	rec, offset, err := wb.readRecord(offset)
+	if err != nil {
+		return err
+	}
+	if rec.typ != biffBOF {
+		return fmt.Errorf("BOF record expected at offset %d", sheet.offset)
+	}
+
+	for offset < len(wb.stream) {
+		rec, next, err := wb.readRecord(offset)
+		if err != nil {
+			return err
+		}
+		offset = next
+		data := rec.data
+
+		switch rec.typ {
+		case biffEOF:
+			return nil
+
+		case biffNumber:
+			if len(data) < 14 {
+				continue
+			}
+			value := math.Float64frombits(binary.LittleEndian.Uint64(data[6:]))
+			if err := wb.setNumber(file, sheet.name, data, value, dateStyles); err != nil {
+				return err
+			}
+
+		case biffRK:
+			if len(data) < 10 {
+				continue
+			}
+			value := decodeRK(binary.LittleEndian.Uint32(data[6:]))
+			if err := wb.setNumber(file, sheet.name, data, value, dateStyles); err != nil {
+				return err
+			}
+
+		case biffMulRK:
+			if len(data) < 6 {
+				continue
+			}
+			row := binary.LittleEndian.Uint16(data)
+			col := binary.LittleEndian.Uint16(data[2:])
+			for pos := 4; pos+6 <= len(data)-2; pos += 6 {
+				cell := make([]byte, 6)
+				binary.LittleEndian.PutUint16(cell, row)
+				binary.LittleEndian.PutUint16(cell[2:], col)
+				copy(cell[4:], data[pos:pos+2])
+				value := decodeRK(binary.LittleEndian.Uint32(data[pos+2:]))
+				if err := wb.setNumber(file, sheet.name, cell, value, dateStyles); err != nil {
+					return err
+				}
+				col++
+			}
+
+		case biffLabelSST:
+			if len(data) < 10 {
+				continue
+			}
+			index := int(binary.LittleEndian.Uint32(data[6:]))
+			if index >= len(wb.sst) {
+				return fmt.Errorf("shared string index %d out of range", index)
+			}
+			if err := setXLSCell(file, sheet.name, data, wb.sst[index]); err != nil {
+				return err
+			}
+
+		case biffLabel:
+			if len(data) < 8 {
+				continue
+			}
+			r := &xlsSegmentReader{segs: [][]byte{data[6:]}}
+			value, err := r.longString()
+			if err != nil {
+				return fmt.Errorf("invalid LABEL record: %w", err)
+			}
+			if err := setXLSCell(file, sheet.name, data, value); err != nil {
+				return err
+			}
+
+		case biffBoolErr:
+			if len(data) < 8 {
+				continue
+			}
+			if data[7] == 0 {
+				if err := setXLSCell(file, sheet.name, data, data[6] != 0); err != nil {
+					return err
+				}
+			} else if err := setXLSCell(file, sheet.name, data, xlsErrorText(data[6])); err != nil {
+				return err
+			}
+
+		case biffFormula:
+			if len(data) < 14 {
+				continue
+			}
+			result := data[6:14]
+			if result[6] != 0xFF || result[7] != 0xFF {
+				value := math.Float64frombits(binary.LittleEndian.Uint64(result))
+				if err := wb.setNumber(file, sheet.name, data, value, dateStyles); err != nil {
+					return err
+				}
+				continue
+			}
+			switch result[0] {
+			case 0: // string, value follows in a STRING record
+				value, after := wb.formulaString(next)
+				offset = after
+				if err := setXLSCell(file, sheet.name, data, value); err != nil {
+					return err
+				}
+			case 1: // boolean
+				if err := setXLSCell(file, sheet.name, data, result[2] != 0); err != nil {
+					return err
+				}
+			case 2: // error
+				if err := setXLSCell(file, sheet.name, data, xlsErrorText(result[2])); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// formulaString reads the STRING record holding the string result of the formula whose record
+// ends at offset. The SHRFMLA, ARRAY or TABLE record of a shared or array formula comes first,
+// and long strings continue in CONTINUE records. It returns the offset of the next record.
+func (wb *xlsWorkbook) formulaString(offset int) (string, int) {
+	rec, next, err := wb.readRecord(offset)
+	for err == nil && (rec.typ == biffShrFmla || rec.typ == biffArray || rec.typ == biffTable) {
+		offset = next
+		rec, next, err = wb.readRecord(offset)
+	}
+	if err != nil || rec.typ != biffString {
+		return "", offset
+	}
+
+	segs := [][]byte{rec.data}
+	for {
+		cont, after, err := wb.readRecord(next)
+		if err != nil || cont.typ != biffContinue {
+			break
+		}
+		segs = append(segs, cont.data)
+		next = after
+	}
+	r := &xlsSegmentReader{segs: segs}
+	value, _ := r.longString()
+	return value, next
+}
+
+// setNumber writes a numeric cell, keeping dates as date serials with a date number format
+func (wb *xlsWorkbook) setNumber(file *excelize.File, sheet string, data []byte, value float64, dateStyles map[uint16]int) error {
+	cell, err := xlsCellName(data)
+	if err != nil {
+		return err
+	}
+	if err := file.SetCellFloat(sheet, cell, value, -1, 64); err != nil {
+		return err
+	}
+
+	xf := int(binary.LittleEndian.Uint16(data[4:]))
+	if xf >= len(wb.xfFormats) {
+		return nil
+	}
+	numFmt := wb.xfFormats[xf]
+	if !wb.isDateFormat(numFmt) {
+		return nil
+	}
+
+	styleID, ok := dateStyles[numFmt]
+	if !ok {
+		style := &excelize.Style{NumFmt: int(numFmt)}
+		if format, custom := wb.formats[numFmt]; custom {
+			style = &excelize.Style{CustomNumFmt: &format}
+		}
+		if styleID, err = file.NewStyle(style); err != nil {
+			return fmt.Errorf("failed to create date style: %w", err)
+		}
+		dateStyles[numFmt] = styleID
+	}
+
+	if wb.date1904 {
+		// The output workbook uses the 1900 date system
+		if err := file.SetCellFloat(sheet, cell, value+1462, -1, 64); err != nil {
+			return err
+		}
+	}
+
+	return file.SetCellStyle(sheet, cell, cell, styleID)
+}
+
+// isDateFormat reports whether a number format index formats values as dates or times
+func (wb *xlsWorkbook) isDateFormat(numFmt uint16) bool {
+	return isDateNumFmt(int(numFmt), wb.formats[numFmt])
+}
+
+// isDateNumFmt reports whether a built-in number format index or a custom format code
+// formats values as dates or times
+func isDateNumFmt(numFmt int, format string) bool {
+	switch {
+	case numFmt >= 14 && numFmt <= 22, numFmt >= 45 && numFmt <= 47:
+		return true
+	}
+
+	// Look for date/time tokens outside of quoted text and [color]/[$-locale] sections
+	inQuotes, inBrackets := false, false
+	for i := 0; i < len(format); i++ {
+		ch := format[i]
+		switch {
+		case ch == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case ch == '\\' || ch == '_' || ch == '*':
+			i++
+		case ch == '[':
+			inBrackets = true
+		case ch == ']':
+			inBrackets = false
+		case inBrackets:
+		case strings.ContainsRune("dmyhsDMYHS", rune(ch)):
+			return true
+		}
+	}
+
+	return false
+}
+
+func setXLSCell(file *excelize.File, sheet string, data []byte, value interface{}) error {
+	cell, err := xlsCellName(data)
+	if err != nil {
+		return err
+	}
+	return file.SetCellValue(sheet, cell, value)
+}
+
+// xlsCellName converts the zero-based row/column of a cell record into an A1 reference
+func xlsCellName(data []byte) (string, error) {
+	row := int(binary.LittleEndian.Uint16(data))
+	col := int(binary.LittleEndian.Uint16(data[2:]))
+	return excelize.CoordinatesToCellName(col+1, row+1)
+}
+
+// decodeRK decodes the compressed RK number representation
+func decodeRK(rk uint32) float64 {
+	var value float64
+	if rk&0x02 != 0 {
+		value = float64(int32(rk) >> 2)
+	} else {
+		value = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		value /= 100
+	}
+	return value
+}
+
+func xlsErrorText(code byte) string {
+	switch code {
+	case 0x00:
+		return "#NULL!"
+	case 0x07:
+		return "#DIV/0!"
+	case 0x0F:
+		return "#VALUE!"
+	case 0x17:
+		return "#REF!"
+	case 0x1D:
+		return "#NAME?"
+	case 0x24:
+		return "#NUM!"
+	default:
+		return "#N/A"
+	}
+}
+
+// xlsSegmentReader reads BIFF data that may be split across a record and its CONTINUE records.
+// When character data crosses a record boundary the next record starts with a new option byte.
+type xlsSegmentReader struct {
+	segs [][]byte
+	seg  int
+	pos  int
+}
+
+func (r *xlsSegmentReader) remaining() int {
+	if r.seg >= len(r.segs) {
+		return 0
+	}
+	return len(r.segs[r.seg]) - r.pos
+}
+
+// left returns the number of bytes not read yet in all segments
+func (r *xlsSegmentReader) left() int {
+	n := r.remaining()
+	for _, seg := range r.segs[min(r.seg+1, len(r.segs)):] {
+		n += len(seg)
+	}
+	return n
+}
+
+func (r *xlsSegmentReader) advance() bool {
+	for r.seg < len(r.segs) && r.remaining() == 0 {
+		r.seg++
+		r.pos = 0
+	}
+	return r.seg < len(r.segs)
+}
+
+// bytes reads n bytes, crossing segment boundaries as needed
+func (r *xlsSegmentReader) bytes(n int) ([]byte, error) {
+	var out []byte
+	err := r.read(n, func(b []byte) { out = append(out, b...) })
+	return out, err
+}
+
+// skip skips n bytes without copying them
+func (r *xlsSegmentReader) skip(n int) error {
+	return r.read(n, func([]byte) {})
+}
+
+// read passes the next n bytes to fn segment by segment. Lengths are read from the file,
+// so n is checked against the data left before anything is read.
+func (r *xlsSegmentReader) read(n int, fn func([]byte)) error {
+	if n < 0 || n > r.left() {
+		return io.ErrUnexpectedEOF
+	}
+	for n > 0 {
+		r.advance()
+		take := min(n, r.remaining())
+		fn(r.segs[r.seg][r.pos : r.pos+take])
+		r.pos += take
+		n -= take
+	}
+	return nil
+}
+
+// chars reads cch characters, compressed (Latin-1) or UTF-16LE depending on highByte
+func (r *xlsSegmentReader) chars(cch int, highByte bool) (string, error) {
+	var units []uint16
+	for cch > 0 {
+		if r.remaining() == 0 {
+			if !r.advance() {
+				return "", io.ErrUnexpectedEOF
+			}
+			flags, err := r.bytes(1)
+			if err != nil {
+				return "", err
+			}
+			highByte = flags[0]&0x01 != 0
+			continue
+		}
+
+		size := 1
+		if highByte {
+			size = 2
+		}
+		n := r.remaining() / size
+		if n == 0 {
+			return "", fmt.Errorf("character split across records")
+		}
+		if n > cch {
+			n = cch
+		}
+		data := r.segs[r.seg][r.pos : r.pos+n*size]
+		for i := 0; i < n; i++ {
+			if highByte {
+				units = append(units, binary.LittleEndian.Uint16(data[i*2:]))
+			} else {
+				units = append(units, uint16(data[i]))
+			}
+		}
+		r.pos += n * size
+		cch -= n
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// shortString reads a ShortXLUnicodeString (8-bit length)
+func (r *xlsSegmentReader) shortString() (string, error) {
+	header, err := r.bytes(2)
+	if err != nil {
+		return "", err
+	}
+	return r.chars(int(header[0]), header[1]&0x01 != 0)
+}
+
+// longString reads an XLUnicodeString (16-bit length)
+func (r *xlsSegmentReader) longString() (string, error) {
+	header, err := r.bytes(3)
+	if err != nil {
+		return "", err
+	}
+	return r.chars(int(binary.LittleEndian.Uint16(header)), header[2]&0x01 != 0)
+}
+
+// richString reads an XLUnicodeRichExtendedString used by the shared string table
+func (r *xlsSegmentReader) richString() (string, error) {
+	header, err := r.bytes(3)
+	if err != nil {
+		return "", err
+	}
+	cch := int(binary.LittleEndian.Uint16(header))
+	flags := header[2]
+
+	runs, extSize := 0, 0
+	if flags&0x08 != 0 {
+		b, err := r.bytes(2)
+		if err != nil {
+			return "", err
+		}
+		runs = int(binary.LittleEndian.Uint16(b))
+	}
+	if flags&0x04 != 0 {
+		b, err := r.bytes(4)
+		if err != nil {
+			return "", err
+		}
+		extSize = int(binary.LittleEndian.Uint32(b))
+	}
+
+	s, err := r.chars(cch, flags&0x01 != 0)
+	if err != nil {
+		return "", err
+	}
+
+	// Skip formatting runs and phonetic data
+	if err := r.skip(runs*4 + extSize); err != nil {
+		return "", err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,377 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"math"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func le16(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+
+func le32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+
+func le64(v float64) []byte { return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)) }
+
+// biffRecord builds a BIFF8 record from its parts
+func biffRecord(typ uint16, parts ...[]byte) []byte {
+	var data []byte
+	for _, part := range parts {
+		data = append(data, part...)
+	}
+	return append(append(le16(typ), le16(uint16(len(data)))...), data...)
+}
+
+// xlsCell is the row, column and XF index that start every cell record
+func xlsCell(row, col, xf uint16) []byte {
+	return append(append(le16(row), le16(col)...), le16(xf)...)
+}
+
+// compressed builds the characters of a compressed (Latin-1) string with its 16-bit length
+func compressed(s string) []byte {
+	return append(append(le16(uint16(len(s))), 0), s...)
+}
+
+// testXLSWorkbook builds a workbook stream with one sheet Data made of the cell records
+func testXLSWorkbook(sst []string, cells ...[]byte) *xlsWorkbook {
+	bof := biffRecord(biffBOF, le16(0x0600), le16(0x0005), make([]byte, 12))
+	sstData := append(le32(uint32(len(sst))), le32(uint32(len(sst)))...)
+	for _, s := range sst {
+		sstData = append(sstData, compressed(s)...)
+	}
+
+	boundSheet := func(offset uint32) []byte {
+		return biffRecord(biffBoundSheet, le32(offset), []byte{0, 0, 4, 0}, []byte("Data"))
+	}
+	globals := [][]byte{
+		bof,
+		biffRecord(biffXF, le16(0), le16(0), make([]byte, 16)),
+		biffRecord(biffXF, le16(0), le16(14), make([]byte, 16)),
+		boundSheet(0),
+		biffRecord(biffSST, sstData),
+		biffRecord(biffEOF),
+	}
+	size := 0
+	for _, rec := range globals {
+		size += len(rec)
+	}
+	globals[3] = boundSheet(uint32(size))
+
+	var stream []byte
+	for _, rec := range globals {
+		stream = append(stream, rec...)
+	}
+	stream = append(stream, bof...)
+	for _, cell := range cells {
+		stream = append(stream, cell...)
+	}
+	stream = append(stream, biffRecord(biffEOF)...)
+	return &xlsWorkbook{stream: stream, formats: make(map[uint16]string)}
+}
+
+// testCFB wraps a workbook stream in a version 3 compound file: a FAT sector,
+// a directory sector and the stream, padded so that it is not kept in the mini stream
+func testCFB(stream []byte) []byte {
+	const sectorSize = 512
+	size := len(stream)
+	if size < 4096 {
+		size = 4096
+	}
+	sectors := (size + sectorSize - 1) / sectorSize
+	free, endOfChain, fatSector := uint32(0xFFFFFFFF), uint32(0xFFFFFFFE), uint32(0xFFFFFFFD)
+
+	header := []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+	header = append(header, make([]byte, 16)...)
+	header = append(header, le16(0x3E)...)
+	header = append(header, le16(3)...)
+	header = append(header, le16(0xFFFE)...)
+	header = append(header, le16(9)...)
+	header = append(header, le16(6)...)
+	header = append(header, make([]byte, 10)...)
+	header = append(header, le32(1)...) // FAT sectors
+	header = append(header, le32(1)...) // first directory sector
+	header = append(header, le32(0)...)
+	header = append(header, le32(4096)...)
+	header = append(header, le32(endOfChain)...) // no mini FAT
+	header = append(header, le32(0)...)
+	header = append(header, le32(endOfChain)...) // no DIFAT sectors
+	header = append(header, le32(0)...)
+	header = append(header, le32(0)...) // the FAT is sector 0
+	for len(header) < sectorSize {
+		header = append(header, le32(free)...)
+	}
+
+	fat := append(le32(fatSector), le32(endOfChain)...)
+	for i := 1; i < sectors; i++ {
+		fat = append(fat, le32(uint32(2+i))...)
+	}
+	fat = append(fat, le32(endOfChain)...)
+	for len(fat) < sectorSize {
+		fat = append(fat, le32(free)...)
+	}
+
+	entry := func(name string, kind byte, child, start, size uint32) []byte {
+		data := make([]byte, 128)
+		for i, r := range name {
+			binary.LittleEndian.PutUint16(data[i*2:], uint16(r))
+		}
+		if name != "" {
+			binary.LittleEndian.PutUint16(data[64:], uint16(len(name)*2+2))
+		}
+		data[66], data[67] = kind, 1
+		binary.LittleEndian.PutUint32(data[68:], free)
+		binary.LittleEndian.PutUint32(data[72:], free)
+		binary.LittleEndian.PutUint32(data[76:], child)
+		binary.LittleEndian.PutUint32(data[116:], start)
+		binary.LittleEndian.PutUint32(data[120:], size)
+		return data
+	}
+	dir := entry("Root Entry", 5, 1, endOfChain, 0)
+	dir = append(dir, entry("Workbook", 2, free, 2, uint32(size))...)
+	dir = append(dir, entry("", 0, free, 0, 0)...)
+	dir = append(dir, entry("", 0, free, 0, 0)...)
+
+	data := append(append(header, fat...), dir...)
+	data = append(data, stream...)
+	return append(data, make([]byte, sectors*sectorSize-len(stream))...)
+}
+
+func TestTransformXLS(t *testing.T) {
+	wb := testXLSWorkbook([]string{"Name", "Date", "Paid", "Ann"},
+		biffRecord(biffLabelSST, xlsCell(0, 0, 0), le32(0)),
+		biffRecord(biffLabelSST, xlsCell(0, 1, 0), le32(1)),
+		biffRecord(biffLabelSST, xlsCell(0, 2, 0), le32(2)),
+		biffRecord(biffLabelSST, xlsCell(1, 0, 0), le32(3)),
+		biffRecord(biffNumber, xlsCell(1, 1, 1), le64(45000)),
+		biffRecord(biffBoolErr, xlsCell(1, 2, 0), []byte{1, 0}),
+	)
+	engine, err := NewEngine(&Config{
+		OutputFilename: "out.xlsx",
+		Mappings:       []Mapping{{Source: "Data!A1:C2", Destination: "Sheet1!A1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Logger = log.New(io.Discard, "", 0)
+	var out bytes.Buffer
+	if _, err := engine.Transform(context.Background(), bytes.NewReader(testCFB(wb.stream)), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := excelize.OpenReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		cell     string
+		wantType excelize.CellType
+		want     string
+	}{
+		{"A2", excelize.CellTypeSharedString, "Ann"},
+		{"B2", excelize.CellTypeUnset, "45000"}, // numbers are stored without a type attribute
+		{"C2", excelize.CellTypeBool, "1"},
+	}
+	for _, tt := range tests {
+		cellType, err := file.GetCellType("Sheet1", tt.cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := file.GetCellValue("Sheet1", tt.cell, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cellType != tt.wantType || got != tt.want {
+			t.Errorf("%s = %q of type %d, want %q of type %d", tt.cell, got, cellType, tt.want, tt.wantType)
+		}
+	}
+
+	// The date is a number displayed with its format
+	styleID, err := file.GetCellStyle("Sheet1", "B2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if style, err := file.GetStyle(styleID); err != nil || style.NumFmt != 14 {
+		t.Errorf("B2 style = %v, %v, want number format 14", style, err)
+	}
+}
+
+func TestReadXLSCells(t *testing.T) {
+	stringResult := []byte{0, 0, 0, 0, 0, 0, 0xFF, 0xFF}
+	wb := testXLSWorkbook([]string{"text"},
+		biffRecord(biffNumber, xlsCell(0, 0, 0), le64(42.5)),
+		biffRecord(biffLabelSST, xlsCell(0, 1, 0), le32(0)),
+		biffRecord(biffRK, xlsCell(1, 0, 0), le32(7<<2|0x02)),
+		biffRecord(biffNumber, xlsCell(1, 1, 1), le64(45000)),
+		biffRecord(biffBoolErr, xlsCell(2, 0, 0), []byte{1, 0}),
+		biffRecord(biffBoolErr, xlsCell(2, 1, 0), []byte{0x07, 1}),
+		// A shared formula: the SHRFMLA record comes between FORMULA and STRING
+		biffRecord(biffFormula, xlsCell(3, 0, 0), stringResult, make([]byte, 6)),
+		biffRecord(biffShrFmla, make([]byte, 10)),
+		biffRecord(biffString, compressed("shared")),
+		biffRecord(biffFormula, xlsCell(3, 1, 0), stringResult, make([]byte, 6)),
+		biffRecord(biffString, compressed("plain")),
+		biffRecord(biffFormula, xlsCell(3, 2, 0), le64(3.5), make([]byte, 6)),
+		biffRecord(biffLabel, xlsCell(4, 0, 0), compressed("label")),
+	)
+	if err := wb.readGlobals(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := wb.toExcelize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"A1", "42.5"},
+		{"B1", "text"},
+		{"A2", "7"},
+		{"B2", "45000"},
+		{"A3", "1"}, // booleans are stored as 1 and 0
+		{"B3", "#DIV/0!"},
+		{"A4", "shared"},
+		{"B4", "plain"},
+		{"C4", "3.5"},
+		{"A5", "label"},
+	}
+	for _, tt := range tests {
+		got, err := file.GetCellValue("Data", tt.cell, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.cell, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cell, got, tt.want)
+		}
+	}
+
+	// Dates keep their number format
+	styleID, err := file.GetCellStyle("Data", "B2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	style, err := file.GetStyle(styleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if style.NumFmt != 14 {
+		t.Errorf("B2 number format = %d, want 14", style.NumFmt)
+	}
+}
+
+func TestReadSST(t *testing.T) {
+	header := func(count uint32) []byte { return append(le32(count), le32(count)...) }
+
+	tests := []struct {
+		name    string
+		segs    [][]byte
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "strings",
+			segs: [][]byte{append(append(header(2), compressed("ab")...), compressed("c")...)},
+			want: []string{"ab", "c"},
+		},
+		{
+			name: "UTF-16 string",
+			segs: [][]byte{append(header(1), 1, 0, 1, 0x2F, 0x04)},
+			want: []string{"Я"},
+		},
+		{
+			// The continued characters start with a new option byte, here switching to compressed
+			name: "string split across CONTINUE records",
+			segs: [][]byte{append(header(1), 3, 0, 1, 'a', 0), {0, 'b', 'c'}},
+			want: []string{"abc"},
+		},
+		{
+			name: "rich string with formatting runs",
+			segs: [][]byte{append(header(1), 1, 0, 0x08, 1, 0, 'x', 0, 0, 0, 0)},
+			want: []string{"x"},
+		},
+		{
+			name:    "count larger than the data",
+			segs:    [][]byte{append(header(0xFFFFFFFF), compressed("a")...)},
+			wantErr: true,
+		},
+		{
+			name:    "phonetic data larger than the record",
+			segs:    [][]byte{append(header(1), 1, 0, 0x04, 0xFF, 0xFF, 0xFF, 0x7F, 'x')},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wb := &xlsWorkbook{}
+			err := wb.readSST(tt.segs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readSST() = %q, want an error", wb.sst)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(wb.sst) != len(tt.want) {
+				t.Fatalf("readSST() = %q, want %q", wb.sst, tt.want)
+			}
+			for i := range tt.want {
+				if wb.sst[i] != tt.want[i] {
+					t.Errorf("string %d = %q, want %q", i, wb.sst[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeRK(t *testing.T) {
+	tests := []struct {
+		rk   uint32
+		want float64
+	}{
+		{7<<2 | 0x02, 7},
+		{uint32(0xFFFFFFFC) | 0x02, -1},
+		{1234<<2 | 0x03, 12.34},
+		{uint32(math.Float64bits(1.5)>>32) &^ 0x03, 1.5},
+		{uint32(math.Float64bits(1.5)>>32)&^0x03 | 0x01, 0.015},
+	}
+	for _, tt := range tests {
+		if got := decodeRK(tt.rk); got != tt.want {
+			t.Errorf("decodeRK(%#x) = %v, want %v", tt.rk, got, tt.want)
+		}
+	}
+}
+
+func TestIsDateNumFmt(t *testing.T) {
+	tests := []struct {
+		numFmt int
+		format string
+		want   bool
+	}{
+		{14, "", true},
+		{22, "", true},
+		{4, "", false},
+		{164, "dd.mm.yyyy", true},
+		{164, "[$-419]mmmm yyyy", true},
+		{164, "hh:mm", true},
+		{164, "#,##0.00", false},
+		{164, `0.00 "days"`, false},
+		{164, "[Red]0.00", false},
+		{164, `0\d`, false},
+	}
+	for _, tt := range tests {
+		if got := isDateNumFmt(tt.numFmt, tt.format); got != tt.want {
+			t.Errorf("isDateNumFmt(%d, %q) = %v, want %v", tt.numFmt, tt.format, got, tt.want)
+		}
+	}
+}